@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/client"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/encrypt"
+)
+
+var (
+	ageRecipients, pgpPublicKeyFiles []string
+
+	ageKeyFile, pgpKeyFile, outputFile string
+
+	encryptValuesOnly bool
+)
+
+// AuthCmd describes "image-syncer auth" command
+var AuthCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage auth files",
+}
+
+// AuthEncryptCmd describes "image-syncer auth encrypt" command
+var AuthEncryptCmd = &cobra.Command{
+	Use:   "encrypt <auth file>",
+	Short: "Encrypt an auth file with age recipients or PGP public keys",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceErrors = true
+
+		recipients, err := newRecipients()
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+		result, err := client.EncryptAuthFile(args[0], recipients, encryptValuesOnly)
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(result)
+	},
+}
+
+// AuthDecryptCmd describes "image-syncer auth decrypt" command
+var AuthDecryptCmd = &cobra.Command{
+	Use:   "decrypt <auth file>",
+	Short: "Decrypt an auth file, keys are read from flags or environment variables",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceErrors = true
+
+		var keys *encrypt.Keys
+		var err error
+
+		if ageKeyFile != "" || pgpKeyFile != "" {
+			var ageKey, pgpKey []byte
+			if ageKeyFile != "" {
+				if ageKey, err = os.ReadFile(ageKeyFile); err != nil {
+					return fmt.Errorf("failed to read age key file %v: %v", ageKeyFile, err)
+				}
+			}
+			if pgpKeyFile != "" {
+				if pgpKey, err = os.ReadFile(pgpKeyFile); err != nil {
+					return fmt.Errorf("failed to read pgp key file %v: %v", pgpKeyFile, err)
+				}
+			}
+			keys, err = encrypt.NewKeys(ageKey, pgpKey, []byte(os.Getenv(encrypt.PGPPassphraseEnv)))
+		} else {
+			keys, err = encrypt.LoadKeysFromEnv()
+		}
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+		result, err := client.DecryptAuthFile(args[0], keys)
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(result)
+	},
+}
+
+// newRecipients creates the recipients of --age-recipient and --pgp-public-key.
+func newRecipients() (*encrypt.Recipients, error) {
+	var pgpPublicKeys [][]byte
+	for _, file := range pgpPublicKeyFiles {
+		key, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pgp public key %v: %v", file, err)
+		}
+		pgpPublicKeys = append(pgpPublicKeys, key)
+	}
+
+	return encrypt.NewRecipients(ageRecipients, pgpPublicKeys)
+}
+
+// writeOutput writes content to the file specified by --output, or stdout if it's empty.
+func writeOutput(content []byte) error {
+	if outputFile == "" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+
+	if err := os.WriteFile(outputFile, content, 0600); err != nil {
+		return fmt.Errorf("failed to write %v: %v", outputFile, err)
+	}
+	return nil
+}
+
+func init() {
+	AuthEncryptCmd.Flags().StringArrayVar(&ageRecipients, "age-recipient", []string{}, "age recipient (public key) to encrypt with, can be specified multiple times")
+	AuthEncryptCmd.Flags().StringArrayVar(&pgpPublicKeyFiles, "pgp-public-key", []string{}, "armored PGP public key file to encrypt with, can be specified multiple times")
+	AuthEncryptCmd.Flags().BoolVar(&encryptValuesOnly, "values", false, "only encrypt usernames and passwords, the other parts of auth file are kept in plaintext")
+	AuthEncryptCmd.Flags().StringVarP(&outputFile, "output", "o", "", "output file path (default in os.Stdout)")
+
+	AuthDecryptCmd.Flags().StringVar(&ageKeyFile, "age-key-file", "", "age identity file, overrides $"+encrypt.AgeKeyEnv+" and $"+encrypt.AgeKeyFileEnv)
+	AuthDecryptCmd.Flags().StringVar(&pgpKeyFile, "pgp-key-file", "", "armored PGP private key file, overrides $"+encrypt.PGPKeyEnv+" and $"+encrypt.PGPKeyFileEnv)
+	AuthDecryptCmd.Flags().StringVarP(&outputFile, "output", "o", "", "output file path (default in os.Stdout)")
+
+	AuthCmd.AddCommand(AuthEncryptCmd, AuthDecryptCmd)
+	RootCmd.AddCommand(AuthCmd)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/client"
+)
+
+var outputDir string
+
+// ConvertCmd describes "image-syncer convert" command
+var ConvertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert the images file of skopeo sync or regsync, or the deprecated config file, into images.yaml and auth.yaml",
+	Long: `Convert the images file specified by --images and --images-format (skopeo or regsync), or the deprecated
+	config file specified by --config, into images.yaml and auth.yaml under --output-dir. Existing files are not
+	overwritten, and auth.yaml is not written if there is no auth information.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+
+		images, auth, warnings, err := client.Convert(configFile, imagesFile)
+		if err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "[Warning] %v\n", warning)
+		}
+
+		imagesPath, authPath := filepath.Join(outputDir, "images.yaml"), filepath.Join(outputDir, "auth.yaml")
+		for _, path := range []string{imagesPath, authPath} {
+			if _, err = os.Stat(path); err == nil {
+				return fmt.Errorf("%v already exists, remove it or use another --output-dir", path)
+			}
+		}
+
+		if err = os.MkdirAll(outputDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory %v: %v", outputDir, err)
+		}
+		if err = os.WriteFile(imagesPath, images, 0644); err != nil {
+			return fmt.Errorf("failed to write %v: %v", imagesPath, err)
+		}
+		fmt.Printf("Images file is written to %v\n", imagesPath)
+
+		if auth != nil {
+			// auth information might have passwords
+			if err = os.WriteFile(authPath, auth, 0600); err != nil {
+				return fmt.Errorf("failed to write %v: %v", authPath, err)
+			}
+			fmt.Printf("Auth file is written to %v\n", authPath)
+		}
+		return nil
+	},
+}
+
+func init() {
+	ConvertCmd.Flags().StringVar(&outputDir, "output-dir", ".", "directory to write images.yaml and auth.yaml")
+
+	RootCmd.AddCommand(ConvertCmd)
+}
@@ -6,18 +6,30 @@ import (
 
 	"github.com/AliyunContainerService/image-syncer/pkg/client"
 	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	logPath, configFile, authFile, imagesFile, successImagesFile, outputImagesFormat string
+	logPath, configFile, authFile, imagesFile, successImagesFile, outputImagesFormat, registriesConf string
 
 	procNum, retries int
 
 	osFilterList, archFilterList []string
 
 	forceUpdate bool
+
+	lockfile string
+
+	remoteCAFile, remoteCacheDir string
+	trustRemoteAuth              bool
+
+	locked bool
+
+	imagesFormat, skopeoDestination string
+
+	skopeoScoped bool
 )
 
 // RootCmd describes "image-syncer" command
@@ -28,31 +40,56 @@ var RootCmd = &cobra.Command{
 	Long: `A Fast and Flexible docker registry image synchronization tool implement by Go. 
 	
 	Complete documentation is available at https://github.com/AliyunContainerService/image-syncer`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		client.SetRemoteOptions(remoteCAFile, remoteCacheDir)
+		client.SetTrustRemoteAuth(trustRemoteAuth)
+		client.SetImagesFormat(imagesFormat, types.SkopeoOptions{Destination: skopeoDestination, Scoped: skopeoScoped})
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceErrors = true
 
-		// work starts here
-		client, err := client.NewSyncClient(configFile, authFile, imagesFile, logPath, successImagesFile, outputImagesFormat,
-			procNum, retries, utils.RemoveEmptyItems(osFilterList), utils.RemoveEmptyItems(archFilterList), forceUpdate)
-		if err != nil {
-			return fmt.Errorf("init sync client error: %v", err)
+		lockMode := client.LockModeNone
+		if locked {
+			lockMode = client.LockModeLocked
 		}
 
-		cmd.SilenceUsage = true
-		return client.Run()
+		// work starts here
+		return runSyncClient(cmd, lockMode)
 	},
 }
 
+// runSyncClient creates a synchronization client with flags and runs it.
+func runSyncClient(cmd *cobra.Command, lockMode string) error {
+	client, err := client.NewSyncClient(configFile, authFile, imagesFile, logPath, successImagesFile, outputImagesFormat,
+		registriesConf, lockfile, lockMode, procNum, retries, utils.RemoveEmptyItems(osFilterList),
+		utils.RemoveEmptyItems(archFilterList), forceUpdate)
+	if err != nil {
+		return fmt.Errorf("init sync client error: %v", err)
+	}
+
+	cmd.SilenceUsage = true
+	return client.Run()
+}
+
 func init() {
 	RootCmd.PersistentFlags().StringVar(&configFile, "config", "", "config file path. This flag is deprecated and will be removed in the future. Please use --auth and --images instead.")
-	RootCmd.PersistentFlags().StringVar(&authFile, "auth", "", "auth file path. This flag need to be pair used with --images.")
-	RootCmd.PersistentFlags().StringVar(&imagesFile, "images", "", "images file path. This flag need to be pair used with --auth")
+	RootCmd.PersistentFlags().StringVar(&authFile, "auth", "", "auth file path, https url or \"-\" for stdin. This flag need to be pair used with --images.")
+	RootCmd.PersistentFlags().StringVar(&imagesFile, "images", "", "images file path, https url or \"-\" for stdin, or a directory or glob of images files which are merged. This flag need to be pair used with --auth")
+	RootCmd.PersistentFlags().StringVar(&imagesFormat, "images-format", client.ImagesFormatNative, "format of images file, \"native\", \"skopeo\" (yaml file of \"skopeo sync --src yaml\") or \"regsync\", files of other tools are converted at startup")
+	RootCmd.PersistentFlags().StringVar(&skopeoDestination, "skopeo-destination", "", "registry[/namespace] which the images of skopeo sync file are synchronized to, like the destination of \"skopeo sync\"")
+	RootCmd.PersistentFlags().BoolVar(&skopeoScoped, "skopeo-scoped", false, "keep the source registry and repository under --skopeo-destination like \"skopeo sync --scoped\", otherwise only the last component of repository is kept")
+	RootCmd.PersistentFlags().StringVar(&registriesConf, "registries-conf", "", "containers registries.conf (v2) file path, e.g., /etc/containers/registries.conf, to use its mirrors, blocked registries, insecure flags and short-name aliases")
+	RootCmd.PersistentFlags().StringVar(&remoteCAFile, "remote-ca-file", "", "PEM file of CA certificates to verify the servers of https auth and images files, which are trusted besides system ones")
+	RootCmd.PersistentFlags().StringVar(&remoteCacheDir, "remote-cache-dir", "", "directory to cache https auth and images files by ETag (default in the user cache directory)")
+	RootCmd.PersistentFlags().BoolVar(&trustRemoteAuth, "trust-remote-auth", false, "allow the auth information of https urls or stdin, and the credentials imported from images files of other tools, to refer to local files (file://) and commands (exec://)")
 	RootCmd.PersistentFlags().StringVar(&logPath, "log", "", "log file path (default in os.Stderr)")
 	RootCmd.PersistentFlags().IntVarP(&procNum, "proc", "p", 5, "numbers of working goroutines")
 	RootCmd.PersistentFlags().IntVarP(&retries, "retries", "r", 2, "times to retry failed task")
 	RootCmd.PersistentFlags().StringArrayVar(&osFilterList, "os", []string{}, "os list to filter source tags, not works for docker v2 schema1 and OCI media")
 	RootCmd.PersistentFlags().StringArrayVar(&archFilterList, "arch", []string{}, "architecture list to filter source tags, not works for OCI media")
 	RootCmd.PersistentFlags().BoolVar(&forceUpdate, "force", false, "force update manifest whether the destination manifest exists")
+	RootCmd.PersistentFlags().StringVar(&lockfile, "lockfile", "images.lock.yaml", "lockfile path, which is written by \"image-syncer lock\" and read with --locked")
+	RootCmd.Flags().BoolVar(&locked, "locked", false, "synchronize exactly the digests recorded in lockfile, even if tags have moved since locking")
 	RootCmd.PersistentFlags().StringVar(&successImagesFile, "output-success-images", "", "output success images in a new file")
 	RootCmd.PersistentFlags().StringVar(&outputImagesFormat, "output-images-format", "yaml", "success images output format, json or yaml")
 }
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/client"
+)
+
+// LockCmd describes "image-syncer lock" command
+var LockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Resolve the manifest digests of all source images and write them into the lockfile specified by --lockfile",
+	Long: `Resolve the manifest digests of all source images and write them into the lockfile specified by --lockfile,
+	nothing is synchronized. Run "image-syncer --locked" later to synchronize exactly these digests.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceErrors = true
+		return runSyncClient(cmd, client.LockModeWrite)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(LockCmd)
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/client"
+	"github.com/AliyunContainerService/image-syncer/pkg/sync"
+	authutils "github.com/AliyunContainerService/image-syncer/pkg/utils/auth"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/encrypt"
+)
+
+var (
+	loginUsername, loginPassword string
+
+	loginPasswordStdin, loginInsecure bool
+)
+
+// LoginCmd describes "image-syncer login" command
+var LoginCmd = &cobra.Command{
+	Use:   "login <registry[/namespace]>",
+	Short: "Verify credentials of a registry and save them into the auth file specified by --auth",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceErrors = true
+
+		key, err := authKey(args[0])
+		if err != nil {
+			return err
+		}
+
+		// settings of the auth information matching key are kept, e.g., base path and certificates
+		registry, auth, err := client.LoginAuth(authFile, key)
+		if err != nil {
+			return err
+		}
+
+		// new credentials are encrypted if recipients are provided
+		var recipients *encrypt.Recipients
+		if len(ageRecipients) != 0 || len(pgpPublicKeyFiles) != 0 {
+			if recipients, err = newRecipients(); err != nil {
+				return err
+			}
+		}
+
+		if cmd.Flags().Changed("password") {
+			fmt.Fprintln(os.Stderr, "WARNING! Using --password via the CLI is insecure, it might be seen in the "+
+				"process list and shell history. Use --password-stdin.")
+		}
+
+		reader := bufio.NewReader(os.Stdin)
+		username, password := loginUsername, loginPassword
+
+		if loginPasswordStdin {
+			if username == "" {
+				return fmt.Errorf("--username is required with --password-stdin")
+			}
+
+			content, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("failed to read password from stdin: %v", err)
+			}
+			password = strings.TrimRight(string(content), "\r\n")
+		}
+
+		if username == "" {
+			fmt.Print("Username: ")
+			line, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("failed to read username: %v", err)
+			}
+			username = strings.TrimSpace(line)
+		}
+
+		if password == "" {
+			fmt.Print("Password: ")
+			if term.IsTerminal(int(os.Stdin.Fd())) {
+				content, err := term.ReadPassword(int(os.Stdin.Fd()))
+				fmt.Println()
+				if err != nil {
+					return fmt.Errorf("failed to read password: %v", err)
+				}
+				password = string(content)
+			} else {
+				line, err := reader.ReadString('\n')
+				if err != nil && err != io.EOF {
+					return fmt.Errorf("failed to read password: %v", err)
+				}
+				password = strings.TrimRight(line, "\r\n")
+			}
+		}
+
+		if username == "" || password == "" {
+			return fmt.Errorf("username and password should not be empty")
+		}
+
+		cmd.SilenceUsage = true
+		auth.Insecure = auth.Insecure || loginInsecure
+		auth.Credential = authutils.NewCredentialProvider(key, username, password, nil)
+		defer sync.Cleanup()
+		if err := sync.CheckAuth(registry, auth); err != nil {
+			return fmt.Errorf("login to %v failed: %v", registry, err)
+		}
+
+		if err := client.SaveAuth(authFile, key, username, password, loginInsecure, recipients); err != nil {
+			return err
+		}
+
+		fmt.Printf("Login Succeeded, auth information of %v is saved in %v\n", key, authFile)
+		return nil
+	},
+}
+
+// LogoutCmd describes "image-syncer logout" command
+var LogoutCmd = &cobra.Command{
+	Use:   "logout <registry[/namespace]>",
+	Short: "Remove credentials of a registry from the auth file specified by --auth",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceErrors = true
+
+		key, err := authKey(args[0])
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+		if err := client.RemoveAuth(authFile, key); err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed auth information of %v from %v\n", key, authFile)
+		return nil
+	},
+}
+
+// authKey checks and normalizes a "registry" or "registry/namespace" string used as the key of auth file.
+func authKey(arg string) (string, error) {
+	key := strings.TrimSuffix(strings.TrimSpace(arg), "/")
+	if key == "" {
+		return "", fmt.Errorf("registry should not be empty")
+	}
+
+	if strings.Contains(key, "://") {
+		return "", fmt.Errorf("registry %v should not include scheme", arg)
+	}
+
+	return key, nil
+}
+
+func init() {
+	LoginCmd.Flags().StringVarP(&loginUsername, "username", "u", "", "username, will be prompted if empty")
+	LoginCmd.Flags().StringVar(&loginPassword, "password", "", "password, will be prompted if empty, insecure because it might be seen in the process list and shell history, use --password-stdin instead")
+	LoginCmd.Flags().BoolVar(&loginPasswordStdin, "password-stdin", false, "read password from stdin")
+	LoginCmd.Flags().BoolVar(&loginInsecure, "insecure", false, "registry is a http service or has an untrusted certificate")
+	LoginCmd.Flags().StringArrayVar(&ageRecipients, "age-recipient", []string{}, "age recipient (public key) to encrypt username and password with, can be specified multiple times, required if they are encrypted in auth file")
+	LoginCmd.Flags().StringArrayVar(&pgpPublicKeyFiles, "pgp-public-key", []string{}, "armored PGP public key file to encrypt username and password with, can be specified multiple times, required if they are encrypted in auth file")
+
+	RootCmd.AddCommand(LoginCmd, LogoutCmd)
+}
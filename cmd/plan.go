@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/client"
+)
+
+// PlanCmd describes "image-syncer plan" command
+var PlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Print the image sync rules after matrix rules are expanded, nothing is synchronized",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+
+		result, err := client.Plan(configFile, authFile, imagesFile, logPath)
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(result)
+	},
+}
+
+func init() {
+	PlanCmd.Flags().StringVarP(&outputFile, "output", "o", "", "output file path (default in os.Stdout)")
+
+	RootCmd.AddCommand(PlanCmd)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/client"
+)
+
+// ValidateCmd describes "image-syncer validate" command
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the auth file and images file without accessing registries, and report all the problems",
+	Long: `Check the auth file and images file, or the deprecated config file, without accessing registries. All the
+	problems are reported with file and line, and the command fails if any of them is an error.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+
+		problems, err := client.Validate(configFile, authFile, imagesFile)
+		if err != nil {
+			return err
+		}
+
+		var errors, warnings int
+		for _, problem := range problems {
+			fmt.Println(problem)
+			if problem.Warning {
+				warnings++
+			} else {
+				errors++
+			}
+		}
+
+		if errors != 0 {
+			return fmt.Errorf("%v errors and %v warnings found", errors, warnings)
+		}
+		fmt.Printf("Config files are valid, %v warnings found.\n", warnings)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(ValidateCmd)
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	gosync "sync"
 	"time"
 
 	"github.com/fatih/color"
@@ -12,6 +14,7 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/AliyunContainerService/image-syncer/pkg/concurrent"
+	"github.com/AliyunContainerService/image-syncer/pkg/sync"
 	"github.com/AliyunContainerService/image-syncer/pkg/task"
 	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
 )
@@ -34,20 +37,49 @@ type Client struct {
 	retries    int
 	logger     *logrus.Logger
 
+	// taskRetries records the retries of tasks generated by rules which have their own retries setting
+	taskRetries     map[task.Task]int
+	taskRetriesLock gosync.Mutex
+
+	// taskRules records the index of rule which generates each RuleTask, so that the expanded URLTasks can be
+	// planned in the order of rules
+	taskRules     map[task.Task]int
+	taskRulesLock gosync.Mutex
+
+	// plannedTasks collects the URLTasks expanded from rules, which are synchronized after being planned
+	plannedTasks *concurrent.List
+
+	// lock is nil if lockfile is not used
+	lock         *task.Lock
+	lockfilePath string
+
 	forceUpdate bool
 }
 
+// plannedTask is an url task expanded from the rule of index
+type plannedTask struct {
+	rule int
+	task task.Task
+}
+
 // NewSyncClient creates a synchronization client
-func NewSyncClient(configFile, authFile, imagesFile, logFile, successImagesFile, outputImagesFormat string,
-	routineNum, retries int, osFilterList, archFilterList []string, forceUpdate bool) (*Client, error) {
+func NewSyncClient(configFile, authFile, imagesFile, logFile, successImagesFile, outputImagesFormat,
+	registriesConfPath, lockfilePath, lockMode string, routineNum, retries int, osFilterList,
+	archFilterList []string, forceUpdate bool) (*Client, error) {
 
 	logger := NewFileLogger(logFile)
 
-	config, err := NewSyncConfig(configFile, authFile, imagesFile, osFilterList, archFilterList, logger)
+	config, err := NewSyncConfig(configFile, authFile, imagesFile, registriesConfPath, osFilterList, archFilterList,
+		logger)
 	if err != nil {
 		return nil, fmt.Errorf("generate config error: %v", err)
 	}
 
+	lock, err := newLock(lockfilePath, lockMode)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Client{
 		taskList:       concurrent.NewList(),
 		failedTaskList: concurrent.NewList(),
@@ -64,6 +96,14 @@ func NewSyncClient(configFile, authFile, imagesFile, logFile, successImagesFile,
 		retries:    retries,
 		logger:     logger,
 
+		taskRetries: map[task.Task]int{},
+
+		taskRules:    map[task.Task]int{},
+		plannedTasks: concurrent.NewList(),
+
+		lock:         lock,
+		lockfilePath: lockfilePath,
+
 		forceUpdate: forceUpdate,
 	}, nil
 }
@@ -71,28 +111,65 @@ func NewSyncClient(configFile, authFile, imagesFile, logFile, successImagesFile,
 // Run is main function of a synchronization client
 func (c *Client) Run() error {
 	start := time.Now()
+	// stop gateways and remove temporary certificates of registries
+	defer sync.Cleanup()
 
-	imageList, err := types.NewImageList(c.config.ImageList)
+	imageList, err := types.NewImageList(c.config.ImageList, c.config.urlParser)
 	if err != nil {
 		return fmt.Errorf("failed to get image list: %v", err)
 	}
 
-	for source, destList := range imageList {
-		for _, dest := range destList {
+	for index, rule := range imageList {
+		source := rule.Source
+
+		// platforms of rule take the place of global os and arch filters
+		osFilterList, archFilterList := c.config.osFilterList, c.config.archFilterList
+		if len(rule.Platforms) != 0 {
+			osFilterList, archFilterList = nil, nil
+		}
+
+		forceUpdate := c.forceUpdate
+		if rule.Force != nil {
+			forceUpdate = *rule.Force
+		}
+
+		options := task.RuleTaskOptions{
+			URLTaskOptions: task.URLTaskOptions{
+				OSFilterList:       osFilterList,
+				ArchFilterList:     archFilterList,
+				PlatformFilterList: rule.Platforms,
+				MetadataFilter:     rule.Metadata,
+				DigestDrift:        rule.DigestDrift,
+				Lock:               c.lock,
+				ForceUpdate:        forceUpdate,
+			},
+			FailoverSources:   rule.FailoverSources,
+			TagFilter:         rule.Tags,
+			TagTemplate:       rule.TagTemplate,
+			RepositoryMapping: rule.RepositoryMapping,
+			Registries:        c.config.registries,
+			URLParser:         c.config.urlParser,
+			GetAuthFunc: func(repository string) types.Auth {
+				auth, exist := c.config.GetAuth(repository)
+				if !exist {
+					c.logger.Infof("Auth information not found for %v, access will be anonymous.", repository)
+				}
+				return auth
+			},
+		}
+
+		for _, dest := range rule.Destinations {
 			// TODO: support multiple destinations for one task
-			ruleTask, err := task.NewRuleTask(source, dest,
-				c.config.osFilterList, c.config.archFilterList,
-				func(repository string) types.Auth {
-					auth, exist := c.config.GetAuth(repository)
-					if !exist {
-						c.logger.Infof("Auth information not found for %v, access will be anonymous.", repository)
-					}
-					return auth
-				}, c.forceUpdate)
+			ruleTask, err := task.NewRuleTask(source, dest, options)
 			if err != nil {
 				return fmt.Errorf("failed to generate rule task for %s -> %s: %v", source, dest, err)
 			}
 
+			if rule.Retries != nil {
+				c.taskRetries[ruleTask] = *rule.Retries
+			}
+			c.taskRules[ruleTask] = index
+
 			c.taskList.PushBack(ruleTask)
 			c.taskCounter.IncreaseTotal()
 		}
@@ -121,7 +198,10 @@ func (c *Client) Run() error {
 				c.successImagesList.Add(tTask.GetSource().String(), tTask.GetDestination().String())
 			}
 
-			if len(message) != 0 {
+			if task.IsWarning(message) {
+				c.logger.Warnf("Finish %v with %v. Now %v/%v tasks have been processed.", tTask.String(), message,
+					finishedNumString, totalNumString)
+			} else if len(message) != 0 {
 				c.logger.Infof("Finish %v: %v. Now %v/%v tasks have been processed.", tTask.String(), message,
 					finishedNumString, totalNumString)
 			} else {
@@ -131,31 +211,56 @@ func (c *Client) Run() error {
 		}
 
 		for _, t := range nextTasks {
+			c.inheritRetries(tTask, t)
+
+			if tTask.Type() == task.RuleType {
+				rule := c.inheritRule(tTask, t)
+				if t.Type() == task.URLType {
+					// url tasks are not run until all the rules are expanded and planned
+					c.plannedTasks.PushBack(plannedTask{rule: rule, task: t})
+					continue
+				}
+			}
+
 			c.taskList.PushFront(t)
 			c.taskCounter.IncreaseTotal()
 		}
+
+		// failed tasks keep their settings to be retried
+		if err == nil {
+			c.forgetTask(tTask)
+		}
 	})
 	defer routinePool.Release()
 
-	if err = c.handleTasks(routinePool); err != nil {
-		c.logger.Errorf("Failed to handle tasks: %v", err)
+	// rules are expanded into url tasks first
+	c.runTasks(routinePool)
+
+	tasks, dropped, err := task.Plan(c.sortPlannedTasks())
+	if err != nil {
+		return fmt.Errorf("failed to plan image rules: %v", err)
 	}
+	c.logger.Infof("Planning finished, %v url tasks are planned, %v duplicated ones are dropped.",
+		len(tasks), dropped)
 
-	for times := 0; times < c.retries; times++ {
-		c.taskCounter, c.failedTaskCounter = c.failedTaskCounter, concurrent.NewCounter(0, 0)
+	// failed rule tasks will not be retried during synchronization
+	failedRuleTasks := c.failedTaskList
+	c.failedTaskList = concurrent.NewList()
+	c.taskCounter, c.failedTaskCounter = concurrent.NewCounter(0, 0), concurrent.NewCounter(0, 0)
 
-		if c.failedTaskList.Len() != 0 {
-			c.taskList.PushBackList(c.failedTaskList)
-			c.failedTaskList.Reset()
-		}
+	for _, t := range tasks {
+		c.taskList.PushBack(t)
+		c.taskCounter.IncreaseTotal()
+	}
+	c.runTasks(routinePool)
 
-		if c.taskList.Len() != 0 {
-			// retry to handle task
-			c.logger.Infof("Start to retry tasks, please wait ...")
-			if err = c.handleTasks(routinePool); err != nil {
-				c.logger.Errorf("Failed to handle tasks: %v", err)
-			}
-		}
+	for item := failedRuleTasks.PopFront(); item != nil; item = failedRuleTasks.PopFront() {
+		c.failedTaskList.PushBack(item)
+		c.failedTaskCounter.IncreaseTotal()
+	}
+
+	if c.lock != nil && !c.lock.Locked {
+		return c.finishLocking(start)
 	}
 
 	endMsg := fmt.Sprintf("Synchronization finished, %v tasks failed, cost %v.",
@@ -188,6 +293,136 @@ func (c *Client) Run() error {
 	return nil
 }
 
+// runTasks handles the tasks in task list, and then retries the failed ones.
+func (c *Client) runTasks(routinePool *ants.PoolWithFunc) {
+	if err := c.handleTasks(routinePool); err != nil {
+		c.logger.Errorf("Failed to handle tasks: %v", err)
+	}
+
+	for times := 0; times < c.maxRetries(); times++ {
+		c.taskCounter, c.failedTaskCounter = concurrent.NewCounter(0, 0), concurrent.NewCounter(0, 0)
+
+		// failed tasks which run out of retries stay failed
+		failedTaskList := c.failedTaskList
+		c.failedTaskList = concurrent.NewList()
+		for item := failedTaskList.PopFront(); item != nil; item = failedTaskList.PopFront() {
+			if times < c.getRetries(item.(task.Task)) {
+				c.taskList.PushBack(item)
+				c.taskCounter.IncreaseTotal()
+			} else {
+				c.failedTaskList.PushBack(item)
+				c.failedTaskCounter.IncreaseTotal()
+			}
+		}
+
+		if c.taskList.Len() != 0 {
+			// retry to handle task
+			c.logger.Infof("Start to retry tasks, please wait ...")
+			if err := c.handleTasks(routinePool); err != nil {
+				c.logger.Errorf("Failed to handle tasks: %v", err)
+			}
+		}
+	}
+}
+
+// finishLocking writes lockfile if all the digests are resolved, a partial lockfile is never written.
+func (c *Client) finishLocking(start time.Time) error {
+	endMsg := fmt.Sprintf("Locking finished, %v tasks failed, cost %v.",
+		c.failedTaskList.Len(), time.Since(start).String())
+	c.logger.Infof(color.New(color.FgGreen).Sprintf(endMsg))
+
+	if _, failedTaskCountTotal := c.failedTaskCounter.Value(); failedTaskCountTotal != 0 {
+		return fmt.Errorf("failed tasks exist, lockfile %v is not written", c.lockfilePath)
+	}
+
+	if err := writeLockfile(c.lockfilePath, c.lock); err != nil {
+		return err
+	}
+	c.logger.Infof("%v images are locked in %v", len(c.lock.Lockfile.Content().Images), c.lockfilePath)
+	return nil
+}
+
+// getRetries returns the times to retry a failed task.
+func (c *Client) getRetries(t task.Task) int {
+	c.taskRetriesLock.Lock()
+	defer c.taskRetriesLock.Unlock()
+
+	if retries, exist := c.taskRetries[t]; exist {
+		return retries
+	}
+	return c.retries
+}
+
+// maxRetries returns the max times to retry failed tasks of all rules.
+func (c *Client) maxRetries() int {
+	c.taskRetriesLock.Lock()
+	defer c.taskRetriesLock.Unlock()
+
+	result := c.retries
+	for _, retries := range c.taskRetries {
+		if retries > result {
+			result = retries
+		}
+	}
+	return result
+}
+
+// inheritRule records that child is generated by the same rule of parent, and returns the index of the rule.
+func (c *Client) inheritRule(parent, child task.Task) int {
+	c.taskRulesLock.Lock()
+	defer c.taskRulesLock.Unlock()
+
+	rule := c.taskRules[parent]
+	// url tasks don't generate rule tasks, the index of their rule is kept by planned tasks
+	if child.Type() == task.RuleType {
+		c.taskRules[child] = rule
+	}
+	return rule
+}
+
+// forgetTask removes the retries and rule settings of a finished task, which have been inherited by the tasks it
+// generates.
+func (c *Client) forgetTask(t task.Task) {
+	c.taskRetriesLock.Lock()
+	delete(c.taskRetries, t)
+	c.taskRetriesLock.Unlock()
+
+	c.taskRulesLock.Lock()
+	delete(c.taskRules, t)
+	c.taskRulesLock.Unlock()
+}
+
+// sortPlannedTasks returns the planned url tasks in the order of rules, and then source and destination urls.
+func (c *Client) sortPlannedTasks() []task.Task {
+	var plannedTasks []plannedTask
+	for item := c.plannedTasks.PopFront(); item != nil; item = c.plannedTasks.PopFront() {
+		plannedTasks = append(plannedTasks, item.(plannedTask))
+	}
+
+	sort.SliceStable(plannedTasks, func(i, j int) bool {
+		if plannedTasks[i].rule != plannedTasks[j].rule {
+			return plannedTasks[i].rule < plannedTasks[j].rule
+		}
+		return plannedTasks[i].task.String() < plannedTasks[j].task.String()
+	})
+
+	var result []task.Task
+	for _, item := range plannedTasks {
+		result = append(result, item.task)
+	}
+	return result
+}
+
+// inheritRetries makes the tasks generated by parent have the same retries setting of it.
+func (c *Client) inheritRetries(parent, child task.Task) {
+	c.taskRetriesLock.Lock()
+	defer c.taskRetriesLock.Unlock()
+
+	if retries, exist := c.taskRetries[parent]; exist {
+		c.taskRetries[child] = retries
+	}
+}
+
 func (c *Client) handleTasks(routinePool *ants.PoolWithFunc) error {
 	for {
 		item := c.taskList.PopFront()
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/task"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+func TestForgetTask(t *testing.T) {
+	c := &Client{retries: 2, taskRetries: map[task.Task]int{}, taskRules: map[task.Task]int{}}
+
+	ruleTask, err := task.NewRuleTask("docker.io/library/*", "registry.example.com/library/*",
+		task.RuleTaskOptions{})
+	assert.NoError(t, err)
+	c.taskRetries[ruleTask] = 5
+	c.taskRules[ruleTask] = 3
+
+	childRule, err := task.NewRuleTask("docker.io/library/nginx", "registry.example.com/library/nginx",
+		task.RuleTaskOptions{})
+	assert.NoError(t, err)
+	urlTask := task.NewURLTask(nil, nil, nil, types.Auth{}, task.URLTaskOptions{})
+
+	for _, child := range []task.Task{childRule, urlTask} {
+		c.inheritRetries(ruleTask, child)
+		assert.Equal(t, 3, c.inheritRule(ruleTask, child))
+	}
+	c.forgetTask(ruleTask)
+
+	// settings are kept by the generated tasks, and the index of rule is only recorded for rule tasks
+	assert.Equal(t, map[task.Task]int{childRule: 5, urlTask: 5}, c.taskRetries)
+	assert.Equal(t, map[task.Task]int{childRule: 3}, c.taskRules)
+	assert.Equal(t, 5, c.getRetries(urlTask))
+
+	c.forgetTask(childRule)
+	c.forgetTask(urlTask)
+	assert.Empty(t, c.taskRetries)
+	assert.Empty(t, c.taskRules)
+	assert.Equal(t, 2, c.getRetries(urlTask))
+}
@@ -1,8 +1,10 @@
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -10,11 +12,30 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/AliyunContainerService/image-syncer/pkg/sync"
 	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	authutils "github.com/AliyunContainerService/image-syncer/pkg/utils/auth"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/encrypt"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/secret"
 
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	formatYAML = "yaml"
+	formatJSON = "json"
+)
+
+// trustRemoteAuth allows the auth information read from https urls or stdin, and the credentials imported from
+// images files of other tools, to refer to local files and commands
+var trustRemoteAuth bool
+
+// SetTrustRemoteAuth sets whether the auth information which doesn't come from local files can refer to local files
+// and commands.
+func SetTrustRemoteAuth(trust bool) {
+	trustRemoteAuth = trust
+}
+
 // Config information of sync client
 type Config struct {
 	// the authentication information of each registry
@@ -27,37 +48,113 @@ type Config struct {
 	osFilterList []string
 	// only images with selected architecture can be sync
 	archFilterList []string
+
+	// containers registries.conf, nil if it's not provided
+	registries *sync.RegistriesConf
+
+	// urlParser knows the registries served under a path prefix, which are defined by base path of auth information
+	urlParser *utils.URLParser
 }
 
 // NewSyncConfig creates a Config struct
-func NewSyncConfig(configFile, authFilePath, imageFilePath string,
+func NewSyncConfig(configFile, authFilePath, imageFilePath, registriesConfPath string,
 	osFilterList, archFilterList []string, logger *logrus.Logger) (*Config, error) {
 	if len(configFile) == 0 && len(imageFilePath) == 0 {
 		return nil, fmt.Errorf("neither config.json nor images.json is provided")
 	}
 
-	if len(configFile) == 0 && len(authFilePath) == 0 {
+	if authFilePath == stdinPath && imageFilePath == stdinPath {
+		return nil, fmt.Errorf("auth file and images file cannot be both read from stdin")
+	}
+
+	// images files of other tools might have credentials
+	if len(configFile) == 0 && len(authFilePath) == 0 && imagesFormat == ImagesFormatNative {
 		logger.Warnf("[Warning] No authentication information found because neither " +
 			"config.json nor auth.json provided, image-syncer may not work fine.")
 	}
 
 	var config Config
 
+	authSource := authFilePath
 	if len(configFile) != 0 {
+		authSource = configFile
 		if err := openAndDecode(configFile, &config); err != nil {
 			return nil, fmt.Errorf("decode config file %v failed, error %v", configFile, err)
 		}
-	} else {
-		if len(authFilePath) != 0 {
-			if err := openAndDecode(authFilePath, &config.AuthList); err != nil {
-				return nil, fmt.Errorf("decode auth file %v error: %v", authFilePath, err)
+	} else if len(authFilePath) != 0 {
+		if err := openAndDecode(authFilePath, &config.AuthList); err != nil {
+			return nil, fmt.Errorf("decode auth file %v error: %v", authFilePath, err)
+		}
+	}
+
+	// auth information which doesn't come from local files might be controlled by others
+	untrusted := map[string]bool{}
+	if !isLocalSource(authSource) {
+		for key := range config.AuthList {
+			untrusted[key] = true
+		}
+	}
+
+	// urls of rules are parsed with the registries served under a path prefix
+	urlParser, err := newURLParser(config.AuthList)
+	if err != nil {
+		return nil, err
+	}
+	config.urlParser = urlParser
+
+	if len(configFile) == 0 {
+		if imagesFormat != ImagesFormatNative {
+			imported, err := importImages(imageFilePath, urlParser)
+			if err != nil {
+				return nil, fmt.Errorf("decode image file %v error: %v", imageFilePath, err)
+			}
+			for _, warning := range imported.Warnings {
+				logger.Warnf("[Warning] %v", warning)
+			}
+
+			// auth file takes precedence over the credentials in images file
+			if config.AuthList == nil {
+				config.AuthList = map[string]types.Auth{}
+			}
+			for key, auth := range imported.Auth {
+				if _, exist := config.AuthList[key]; !exist {
+					config.AuthList[key] = auth
+					untrusted[key] = true
+				}
 			}
+			config.ImageList = imported.Images
+		} else {
+			imageList, err := openAndDecodeImages(imageFilePath, urlParser)
+			if err != nil {
+				return nil, fmt.Errorf("decode image file %v error: %v", imageFilePath, err)
+			}
+			config.ImageList = imageList
 		}
+
 		config.AuthList = expandEnv(config.AuthList)
+	}
 
-		if err := openAndDecode(imageFilePath, &config.ImageList); err != nil {
-			return nil, fmt.Errorf("decode image file %v error: %v", imageFilePath, err)
+	// credentials are shared by all the tasks, so that tokens and secrets can be cached and refreshed in one place
+	resolver := secret.NewResolver()
+	for key, auth := range config.AuthList {
+		if err := sync.CheckAuthSettings(auth); err != nil {
+			return nil, fmt.Errorf("invalid auth information of %v: %v", key, err)
 		}
+		if untrusted[key] {
+			if err := checkSecretReferences(auth); err != nil {
+				return nil, fmt.Errorf("invalid auth information of %v: %v", key, err)
+			}
+		}
+		auth.Credential = authutils.NewCredentialProvider(key, auth.Username, auth.Password, resolver)
+		config.AuthList[key] = auth
+	}
+
+	if len(registriesConfPath) != 0 {
+		registries, err := sync.LoadRegistriesConf(registriesConfPath)
+		if err != nil {
+			return nil, err
+		}
+		config.registries = registries
 	}
 
 	config.osFilterList = osFilterList
@@ -66,31 +163,142 @@ func NewSyncConfig(configFile, authFilePath, imageFilePath string,
 	return &config, nil
 }
 
-// Open json file and decode into target interface
+// isLocalSource returns true if path is a local file rather than a https url or stdin.
+func isLocalSource(path string) bool {
+	return path != stdinPath && !isRemote(path)
+}
+
+// checkSecretReferences checks the username and password of auth information which doesn't come from local files,
+// they cannot refer to local files or commands unless it's trusted explicitly, otherwise whoever controls the https
+// url or stdin could read the files or run commands on this host.
+func checkSecretReferences(auth types.Auth) error {
+	if trustRemoteAuth {
+		return nil
+	}
+
+	if secret.IsLocalReference(auth.Username) {
+		return fmt.Errorf("username refers to a local file or command, which is only allowed in local auth files " +
+			"unless --trust-remote-auth is set")
+	}
+	if secret.IsLocalReference(auth.Password) {
+		return fmt.Errorf("password refers to a local file or command, which is only allowed in local auth files " +
+			"unless --trust-remote-auth is set")
+	}
+	return nil
+}
+
+// Open json file and decode into target interface, whole files encrypted by age or PGP are decrypted transparently.
+// The file can also be a https url or "-" which means stdin.
 func openAndDecode(filePath string, target interface{}) error {
-	if !strings.HasSuffix(filePath, ".yaml") &&
-		!strings.HasSuffix(filePath, ".yml") &&
-		!strings.HasSuffix(filePath, ".json") {
-		return fmt.Errorf("only one of yaml/yml/json format is supported")
+	content, format, err := readSource(filePath, remoteHost(filePath))
+	if err != nil {
+		return err
+	}
+
+	return decode(content, format, target)
+}
+
+// readSource reads a local file, a https url or stdin ("-"), and returns its content and format. The format of a
+// https url is detected from Content-Type header before its suffix, and the format of stdin is detected from content.
+// Credentials of environment variables are only sent to https urls on credentialHost.
+func readSource(path, credentialHost string) ([]byte, string, error) {
+	if path == stdinPath {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read stdin: %v", err)
+		}
+
+		if content, err = decryptContent(content, "stdin"); err != nil {
+			return nil, "", err
+		}
+		return content, contentFormat(content), nil
+	}
+
+	if isRemote(path) {
+		content, format, err := fetchRemote(path, credentialHost)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if content, err = decryptContent(content, redactURL(path)); err != nil {
+			return nil, "", err
+		}
+		return content, format, nil
 	}
 
+	format, err := fileFormat(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	content, err := readFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, format, nil
+}
+
+// readFile reads a file, and decrypts it if it is encrypted by age or PGP.
+func readFile(filePath string) ([]byte, error) {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("file %v not exist: %v", filePath, err)
+		return nil, fmt.Errorf("file %v not exist: %v", filePath, err)
 	}
 
-	file, err := os.OpenFile(filePath, os.O_RDONLY, 0666)
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("open file %v error: %v", filePath, err)
+		return nil, fmt.Errorf("open file %v error: %v", filePath, err)
+	}
+
+	return decryptContent(content, filePath)
+}
+
+// decryptContent decrypts content of name if it is encrypted by age or PGP.
+func decryptContent(content []byte, name string) ([]byte, error) {
+	if encrypt.IsEncrypted(content) {
+		keys, err := encrypt.LoadKeysFromEnv()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load keys to decrypt %v: %v", name, err)
+		}
+
+		if content, err = keys.Decrypt(content); err != nil {
+			return nil, fmt.Errorf("failed to decrypt %v: %v", name, err)
+		}
+	}
+
+	return content, nil
+}
+
+// contentFormat detects the format of content, json is used if it's an object, and yaml otherwise.
+func contentFormat(content []byte) string {
+	if strings.HasPrefix(strings.TrimSpace(string(content)), "{") {
+		return formatJSON
+	}
+	return formatYAML
+}
+
+// fileFormat returns "yaml" or "json" according to the suffix of file path, suffixes of encrypted files
+// (e.g., "auth.yaml.age") are ignored.
+func fileFormat(filePath string) (string, error) {
+	for _, suffix := range []string{".age", ".asc", ".gpg", ".pgp"} {
+		filePath = strings.TrimSuffix(filePath, suffix)
 	}
 
 	if strings.HasSuffix(filePath, ".yaml") || strings.HasSuffix(filePath, ".yml") {
-		decoder := yaml.NewDecoder(file)
-		if err := decoder.Decode(target); err != nil {
+		return formatYAML, nil
+	} else if strings.HasSuffix(filePath, ".json") {
+		return formatJSON, nil
+	}
+
+	return "", fmt.Errorf("only one of yaml/yml/json format is supported")
+}
+
+func decode(content []byte, format string, target interface{}) error {
+	if format == formatYAML {
+		if err := yaml.Unmarshal(content, target); err != nil {
 			return fmt.Errorf("unmarshal config error: %v", err)
 		}
 	} else {
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(target); err != nil {
+		if err := json.Unmarshal(content, target); err != nil {
 			return fmt.Errorf("unmarshal config error: %v", err)
 		}
 	}
@@ -98,34 +306,208 @@ func openAndDecode(filePath string, target interface{}) error {
 	return nil
 }
 
+// unmarshalTree decodes a yaml or json file into a generic tree, the order of keys is kept by yaml.MapSlice in both
+// formats.
+func unmarshalTree(content []byte, format string) (interface{}, error) {
+	if format == formatYAML {
+		var tree yaml.MapSlice
+		if err := yaml.Unmarshal(content, &tree); err != nil {
+			return nil, fmt.Errorf("unmarshal config error: %v", err)
+		}
+		return tree, nil
+	}
+
+	if len(strings.TrimSpace(string(content))) == 0 {
+		return yaml.MapSlice{}, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	tree, err := decodeJSONNode(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal config error: %v", err)
+	}
+	if _, ok := tree.(yaml.MapSlice); !ok {
+		return nil, fmt.Errorf("unmarshal config error: json object is expected")
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unmarshal config error: unexpected content after json object")
+	}
+	return tree, nil
+}
+
+// decodeJSONNode decodes the next json value, objects are decoded into yaml.MapSlice to keep the order of keys.
+func decodeJSONNode(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		result := yaml.MapSlice{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, yaml.MapItem{Key: key, Value: value})
+		}
+		// the closing delimiter
+		_, err = decoder.Token()
+		return result, err
+	case json.Delim('['):
+		result := []interface{}{}
+		for decoder.More() {
+			value, err := decodeJSONNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		}
+		_, err = decoder.Token()
+		return result, err
+	}
+
+	return token, nil
+}
+
+// marshalTree encodes a tree decoded by unmarshalTree.
+func marshalTree(tree interface{}, format string) ([]byte, error) {
+	if format == formatYAML {
+		return yaml.Marshal(tree)
+	}
+
+	output, err := json.MarshalIndent(jsonNode(tree), "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(output, '\n'), nil
+}
+
+// jsonMapSlice encodes yaml.MapSlice as a json object whose keys are in order.
+type jsonMapSlice yaml.MapSlice
+
+// MarshalJSON implements json.Marshaler.
+func (m jsonMapSlice) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for index, item := range m {
+		if index != 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(fmt.Sprint(item.Key))
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(jsonNode(item.Value))
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonNode converts the yaml.MapSlice in a tree into jsonMapSlice, so that the order of keys is kept in json.
+func jsonNode(node interface{}) interface{} {
+	switch value := node.(type) {
+	case yaml.MapSlice:
+		return jsonMapSlice(value)
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range value {
+			result[key] = jsonNode(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for index, item := range value {
+			result[index] = jsonNode(item)
+		}
+		return result
+	}
+	return node
+}
+
 // GetAuth gets the authentication information in Config
 func (c *Config) GetAuth(repository string) (types.Auth, bool) {
-	auth := types.Auth{}
-	prefixLen := 0
+	key, exist := c.authKey(repository)
+	if !exist {
+		return types.Auth{}, false
+	}
+	return c.AuthList[key], true
+}
+
+// authKey returns the longest key of authentication information which matches repository.
+func (c *Config) authKey(repository string) (string, bool) {
+	result := ""
 	exist := false
 
-	for key, value := range c.AuthList {
+	for key := range c.AuthList {
 		if matched := utils.RepoMathPrefix(repository, key); matched {
-			if len(key) > prefixLen {
-				auth = value
+			if len(key) > len(result) {
+				result = key
 				exist = true
 			}
 		}
 	}
 
-	return auth, exist
+	return result, exist
 }
 
+// newURLParser creates a url parser which knows the registries served under the base path of auth information.
+func newURLParser(authList map[string]types.Auth) (*utils.URLParser, error) {
+	var prefixes []string
+	for key, auth := range authList {
+		if auth.BasePath == "" {
+			continue
+		}
+
+		prefix, err := registryPrefix(key, auth.BasePath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth information of %v: %v", key, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return utils.NewURLParser(prefixes), nil
+}
+
+// registryPrefix returns the registry served under base path, key of auth information should be its host or a
+// repository (namespace) under it.
+func registryPrefix(key, basePath string) (string, error) {
+	host, keyPath := utils.SplitRegistryHost(key)
+	prefix, err := utils.RegistryPrefix(host, basePath)
+	if err != nil {
+		return "", err
+	}
+
+	if keyPath != "" && key != prefix && !strings.HasPrefix(key, prefix+"/") {
+		return "", fmt.Errorf("%v is not under base path %v", key, basePath)
+	}
+	return prefix, nil
+}
+
+// expandEnv expands environment variables in username and password, secret references are left unchanged
+// because they will be resolved lazily.
 func expandEnv(authMap map[string]types.Auth) map[string]types.Auth {
 	result := make(map[string]types.Auth)
 
 	for registry, auth := range authMap {
-		pwd := os.ExpandEnv(auth.Password)
-		name := os.ExpandEnv(auth.Username)
-		newAuth := types.Auth{
-			Username: name,
-			Password: pwd,
-			Insecure: auth.Insecure,
+		newAuth := auth
+		if !secret.IsReference(auth.Username) {
+			newAuth.Username = os.ExpandEnv(auth.Username)
+		}
+		if !secret.IsReference(auth.Password) {
+			newAuth.Password = os.ExpandEnv(auth.Password)
 		}
 		result[registry] = newAuth
 	}
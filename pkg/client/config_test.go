@@ -0,0 +1,67 @@
+package client
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+func TestGetAuthLongestKey(t *testing.T) {
+	config := &Config{AuthList: map[string]types.Auth{
+		"registry.example.com":    {Username: "registry"},
+		"registry.example.com/ns": {Username: "namespace"},
+	}}
+
+	// keys are matched in the random order of map
+	for i := 0; i < 20; i++ {
+		auth, exist := config.GetAuth("registry.example.com/ns/app")
+		assert.True(t, exist)
+		assert.Equal(t, "namespace", auth.Username)
+
+		auth, exist = config.GetAuth("registry.example.com/nsx/app")
+		assert.True(t, exist)
+		assert.Equal(t, "registry", auth.Username)
+
+		auth, exist = config.GetAuth("registry.example.com/other/app")
+		assert.True(t, exist)
+		assert.Equal(t, "registry", auth.Username)
+	}
+
+	_, exist := config.GetAuth("other.example.com/app")
+	assert.False(t, exist)
+}
+
+func TestNewSyncConfigSecretReferences(t *testing.T) {
+	auth := `registry.example.com:
+  username: user
+  password: exec://cat /etc/passwd
+`
+	server, _ := newRemoteServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(auth))
+	}))
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"auth.yaml":   auth,
+		"images.yaml": "docker.io/library/nginx:1.25: registry.example.com/library/nginx\n",
+	})
+	imagesFile := filepath.Join(dir, "images.yaml")
+
+	// local auth files are trusted
+	_, err := NewSyncConfig("", filepath.Join(dir, "auth.yaml"), imagesFile, "", nil, nil, logrus.New())
+	assert.NoError(t, err)
+
+	_, err = NewSyncConfig("", server.URL+"/auth.yaml", imagesFile, "", nil, nil, logrus.New())
+	assert.EqualError(t, err, "invalid auth information of registry.example.com: password refers to a local file "+
+		"or command, which is only allowed in local auth files unless --trust-remote-auth is set")
+
+	SetTrustRemoteAuth(true)
+	defer SetTrustRemoteAuth(false)
+	_, err = NewSyncConfig("", server.URL+"/auth.yaml", imagesFile, "", nil, nil, logrus.New())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+const (
+	// ImagesFormatNative is the images file format of image-syncer
+	ImagesFormatNative = "native"
+	// ImagesFormatSkopeo is the yaml file format of "skopeo sync --src yaml"
+	ImagesFormatSkopeo = "skopeo"
+	// ImagesFormatRegsync is the config file format of regsync
+	ImagesFormatRegsync = "regsync"
+)
+
+var (
+	// imagesFormat is the format of images file, the files of other tools are converted into rules and auth
+	// information at startup
+	imagesFormat = ImagesFormatNative
+	// skopeoOptions are the options of "skopeo sync" which are not in its yaml file
+	skopeoOptions types.SkopeoOptions
+)
+
+// SetImagesFormat sets the format of images file, and the options to convert the yaml file of "skopeo sync".
+func SetImagesFormat(format string, options types.SkopeoOptions) {
+	imagesFormat, skopeoOptions = format, options
+}
+
+// importImages reads the images file of another tool, which can be a file, a https url or "-" (stdin), and converts
+// it into validated rules and auth information. Urls of rules are parsed by parser.
+func importImages(path string, parser *utils.URLParser) (*types.ImportedConfig, error) {
+	content, format, err := readSource(path, remoteHost(path))
+	if err != nil {
+		return nil, err
+	}
+
+	tree := map[string]interface{}{}
+	if err = decode(content, format, &tree); err != nil {
+		return nil, err
+	}
+
+	var result *types.ImportedConfig
+	switch imagesFormat {
+	case ImagesFormatSkopeo:
+		if skopeoOptions.Destination == "" {
+			return nil, fmt.Errorf("destination of skopeo sync file should be provided by --skopeo-destination")
+		}
+		result, err = types.ImportSkopeo(tree, skopeoOptions)
+	case ImagesFormatRegsync:
+		result, err = types.ImportRegsync(tree)
+	default:
+		return nil, fmt.Errorf("unknown images format %v, should be %v, %v or %v", imagesFormat,
+			ImagesFormatNative, ImagesFormatSkopeo, ImagesFormatRegsync)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = types.NewImageList(result.Images, parser); err != nil {
+		return nil, fmt.Errorf("invalid rules converted from %v file: %v", imagesFormat, err)
+	}
+	return result, nil
+}
+
+// Convert converts the images file of another tool specified by SetImagesFormat, or the deprecated config file
+// which has both auth information and rules, into an images file and an auth file in yaml format. The auth file is
+// nil if there is no auth information, and the options which cannot be converted are returned as warnings.
+func Convert(configFile, imagesFile string) (images, auth []byte, warnings []string, err error) {
+	var imagesTree, authTree interface{}
+
+	if configFile != "" {
+		if imagesTree, authTree, err = splitConfigFile(configFile); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to convert config file %v: %v", configFile, err)
+		}
+	} else {
+		if imagesFormat == ImagesFormatNative {
+			return nil, nil, nil, fmt.Errorf("images file of %v format needs no conversion, set --images-format "+
+				"to %v or %v, or convert a config file by --config", ImagesFormatNative, ImagesFormatSkopeo,
+				ImagesFormatRegsync)
+		}
+
+		// there is no auth information with base path in images files of other tools
+		imported, err := importImages(imagesFile, nil)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to convert images file %v: %v", redactURL(imagesFile), err)
+		}
+
+		imagesTree, warnings = imported.Images, imported.Warnings
+		if len(imported.Auth) != 0 {
+			if authTree, err = compactAuth(imported.Auth); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	if images, err = yaml.Marshal(imagesTree); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to marshal images file: %v", err)
+	}
+	if authTree != nil {
+		if auth, err = yaml.Marshal(authTree); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to marshal auth file: %v", err)
+		}
+	}
+	return images, auth, warnings, nil
+}
+
+// splitConfigFile returns the rules and auth information of the deprecated config file, the order of keys in yaml
+// file is kept.
+func splitConfigFile(configFile string) (images, auth interface{}, err error) {
+	content, format, err := readSource(configFile, remoteHost(configFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tree, err := unmarshalTree(content, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sections := map[string]interface{}{}
+	if t, ok := tree.(yaml.MapSlice); ok {
+		for _, item := range t {
+			sections[fmt.Sprint(item.Key)] = item.Value
+		}
+	}
+
+	for key := range sections {
+		if key != "auth" && key != "images" {
+			return nil, nil, fmt.Errorf("unknown section %v", key)
+		}
+	}
+	if sections["images"] == nil {
+		return nil, nil, fmt.Errorf("images section is empty")
+	}
+
+	// rules are validated before they are written
+	var config Config
+	if err = decode(content, format, &config); err != nil {
+		return nil, nil, err
+	}
+	parser, err := newURLParser(config.AuthList)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = types.NewImageList(config.ImageList, parser); err != nil {
+		return nil, nil, err
+	}
+
+	return sections["images"], sections["auth"], nil
+}
+
+// compactAuth converts auth information into the form of auth file without empty fields.
+func compactAuth(authList map[string]types.Auth) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	for key, auth := range authList {
+		content, err := json.Marshal(auth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal auth information of %v: %v", key, err)
+		}
+
+		fields := map[string]interface{}{}
+		if err = json.Unmarshal(content, &fields); err != nil {
+			return nil, fmt.Errorf("failed to marshal auth information of %v: %v", key, err)
+		}
+		for field, value := range fields {
+			if value == "" || value == false {
+				delete(fields, field)
+			}
+		}
+		result[key] = fields
+	}
+	return result, nil
+}
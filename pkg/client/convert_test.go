@@ -0,0 +1,110 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// loadRules loads the config like a synchronization does, and returns its auth information without credential
+// providers and its parsed rules, so that configs loaded from different files can be compared.
+func loadRules(t *testing.T, configFile, authFile, imagesFile string) (map[string]types.Auth, []*types.Rule) {
+	config, err := NewSyncConfig(configFile, authFile, imagesFile, "", nil, nil, logrus.New())
+	assert.NoError(t, err)
+
+	for key, auth := range config.AuthList {
+		auth.Credential = nil
+		config.AuthList[key] = auth
+	}
+	rules, err := types.NewImageList(config.ImageList, config.urlParser)
+	assert.NoError(t, err)
+	return config.AuthList, rules
+}
+
+// assertConverted checks that the native files converted from the images file of format, or the config file, are
+// loaded as the same auth information and rules of the original one.
+func assertConverted(t *testing.T, format string, options types.SkopeoOptions, configFile, imagesFile string) {
+	SetImagesFormat(format, options)
+	defer SetImagesFormat(ImagesFormatNative, types.SkopeoOptions{})
+
+	expectedAuth, expectedRules := loadRules(t, configFile, "", imagesFile)
+	assert.NotEmpty(t, expectedRules)
+
+	images, auth, _, err := Convert(configFile, imagesFile)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	convertedImages, convertedAuth := filepath.Join(dir, "images.yaml"), filepath.Join(dir, "auth.yaml")
+	assert.NoError(t, os.WriteFile(convertedImages, images, 0644))
+	assert.NoError(t, os.WriteFile(convertedAuth, auth, 0600))
+
+	SetImagesFormat(ImagesFormatNative, types.SkopeoOptions{})
+	actualAuth, actualRules := loadRules(t, "", convertedAuth, convertedImages)
+	assert.Equal(t, expectedAuth, actualAuth)
+	assert.Equal(t, expectedRules, actualRules)
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"skopeo.yaml": `registry.example.com:
+  images:
+    busybox: []
+    redis: ["1.0", "2.0"]
+  images-by-tag-regex:
+    nginx: ^1\.13\.[12]-alpine-perl$
+  images-by-semver:
+    alpine: ">= 3.12.0"
+  credentials:
+    username: john
+    password: secret
+docker.io:
+  tls-verify: false
+  images:
+    busybox: [latest]
+`,
+		"regsync.yaml": `version: 1
+creds:
+  - registry: registry:5000
+    tls: disabled
+  - registry: docker.io
+    user: '{{env "HUB_USER"}}'
+    pass: '{{env "HUB_PASS"}}'
+defaults:
+  platform: linux/amd64
+sync:
+  - source: busybox:latest
+    target: registry:5000/library/busybox:latest
+    type: image
+  - source: alpine
+    target: registry:5000/library/alpine
+    type: repository
+    tags:
+      allow: ["3", "3\\.\\d+"]
+      deny: ["3.0"]
+`,
+		"config.yaml": `auth:
+  registry.example.com:
+    username: user
+    password: password
+images:
+  docker.io/library/nginx:1.25,1.26: registry.example.com/library/nginx
+  quay.io/app:
+    tags:
+      include: [v1]
+    destinations: [registry.example.com/app]
+`,
+	})
+	t.Setenv("HUB_USER", "user")
+	t.Setenv("HUB_PASS", "password")
+
+	assertConverted(t, ImagesFormatSkopeo, types.SkopeoOptions{Destination: "registry.local/mirror"}, "",
+		filepath.Join(dir, "skopeo.yaml"))
+	assertConverted(t, ImagesFormatRegsync, types.SkopeoOptions{}, "", filepath.Join(dir, "regsync.yaml"))
+	assertConverted(t, ImagesFormatNative, types.SkopeoOptions{}, filepath.Join(dir, "config.yaml"), "")
+}
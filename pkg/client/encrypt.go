@@ -0,0 +1,131 @@
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/encrypt"
+)
+
+var (
+	// fields of auth file which will be encrypted if only values are encrypted
+	encryptedAuthFields = map[string]struct{}{
+		"username": {},
+		"password": {},
+	}
+)
+
+// EncryptAuthFile encrypts a plaintext auth file. If valuesOnly is true, only usernames and passwords will be
+// encrypted and the result keeps the origin format, or else the whole file will be encrypted.
+func EncryptAuthFile(filePath string, recipients *encrypt.Recipients, valuesOnly bool) ([]byte, error) {
+	format, err := fileFormat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("open file %v error: %v", filePath, err)
+	}
+
+	if encrypt.IsEncrypted(content) {
+		return nil, fmt.Errorf("file %v has already been encrypted", filePath)
+	}
+
+	if !valuesOnly {
+		return recipients.Encrypt(content)
+	}
+
+	return transformValues(content, format, func(key, value string) (string, error) {
+		if _, exist := encryptedAuthFields[key]; !exist || value == "" || encrypt.IsEncryptedValue(value) {
+			return value, nil
+		}
+		return recipients.EncryptValue(value)
+	})
+}
+
+// hasEncryptedValues returns true if any username or password in the tree of auth file is encrypted.
+func hasEncryptedValues(tree interface{}) bool {
+	found := false
+	_, _ = transformNode("", tree, func(key, value string) (string, error) {
+		if _, exist := encryptedAuthFields[key]; exist && encrypt.IsEncryptedValue(value) {
+			found = true
+		}
+		return value, nil
+	})
+	return found
+}
+
+// DecryptAuthFile decrypts an auth file, both whole file encryption and value encryption are supported.
+func DecryptAuthFile(filePath string, keys *encrypt.Keys) ([]byte, error) {
+	format, err := fileFormat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("open file %v error: %v", filePath, err)
+	}
+
+	if encrypt.IsEncrypted(content) {
+		if content, err = keys.Decrypt(content); err != nil {
+			return nil, fmt.Errorf("failed to decrypt %v: %v", filePath, err)
+		}
+	}
+
+	return transformValues(content, format, func(_, value string) (string, error) {
+		if !encrypt.IsEncryptedValue(value) {
+			return value, nil
+		}
+		return keys.DecryptValue(value)
+	})
+}
+
+// transformValues calls transform for every string value in a yaml or json file, and returns the new file content
+// in the same format.
+func transformValues(content []byte, format string, transform func(key, value string) (string, error)) ([]byte, error) {
+	tree, err := unmarshalTree(content, format)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := transformNode("", tree, transform)
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalTree(result, format)
+}
+
+func transformNode(key string, node interface{}, transform func(key, value string) (string, error)) (interface{}, error) {
+	var err error
+
+	switch value := node.(type) {
+	case string:
+		return transform(key, value)
+	case yaml.MapSlice:
+		for index, item := range value {
+			itemKey, _ := item.Key.(string)
+			if value[index].Value, err = transformNode(itemKey, item.Value, transform); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for itemKey, item := range value {
+			if value[itemKey], err = transformNode(itemKey, item, transform); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for index, item := range value {
+			if value[index], err = transformNode(key, item, transform); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return node, nil
+}
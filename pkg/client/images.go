@@ -0,0 +1,411 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// imagesLoader loads images files and the files they include, and merges their rules into one image list.
+type imagesLoader struct {
+	result map[string]interface{}
+
+	// locations records where each rule is defined, in the form of "file:line"
+	locations map[string]string
+
+	// loaded records the absolute paths or urls of loaded files and the defaults they inherit, so that a file
+	// included by several files is loaded only once
+	loaded map[string]types.RuleDefaults
+	// loading records the files being loaded, i.e., the current file and the files including it, so that a file
+	// cannot include itself
+	loading map[string]bool
+
+	// keys are the rules in the order of loading, they are checked after all the destination sets are loaded
+	keys []string
+
+	// sets and setLocations are the destination sets of all the files and where each one is defined
+	sets         types.DestinationSets
+	setLocations map[string]string
+
+	// credentialHost is the host of https images file loaded directly, credentials of environment variables are not
+	// sent to the other hosts of included files
+	credentialHost string
+
+	// collect means that errors are collected into problems rather than returned, so that all the problems can be
+	// reported at once
+	collect  bool
+	problems []Problem
+}
+
+// openAndDecodeImages loads the images files matched by pattern, which can be a file, a directory, a glob, a https
+// url or "-" (stdin), and the files included by them. The rules of each file inherit its "defaults" section, and all
+// the rules are merged into one validated image list, in which the destination sets of all the files are shared.
+// Errors are reported with the file and line of rules, and urls are parsed by parser.
+func openAndDecodeImages(pattern string, parser *utils.URLParser) (map[string]interface{}, error) {
+	loader, err := loadImages(pattern, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// rules can refer to the destination sets defined in any file
+	for _, key := range loader.keys {
+		if _, err = types.NewImageList(loader.rule(key), parser); err != nil {
+			return nil, fmt.Errorf("%v: %v", loader.locations[key], err)
+		}
+	}
+	if len(loader.sets) != 0 {
+		loader.result[types.DestinationSetsKey] = loader.sets
+	}
+
+	// rules are also checked together, e.g., repositories mapped from different sources should not collide
+	if _, err = types.NewImageList(loader.result, parser); err != nil {
+		return nil, err
+	}
+	return loader.result, nil
+}
+
+// loadImages loads the images files matched by pattern and the files included by them, the rules are not checked
+// until all the destination sets are loaded. Errors are collected into the problems of loader if collect is true.
+func loadImages(pattern string, collect bool) (*imagesLoader, error) {
+	loader := &imagesLoader{
+		result:    map[string]interface{}{},
+		locations: map[string]string{},
+		loaded:    map[string]types.RuleDefaults{},
+		loading:   map[string]bool{},
+
+		sets:         types.DestinationSets{},
+		setLocations: map[string]string{},
+
+		collect:        collect,
+		credentialHost: remoteHost(pattern),
+	}
+
+	files, err := matchImagesFiles(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if err = loader.load(file, types.RuleDefaults{}); err != nil {
+			return nil, err
+		}
+	}
+	return loader, nil
+}
+
+// rule returns the images file which only has the rule of key and all the destination sets.
+func (l *imagesLoader) rule(key string) map[string]interface{} {
+	return map[string]interface{}{types.DestinationSetsKey: l.sets, key: l.result[key]}
+}
+
+// fail returns err with location, or collects it as a problem and returns nil if errors are collected.
+func (l *imagesLoader) fail(location string, err error) error {
+	if l.collect {
+		l.problems = append(l.problems, Problem{Location: location, Message: err.Error()})
+		return nil
+	}
+
+	if location == "" {
+		return err
+	}
+	return fmt.Errorf("%v: %v", location, err)
+}
+
+// load loads an images file, whose rules inherit defaults merged with the "defaults" section of the file. A file
+// which is already loaded with the same defaults is skipped, e.g., a common file included by the files of teams.
+func (l *imagesLoader) load(file string, defaults types.RuleDefaults) error {
+	loadedKey := file
+	if !isRemote(file) && file != stdinPath {
+		absPath, err := filepath.Abs(file)
+		if err != nil {
+			return l.fail("", fmt.Errorf("failed to get absolute path of %v: %v", file, err))
+		}
+		loadedKey = absPath
+	}
+	if l.loading[loadedKey] {
+		return l.fail("", fmt.Errorf("images file %v includes itself, check the include sections", redactURL(file)))
+	}
+	if loadedDefaults, exist := l.loaded[loadedKey]; exist {
+		if reflect.DeepEqual(loadedDefaults, defaults) {
+			return nil
+		}
+		return l.fail("", fmt.Errorf("images file %v is loaded more than once with different defaults, check the "+
+			"include sections", redactURL(file)))
+	}
+	l.loaded[loadedKey] = defaults
+	l.loading[loadedKey] = true
+	defer delete(l.loading, loadedKey)
+
+	content, format, err := readSource(file, l.credentialHost)
+	if err != nil {
+		return l.fail("", err)
+	}
+
+	name := sourceName(file)
+
+	tree := map[string]interface{}{}
+	if err = decode(content, format, &tree); err != nil {
+		return l.fail(name, err)
+	}
+
+	lines, err := keyLines(content, format)
+	if err != nil {
+		return l.fail(name, err)
+	}
+	location := func(key string) string {
+		return fmt.Sprintf("%v:%v", name, lines[key])
+	}
+
+	if value, exist := tree[types.DefaultsKey]; exist {
+		fileDefaults, err := types.NewRuleDefaults(value)
+		if err != nil {
+			// rules of the file cannot be checked without defaults
+			return l.fail(location(types.DefaultsKey), err)
+		}
+		defaults = defaults.Merge(fileDefaults)
+	}
+
+	var keys []string
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return lines[keys[i]] < lines[keys[j]]
+	})
+
+	if value, exist := tree[types.DestinationSetsKey]; exist {
+		sets, err := types.NewDestinationSets(value)
+		if err != nil {
+			if err = l.fail(location(types.DestinationSetsKey), err); err != nil {
+				return err
+			}
+		}
+
+		for setName, set := range sets {
+			if other, exist := l.setLocations[setName]; exist {
+				err = fmt.Errorf("destination set %v is already defined at %v", setName, other)
+				if err = l.fail(location(types.DestinationSetsKey), err); err != nil {
+					return err
+				}
+				continue
+			}
+			l.sets[setName] = set
+			l.setLocations[setName] = location(types.DestinationSetsKey)
+		}
+	}
+
+	for _, key := range keys {
+		if key == types.DefaultsKey || key == types.IncludeKey || key == types.DestinationSetsKey {
+			continue
+		}
+
+		if other, exist := l.locations[key]; exist {
+			err = fmt.Errorf("rule %v is already defined at %v", key, other)
+			if err = l.fail(location(key), err); err != nil {
+				return err
+			}
+			continue
+		}
+		l.result[key] = defaults.Apply(tree[key])
+		l.locations[key] = location(key)
+		l.keys = append(l.keys, key)
+	}
+
+	if value, exist := tree[types.IncludeKey]; exist {
+		patterns, err := includePatterns(value)
+		if err != nil {
+			return l.fail(location(types.IncludeKey), err)
+		}
+
+		for _, pattern := range patterns {
+			// included paths are relative to the including file
+			if pattern, err = includePath(file, pattern); err != nil {
+				if err = l.fail(location(types.IncludeKey), err); err != nil {
+					return err
+				}
+				continue
+			}
+
+			files, err := matchImagesFiles(pattern)
+			if err != nil {
+				if err = l.fail(location(types.IncludeKey), err); err != nil {
+					return err
+				}
+				continue
+			}
+
+			for _, included := range files {
+				if err = l.load(included, defaults); err != nil {
+					return fmt.Errorf("%v: failed to include %v: %v", location(types.IncludeKey),
+						redactURL(included), err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchImagesFiles returns the images files of pattern in order. All the yaml/json files in a directory (not
+// recursively) are returned if pattern is a directory, and at least one file should match if pattern is a glob.
+func matchImagesFiles(pattern string) ([]string, error) {
+	if isRemote(pattern) || pattern == stdinPath {
+		return []string{pattern}, nil
+	}
+
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %v: %v", pattern, err)
+		}
+
+		var result []string
+		for _, entry := range entries {
+			if _, err := fileFormat(entry.Name()); err == nil && !entry.IsDir() {
+				result = append(result, filepath.Join(pattern, entry.Name()))
+			}
+		}
+		if len(result) == 0 {
+			return nil, fmt.Errorf("no images file is found in directory %v", pattern)
+		}
+		return result, nil
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %v: %v", pattern, err)
+	}
+
+	var result []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			result = append(result, match)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no images file matches %v", pattern)
+	}
+	return result, nil
+}
+
+// includePath returns the path of pattern included by file, relative paths are resolved against the directory or
+// url of file, and a https file cannot include local files.
+func includePath(file, pattern string) (string, error) {
+	if isRemote(file) {
+		base, err := url.Parse(file)
+		if err != nil {
+			return "", err
+		}
+		reference, err := url.Parse(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid include %v: %v", pattern, err)
+		}
+
+		result := base.ResolveReference(reference)
+		if result.Scheme != "https" {
+			return "", fmt.Errorf("https images file cannot include %v", pattern)
+		}
+		if reference.User == nil && result.Host == base.Host {
+			// credentials of url are kept for the files on the same host
+			result.User = base.User
+		}
+		return result.String(), nil
+	}
+
+	if isRemote(pattern) || filepath.IsAbs(pattern) || file == stdinPath {
+		return pattern, nil
+	}
+	return filepath.Join(filepath.Dir(file), pattern), nil
+}
+
+// includePatterns returns the paths or globs of an include section, which is a string or a list of strings.
+func includePatterns(value interface{}) ([]string, error) {
+	invalidErr := fmt.Errorf("include should be a path or a list of paths")
+
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil, invalidErr
+		}
+		return []string{os.ExpandEnv(v)}, nil
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			pattern, ok := item.(string)
+			if !ok || pattern == "" {
+				return nil, invalidErr
+			}
+			result = append(result, os.ExpandEnv(pattern))
+		}
+		return result, nil
+	}
+	return nil, invalidErr
+}
+
+// sourceName returns the name of a file, a https url or stdin ("-") in messages, passwords in urls are never
+// reported.
+func sourceName(path string) string {
+	if isRemote(path) {
+		return redactURL(path)
+	} else if path == stdinPath {
+		return "stdin"
+	}
+	return path
+}
+
+// keyLines returns the line numbers of the top-level keys in a yaml or json file.
+func keyLines(content []byte, format string) (map[string]int, error) {
+	result := map[string]int{}
+
+	if format == formatYAML {
+		var document yamlv3.Node
+		if err := yamlv3.Unmarshal(content, &document); err != nil {
+			return nil, fmt.Errorf("unmarshal config error: %v", err)
+		}
+
+		if len(document.Content) != 0 && document.Content[0].Kind == yamlv3.MappingNode {
+			items := document.Content[0].Content
+			for index := 0; index+1 < len(items); index += 2 {
+				result[items[index].Value] = items[index].Line
+			}
+		}
+		return result, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		// an empty json file has no keys
+		return result, nil
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal config error: %v", err)
+		}
+		if key, ok := token.(string); ok {
+			result[key] = bytes.Count(content[:decoder.InputOffset()], []byte("\n")) + 1
+		}
+
+		var value json.RawMessage
+		if err = decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("unmarshal config error: %v", err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/concurrent"
+	"github.com/AliyunContainerService/image-syncer/pkg/task"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+const (
+	// LockModeNone means lockfile is not used
+	LockModeNone = ""
+	// LockModeWrite means the digests of source images are resolved and written into lockfile, nothing is synchronized
+	LockModeWrite = "write"
+	// LockModeLocked means exactly the digests recorded in lockfile are synchronized
+	LockModeLocked = "locked"
+)
+
+// newLock creates the lock used by tasks according to lock mode.
+func newLock(lockfilePath, lockMode string) (*task.Lock, error) {
+	switch lockMode {
+	case LockModeNone:
+		return nil, nil
+	case LockModeWrite:
+		if _, err := fileFormat(lockfilePath); err != nil {
+			return nil, fmt.Errorf("invalid lockfile %v: %v", lockfilePath, err)
+		}
+		return &task.Lock{Lockfile: concurrent.NewLockfile(types.NewLockfile())}, nil
+	case LockModeLocked:
+		lockfile := &types.Lockfile{}
+		if err := openAndDecode(lockfilePath, lockfile); err != nil {
+			return nil, fmt.Errorf("decode lockfile %v error: %v", lockfilePath, err)
+		}
+		if err := lockfile.Check(); err != nil {
+			return nil, fmt.Errorf("check lockfile %v error: %v", lockfilePath, err)
+		}
+		return &task.Lock{Locked: true, Lockfile: concurrent.NewLockfile(lockfile)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown lock mode %q", lockMode)
+}
+
+// writeLockfile writes the content of lock into lockfilePath in the format of its suffix.
+func writeLockfile(lockfilePath string, lock *task.Lock) error {
+	format, err := fileFormat(lockfilePath)
+	if err != nil {
+		return err
+	}
+
+	content, err := marshalTree(lock.Lockfile.Content(), format)
+	if err != nil {
+		return fmt.Errorf("marshal lockfile error: %v", err)
+	}
+
+	if err = os.WriteFile(lockfilePath, content, 0644); err != nil {
+		return fmt.Errorf("write lockfile %v error: %v", lockfilePath, err)
+	}
+	return nil
+}
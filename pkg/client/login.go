@@ -0,0 +1,167 @@
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/encrypt"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// LoginAuth returns the registry which key ("registry" or "registry/namespace") belongs to, and the auth information
+// in auth file that matches key, whose settings like base path and certificates are used to verify credentials. The
+// registry is resolved by the base paths of auth information like synchronization does.
+func LoginAuth(authFile, key string) (string, types.Auth, error) {
+	if err := checkLocalAuthFile(authFile); err != nil {
+		return "", types.Auth{}, err
+	}
+
+	config := &Config{AuthList: map[string]types.Auth{}}
+	if _, err := os.Stat(authFile); !os.IsNotExist(err) {
+		if err = openAndDecode(authFile, &config.AuthList); err != nil {
+			return "", types.Auth{}, fmt.Errorf("decode auth file %v error: %v", authFile, err)
+		}
+	}
+
+	parser, err := newURLParser(config.AuthList)
+	if err != nil {
+		return "", types.Auth{}, err
+	}
+
+	registry, _, ok := parser.SplitExplicitRegistry(key + "/")
+	if !ok {
+		registry, _ = utils.SplitRegistryHost(key)
+	}
+
+	var auth types.Auth
+	if matched, exist := config.authKey(key); exist {
+		auth = config.AuthList[matched]
+	}
+	return registry, auth, nil
+}
+
+// SaveAuth adds or updates the username and password of key ("registry" or "registry/namespace") in auth file,
+// the other fields of the entry and the other entries are kept. Auth file will be created if it doesn't exist.
+// The username and password are encrypted with recipients if it's not nil, which is required if the usernames or
+// passwords in auth file have been encrypted.
+func SaveAuth(authFile, key, username, password string, insecure bool, recipients *encrypt.Recipients) error {
+	return updateAuthFile(authFile, true, func(entries yaml.MapSlice) (yaml.MapSlice, error) {
+		if recipients != nil {
+			var err error
+			if username, err = recipients.EncryptValue(username); err != nil {
+				return nil, fmt.Errorf("failed to encrypt username: %v", err)
+			}
+			if password, err = recipients.EncryptValue(password); err != nil {
+				return nil, fmt.Errorf("failed to encrypt password: %v", err)
+			}
+		} else if hasEncryptedValues(entries) {
+			return nil, fmt.Errorf("usernames or passwords in auth file %v are encrypted, the new ones should be "+
+				"encrypted with --age-recipient or --pgp-public-key too", authFile)
+		}
+
+		for index, item := range entries {
+			if item.Key == key {
+				entry, _ := item.Value.(yaml.MapSlice)
+				entry = setMapSliceValue(entry, "username", username)
+				entry = setMapSliceValue(entry, "password", password)
+				if insecure {
+					entry = setMapSliceValue(entry, "insecure", true)
+				}
+				entries[index].Value = entry
+				return entries, nil
+			}
+		}
+
+		entry := yaml.MapSlice{{Key: "username", Value: username}, {Key: "password", Value: password}}
+		if insecure {
+			entry = append(entry, yaml.MapItem{Key: "insecure", Value: true})
+		}
+		return append(entries, yaml.MapItem{Key: key, Value: entry}), nil
+	})
+}
+
+// RemoveAuth removes the entry of key ("registry" or "registry/namespace") from auth file.
+func RemoveAuth(authFile, key string) error {
+	return updateAuthFile(authFile, false, func(entries yaml.MapSlice) (yaml.MapSlice, error) {
+		for index, item := range entries {
+			if item.Key == key {
+				return append(entries[:index], entries[index+1:]...), nil
+			}
+		}
+
+		return nil, fmt.Errorf("auth information of %v not found in %v", key, authFile)
+	})
+}
+
+// checkLocalAuthFile checks the auth file of login and logout, which is updated in place, so it cannot be a https
+// url or stdin.
+func checkLocalAuthFile(authFile string) error {
+	if authFile == "" {
+		return fmt.Errorf("auth file should be provided by --auth")
+	}
+	if authFile == stdinPath {
+		return fmt.Errorf("auth file cannot be read from stdin by login and logout, a local file should be provided")
+	}
+	if isRemote(authFile) {
+		return fmt.Errorf("auth file %v cannot be updated by login and logout, a local file should be provided",
+			redactURL(authFile))
+	}
+	return nil
+}
+
+// updateAuthFile updates the entries of auth file in its origin format, the order of keys is kept.
+func updateAuthFile(authFile string, createIfNotExist bool, update func(entries yaml.MapSlice) (yaml.MapSlice, error)) error {
+	if err := checkLocalAuthFile(authFile); err != nil {
+		return err
+	}
+
+	format, err := fileFormat(authFile)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(authFile)
+	if err != nil && !(os.IsNotExist(err) && createIfNotExist) {
+		return fmt.Errorf("open file %v error: %v", authFile, err)
+	}
+
+	if encrypt.IsEncrypted(content) {
+		return fmt.Errorf("auth file %v is encrypted, please decrypt it first", authFile)
+	}
+
+	tree, err := unmarshalTree(content, format)
+	if err != nil {
+		return err
+	}
+
+	entries, ok := tree.(yaml.MapSlice)
+	if !ok {
+		return fmt.Errorf("invalid auth file format")
+	}
+	if entries, err = update(entries); err != nil {
+		return err
+	}
+
+	if content, err = marshalTree(entries, format); err != nil {
+		return err
+	}
+
+	// auth file contains passwords
+	if err = os.WriteFile(authFile, content, 0600); err != nil {
+		return fmt.Errorf("failed to write %v: %v", authFile, err)
+	}
+	return nil
+}
+
+func setMapSliceValue(slice yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for index, item := range slice {
+		if item.Key == key {
+			slice[index].Value = value
+			return slice
+		}
+	}
+	return append(slice, yaml.MapItem{Key: key, Value: value})
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// Plan returns the image sync rules after matrix rules are expanded, and the source and destination pairs of each
+// rule, nothing is synchronized and registries are not accessed. Tags listed from source repositories and wildcard
+// sources are expanded during synchronization.
+func Plan(configFile, authFile, imagesFile, logFile string) ([]byte, error) {
+	config, err := NewSyncConfig(configFile, authFile, imagesFile, "", nil, nil, NewFileLogger(logFile))
+	if err != nil {
+		return nil, fmt.Errorf("generate config error: %v", err)
+	}
+
+	rules, err := types.NewImageList(config.ImageList, config.urlParser)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image list: %v", err)
+	}
+
+	var result bytes.Buffer
+	var pairs int
+	for _, rule := range rules {
+		// expanded matrix rules are named with their variables
+		fmt.Fprintf(&result, "%v\n", rule.Name)
+
+		for _, dest := range rule.Destinations {
+			fmt.Fprintf(&result, "  + %v -> %v\n", rule.Source, dest)
+			pairs++
+		}
+	}
+	fmt.Fprintf(&result, "\nPlan: %v rules, %v source and destination pairs.\n", len(rules), pairs)
+
+	return result.Bytes(), nil
+}
@@ -0,0 +1,298 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// RemoteTokenEnv is the bearer token to fetch https config files
+	RemoteTokenEnv = "IMAGE_SYNCER_REMOTE_TOKEN"
+	// RemoteUsernameEnv and RemotePasswordEnv are the basic auth credentials to fetch https config files, which are
+	// overridden by the user info of url
+	RemoteUsernameEnv = "IMAGE_SYNCER_REMOTE_USERNAME"
+	RemotePasswordEnv = "IMAGE_SYNCER_REMOTE_PASSWORD"
+
+	// stdinPath means a config file is read from stdin
+	stdinPath = "-"
+
+	remotePrefix  = "https://"
+	remoteTimeout = 30 * time.Second
+
+	// checksumPrefix is the prefix of url fragment which pins the sha256 checksum of content
+	checksumPrefix = "sha256="
+)
+
+var (
+	// remoteCAFile is the PEM file of CA certificates which are trusted in addition to system ones
+	remoteCAFile string
+	// remoteCacheDir is the directory to cache https config files by ETag, the user cache directory is used if it's
+	// empty
+	remoteCacheDir string
+)
+
+// SetRemoteOptions sets the CA file to verify the servers of https config files, and the directory to cache them.
+func SetRemoteOptions(caFile, cacheDir string) {
+	remoteCAFile, remoteCacheDir = caFile, cacheDir
+}
+
+// remoteCacheMeta is the metadata of a cached https config file
+type remoteCacheMeta struct {
+	ETag   string `json:"etag"`
+	Format string `json:"format"`
+}
+
+// isRemote returns true if path is a https url.
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, remotePrefix)
+}
+
+// remoteHost returns the host of path if it is a https url, otherwise it returns an empty string.
+func remoteHost(path string) string {
+	if !isRemote(path) {
+		return ""
+	}
+
+	parsed, err := url.Parse(path)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
+
+// redactURL hides the password of url, so that it can be logged.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.Redacted()
+}
+
+// fetchRemote fetches a https config file and returns its content and format. The content is revalidated by ETag if
+// it has been cached, and verified by the sha256 checksum in url fragment (e.g., "#sha256=...") if it's provided.
+// Credentials of environment variables are only sent if the url is on credentialHost, which is the host of the
+// top-level file, so that they are not sent to the other hosts of included files.
+func fetchRemote(rawURL, credentialHost string) ([]byte, string, error) {
+	name := redactURL(rawURL)
+
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid url %v: %v", name, err)
+	}
+
+	var checksum string
+	if target.Fragment != "" {
+		if !strings.HasPrefix(target.Fragment, checksumPrefix) {
+			return nil, "", fmt.Errorf("invalid fragment of %v, only %v<hex> is supported", name, checksumPrefix)
+		}
+		checksum = strings.ToLower(strings.TrimPrefix(target.Fragment, checksumPrefix))
+		if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+			return nil, "", fmt.Errorf("invalid sha256 checksum of %v", name)
+		}
+	}
+
+	var username, password, token string
+	if target.Host == credentialHost {
+		username, password = os.Getenv(RemoteUsernameEnv), os.Getenv(RemotePasswordEnv)
+		token = os.Getenv(RemoteTokenEnv)
+	}
+	if target.User != nil {
+		username = target.User.Username()
+		password, _ = target.User.Password()
+	}
+	target.User, target.Fragment, target.RawFragment = nil, "", ""
+
+	request, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request for %v: %v", name, err)
+	}
+	request.Header.Set("Accept", "application/yaml, application/json;q=0.9, */*;q=0.8")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	} else if username != "" {
+		request.SetBasicAuth(username, password)
+	}
+
+	cachePath := remoteCachePath(target.String())
+	cached, meta := readRemoteCache(cachePath)
+	if meta != nil && meta.ETag != "" {
+		request.Header.Set("If-None-Match", meta.ETag)
+	}
+
+	client, err := remoteClient()
+	if err != nil {
+		return nil, "", err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch %v: %v", name, err)
+	}
+	defer response.Body.Close()
+
+	var content []byte
+	var format string
+
+	switch response.StatusCode {
+	case http.StatusNotModified:
+		if meta == nil {
+			return nil, "", fmt.Errorf("failed to fetch %v: unexpected status %v without cache", name,
+				response.Status)
+		}
+		content, format = cached, meta.Format
+	case http.StatusOK:
+		if content, err = io.ReadAll(response.Body); err != nil {
+			return nil, "", fmt.Errorf("failed to read %v: %v", name, err)
+		}
+
+		if format, err = remoteFormat(response.Header.Get("Content-Type"), target.Path); err != nil {
+			return nil, "", fmt.Errorf("unknown format of %v: %v", name, err)
+		}
+	default:
+		return nil, "", fmt.Errorf("failed to fetch %v: unexpected status %v", name, response.Status)
+	}
+
+	if checksum != "" {
+		sum := sha256.Sum256(content)
+		if actual := hex.EncodeToString(sum[:]); actual != checksum {
+			return nil, "", fmt.Errorf("checksum of %v mismatched, expected sha256 %v but got %v", name,
+				checksum, actual)
+		}
+	}
+
+	if etag := response.Header.Get("ETag"); response.StatusCode == http.StatusOK && etag != "" {
+		// the cache is only an optimization, so it's fine to fail to write it
+		writeRemoteCache(cachePath, content, &remoteCacheMeta{ETag: etag, Format: format})
+	}
+
+	return content, format, nil
+}
+
+// remoteClient creates the http client which trusts the CA certificates of remoteCAFile besides system ones.
+func remoteClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if remoteCAFile != "" {
+		pem, err := os.ReadFile(remoteCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %v: %v", remoteCAFile, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate is found in CA file %v", remoteCAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   remoteTimeout,
+		// credentials should not be sent to other hosts, and https should not be downgraded
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			if request.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to non-https url %v is refused", request.URL.Redacted())
+			}
+			if request.URL.Host != via[0].URL.Host {
+				request.Header.Del("Authorization")
+			}
+			return nil
+		},
+	}, nil
+}
+
+// remoteFormat returns the format of a https config file from its Content-Type header, or the suffix of url path if
+// the header is not a yaml or json type.
+func remoteFormat(contentType, urlPath string) (string, error) {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			return formatJSON, nil
+		case mediaType == "application/yaml" || mediaType == "application/x-yaml" || mediaType == "text/yaml" ||
+			mediaType == "text/x-yaml" || strings.HasSuffix(mediaType, "+yaml"):
+			return formatYAML, nil
+		}
+	}
+
+	return fileFormat(urlPath)
+}
+
+// remoteCachePath returns the path prefix of cache files of url, it's empty if cache directory is not available.
+func remoteCachePath(rawURL string) string {
+	dir := remoteCacheDir
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(userCacheDir, "image-syncer", "remote")
+	}
+
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dir, hex.EncodeToString(sum[:]))
+}
+
+// readRemoteCache reads the cached content and its metadata, the metadata is nil if there is no cache.
+func readRemoteCache(cachePath string) ([]byte, *remoteCacheMeta) {
+	if cachePath == "" {
+		return nil, nil
+	}
+
+	metaContent, err := os.ReadFile(cachePath + ".json")
+	if err != nil {
+		return nil, nil
+	}
+
+	meta := &remoteCacheMeta{}
+	if err = json.Unmarshal(metaContent, meta); err != nil {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(cachePath + ".content")
+	if err != nil {
+		return nil, nil
+	}
+	return content, meta
+}
+
+// writeRemoteCache writes the content and its metadata into cache, which might have credentials, so that they are
+// only accessible by current user.
+func writeRemoteCache(cachePath string, content []byte, meta *remoteCacheMeta) {
+	if cachePath == "" {
+		return
+	}
+
+	metaContent, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return
+	}
+	// metadata is written at last, so that the content is never revalidated by a stale ETag
+	_ = os.Remove(cachePath + ".json")
+	if err = os.WriteFile(cachePath+".content", content, 0600); err != nil {
+		return
+	}
+	_ = os.WriteFile(cachePath+".json", metaContent, 0600)
+}
@@ -0,0 +1,250 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newRemoteServer starts a https server whose certificate is trusted by remoteClient, https config files are cached
+// in a temporary directory which is returned.
+func newRemoteServer(t *testing.T, handler http.Handler) (*httptest.Server, string) {
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, content, 0644))
+
+	cacheDir := filepath.Join(dir, "cache")
+	SetRemoteOptions(caFile, cacheDir)
+	t.Cleanup(func() {
+		SetRemoteOptions("", "")
+	})
+	return server, cacheDir
+}
+
+func TestFetchRemoteCache(t *testing.T) {
+	content := `{"docker.io/library/nginx:1.25": "registry.example.com/library/nginx"}`
+
+	var requests int32
+	server, cacheDir := newRemoteServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/stale.json" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write([]byte(content))
+	}))
+
+	// the format is decided by Content-Type rather than the suffix of path
+	result, format, err := fetchRemote(server.URL+"/images.yaml", "")
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(result))
+	assert.Equal(t, formatJSON, format)
+
+	// cache files might have credentials
+	cachePath := remoteCachePath(server.URL + "/images.yaml")
+	assert.True(t, strings.HasPrefix(cachePath, cacheDir))
+	for _, suffix := range []string{".content", ".json"} {
+		info, err := os.Stat(cachePath + suffix)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// the cached content is used if it's not modified
+	result, format, err = fetchRemote(server.URL+"/images.yaml", "")
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(result))
+	assert.Equal(t, formatJSON, format)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	_, _, err = fetchRemote(server.URL+"/stale.json", "")
+	assert.EqualError(t, err, "failed to fetch "+server.URL+"/stale.json: unexpected status 304 Not Modified "+
+		"without cache")
+}
+
+func TestFetchRemoteChecksum(t *testing.T) {
+	content := "docker.io/library/nginx:1.25: registry.example.com/library/nginx\n"
+	server, _ := newRemoteServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		// unknown Content-Type falls back to the suffix of path
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(content))
+	}))
+
+	sum := sha256.Sum256([]byte(content))
+	checksum := hex.EncodeToString(sum[:])
+
+	result, format, err := fetchRemote(server.URL+"/images.yaml#sha256="+strings.ToUpper(checksum), "")
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(result))
+	assert.Equal(t, formatYAML, format)
+
+	pinned := server.URL + "/images.yaml#sha256=" + strings.Repeat("0", 64)
+	_, _, err = fetchRemote(pinned, "")
+	assert.EqualError(t, err, "checksum of "+pinned+" mismatched, expected sha256 "+strings.Repeat("0", 64)+
+		" but got "+checksum)
+
+	_, _, err = fetchRemote(server.URL+"/images.yaml#md5="+checksum, "")
+	assert.ErrorContains(t, err, "only sha256=<hex> is supported")
+
+	_, _, err = fetchRemote(server.URL+"/images.yaml#sha256=xyz", "")
+	assert.ErrorContains(t, err, "invalid sha256 checksum")
+
+	_, _, err = fetchRemote(server.URL+"/missing.yaml", "")
+	assert.EqualError(t, err, "failed to fetch "+server.URL+"/missing.yaml: unexpected status 404 Not Found")
+}
+
+func TestFetchRemoteRedirect(t *testing.T) {
+	content := "docker.io/library/nginx:1.25: registry.example.com/library/nginx\n"
+
+	// authorization headers received by the servers, keyed by path
+	authorizations := map[string]string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		authorizations[r.URL.Path] = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(content))
+	}
+
+	other := httptest.NewTLSServer(http.HandlerFunc(handler))
+	defer other.Close()
+	plain := httptest.NewServer(http.HandlerFunc(handler))
+	defer plain.Close()
+
+	server, _ := newRemoteServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same.yaml":
+			http.Redirect(w, r, "/moved.yaml", http.StatusFound)
+		case "/other.yaml":
+			http.Redirect(w, r, other.URL+"/other.yaml", http.StatusFound)
+		case "/plain.yaml":
+			http.Redirect(w, r, plain.URL+"/plain.yaml", http.StatusFound)
+		default:
+			handler(w, r)
+		}
+	}))
+	// credentials of url are sent as basic auth
+	authURL := strings.Replace(server.URL, "https://", "https://user:password@", 1)
+
+	_, _, err := fetchRemote(authURL+"/same.yaml", "")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(authorizations["/moved.yaml"], "Basic "))
+
+	// credentials are not sent to other hosts
+	result, _, err := fetchRemote(authURL+"/other.yaml", "")
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(result))
+	value, exist := authorizations["/other.yaml"]
+	assert.True(t, exist)
+	assert.Empty(t, value)
+
+	t.Setenv(RemoteTokenEnv, "token")
+	_, _, err = fetchRemote(server.URL+"/same.yaml", remoteHost(server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token", authorizations["/moved.yaml"])
+
+	// credentials of environment variables are only sent to the host of top-level file
+	_, _, err = fetchRemote(other.URL+"/included.yaml", remoteHost(server.URL))
+	assert.NoError(t, err)
+	value, exist = authorizations["/included.yaml"]
+	assert.True(t, exist)
+	assert.Empty(t, value)
+
+	// https is never downgraded
+	_, _, err = fetchRemote(server.URL+"/plain.yaml", "")
+	assert.ErrorContains(t, err, "redirect to non-https url "+plain.URL+"/plain.yaml is refused")
+	_, exist = authorizations["/plain.yaml"]
+	assert.False(t, exist)
+}
+
+func TestLoadImagesRemoteToken(t *testing.T) {
+	// authorization headers received by the servers, keyed by path
+	authorizations := map[string]string{}
+
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations[r.URL.Path] = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte("docker.io/library/redis:7: registry.example.com/library/redis\n"))
+	}))
+	defer other.Close()
+
+	server, _ := newRemoteServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations[r.URL.Path] = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/images.yaml":
+			_, _ = fmt.Fprintf(w, "include: [common.yaml, %v/other.yaml]\n", other.URL)
+		default:
+			_, _ = w.Write([]byte("docker.io/library/nginx:1.25: registry.example.com/library/nginx\n"))
+		}
+	}))
+
+	t.Setenv(RemoteTokenEnv, "token")
+	loader, err := loadImages(server.URL+"/images.yaml", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docker.io/library/nginx:1.25", "docker.io/library/redis:7"}, loader.keys)
+
+	// the token is sent to the files on the same host of top-level file only
+	assert.Equal(t, map[string]string{
+		"/images.yaml": "Bearer token",
+		"/common.yaml": "Bearer token",
+		"/other.yaml":  "",
+	}, authorizations)
+}
+
+func TestRemoteClient(t *testing.T) {
+	dir := t.TempDir()
+
+	SetRemoteOptions(filepath.Join(dir, "missing.pem"), dir)
+	defer SetRemoteOptions("", "")
+	_, err := remoteClient()
+	assert.ErrorContains(t, err, "failed to read CA file")
+
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0644))
+	SetRemoteOptions(caFile, dir)
+	_, err = remoteClient()
+	assert.ErrorContains(t, err, "no certificate is found in CA file")
+}
+
+func TestRemoteFormat(t *testing.T) {
+	for _, c := range []struct {
+		contentType, path, expected string
+	}{
+		{"application/json", "/images", formatJSON},
+		{"application/vnd.images+json; charset=utf-8", "/images.yaml", formatJSON},
+		{"application/yaml", "/images.json", formatYAML},
+		{"text/x-yaml", "/images", formatYAML},
+		{"application/vnd.images+yaml", "/images", formatYAML},
+		// Content-Type which is not yaml or json falls back to the suffix of path
+		{"text/plain", "/images.json", formatJSON},
+		{"", "/images.yml", formatYAML},
+		{"invalid;;", "/images.yaml", formatYAML},
+	} {
+		format, err := remoteFormat(c.contentType, c.path)
+		assert.NoError(t, err, c.contentType)
+		assert.Equal(t, c.expected, format, c.contentType)
+	}
+
+	_, err := remoteFormat("text/plain", "/images")
+	assert.Error(t, err)
+}
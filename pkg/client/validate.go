@@ -0,0 +1,424 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/sync"
+	"github.com/AliyunContainerService/image-syncer/pkg/task"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// placeholderRepository takes the place of the repositories matched by wildcard sources, which are unknown until
+// registries are accessed
+const placeholderRepository = "repository"
+
+// Problem is a problem of config files found by Validate
+type Problem struct {
+	// Location is "file:line" where the problem is, or the file if the line is unknown, it's empty if neither is
+	// known
+	Location string
+	// Warning means the problem doesn't stop synchronization
+	Warning bool
+	Message string
+}
+
+func (p Problem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+
+	if p.Location == "" {
+		return fmt.Sprintf("%v: %v", level, p.Message)
+	}
+	return fmt.Sprintf("%v: %v: %v", p.Location, level, p.Message)
+}
+
+// ruleGroup is the rules in the form of images file which are checked together, and where they are defined
+type ruleGroup struct {
+	location string
+	images   map[string]interface{}
+}
+
+// validator collects the problems of auth file and images file
+type validator struct {
+	authList      map[string]types.Auth
+	authKeys      []string
+	authLocations map[string]string
+	usedAuth      map[string]bool
+	// untrusted is the auth information which doesn't come from local files
+	untrusted map[string]bool
+	// parser knows the registries served under the base path of auth information
+	parser *utils.URLParser
+
+	groups []ruleGroup
+	// merged is all the rules which are checked together after each group is valid, nil if it's not needed
+	merged map[string]interface{}
+	// incomplete means some rules cannot be loaded, so that which auth information is used is unknown
+	incomplete bool
+
+	problems []Problem
+}
+
+// Validate checks the auth file and images file, or the deprecated config file, without accessing registries, and
+// returns all the problems found. The tags listed from registries and the repositories matched by wildcard sources
+// are unknown, so the checks which depend on them are left to synchronization.
+func Validate(configFile, authFile, imagesFile string) ([]Problem, error) {
+	if len(configFile) == 0 && len(imagesFile) == 0 {
+		return nil, fmt.Errorf("neither config.json nor images.json is provided")
+	}
+	if authFile == stdinPath && imagesFile == stdinPath {
+		return nil, fmt.Errorf("auth file and images file cannot be both read from stdin")
+	}
+
+	v := &validator{
+		authList:      map[string]types.Auth{},
+		authLocations: map[string]string{},
+		usedAuth:      map[string]bool{},
+		untrusted:     map[string]bool{},
+	}
+
+	if len(configFile) != 0 {
+		v.loadConfig(configFile)
+	} else {
+		if len(authFile) != 0 {
+			v.loadAuth(authFile)
+		}
+		// base paths of auth information decide how image urls are parsed
+		v.checkAuth()
+
+		if imagesFormat != ImagesFormatNative {
+			v.importImages(imagesFile)
+		} else {
+			v.loadImages(imagesFile)
+		}
+	}
+
+	v.checkRules()
+	if !v.incomplete {
+		v.checkUnusedAuth()
+	}
+	return v.problems, nil
+}
+
+func (v *validator) errorf(location string, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Location: location, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(location string, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Location: location, Warning: true, Message: fmt.Sprintf(format, args...)})
+}
+
+// loadConfig loads the deprecated config file, the line numbers of keys in its sections are unknown.
+func (v *validator) loadConfig(configFile string) {
+	var config Config
+	if err := openAndDecode(configFile, &config); err != nil {
+		v.errorf(sourceName(configFile), "%v", err)
+		v.incomplete = true
+		return
+	}
+
+	name := sourceName(configFile)
+	for key, auth := range config.AuthList {
+		v.authList[key] = auth
+		v.authKeys = append(v.authKeys, key)
+		v.authLocations[key] = name
+		v.untrusted[key] = !isLocalSource(configFile)
+	}
+	sort.Strings(v.authKeys)
+	v.checkAuth()
+
+	var keys []string
+	for key := range config.ImageList {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.groups = append(v.groups, ruleGroup{location: name, images: map[string]interface{}{
+			key: config.ImageList[key],
+		}})
+	}
+	v.merged = config.ImageList
+}
+
+// loadAuth loads the auth file, keys are kept in the order of lines.
+func (v *validator) loadAuth(authFile string) {
+	content, format, err := readSource(authFile, remoteHost(authFile))
+	if err != nil {
+		v.errorf("", "%v", err)
+		return
+	}
+
+	name := sourceName(authFile)
+	if err = decode(content, format, &v.authList); err != nil {
+		v.errorf(name, "%v", err)
+		return
+	}
+
+	lines, err := keyLines(content, format)
+	if err != nil {
+		v.errorf(name, "%v", err)
+		return
+	}
+
+	for key := range v.authList {
+		v.authKeys = append(v.authKeys, key)
+		v.authLocations[key] = fmt.Sprintf("%v:%v", name, lines[key])
+		v.untrusted[key] = !isLocalSource(authFile)
+	}
+	sort.Slice(v.authKeys, func(i, j int) bool {
+		return lines[v.authKeys[i]] < lines[v.authKeys[j]]
+	})
+}
+
+// checkAuth checks the settings of auth information and creates the url parser with the registry prefixes of base
+// paths.
+func (v *validator) checkAuth() {
+	var registryPrefixes []string
+	for _, key := range v.authKeys {
+		auth := v.authList[key]
+		if err := sync.CheckAuthSettings(auth); err != nil {
+			v.errorf(v.authLocations[key], "invalid auth information of %v: %v", key, err)
+			continue
+		}
+		if v.untrusted[key] {
+			if err := checkSecretReferences(auth); err != nil {
+				v.errorf(v.authLocations[key], "invalid auth information of %v: %v", key, err)
+				continue
+			}
+		}
+
+		if auth.BasePath != "" {
+			prefix, err := registryPrefix(key, auth.BasePath)
+			if err != nil {
+				v.errorf(v.authLocations[key], "invalid auth information of %v: %v", key, err)
+				continue
+			}
+			registryPrefixes = append(registryPrefixes, prefix)
+		}
+	}
+	v.parser = utils.NewURLParser(registryPrefixes)
+}
+
+// loadImages loads the images files of image-syncer, each rule is checked with the destination sets of all files.
+func (v *validator) loadImages(imagesFile string) {
+	loader, err := loadImages(imagesFile, true)
+	if err != nil {
+		v.errorf("", "%v", err)
+		v.incomplete = true
+		return
+	}
+	v.problems = append(v.problems, loader.problems...)
+	v.incomplete = len(loader.problems) != 0
+
+	for _, key := range loader.keys {
+		v.groups = append(v.groups, ruleGroup{location: loader.locations[key], images: loader.rule(key)})
+	}
+
+	v.merged = loader.result
+	if len(loader.sets) != 0 {
+		v.merged[types.DestinationSetsKey] = loader.sets
+	}
+}
+
+// importImages converts the images file of another tool, whose auth information is used if the auth file has none
+// for the same key.
+func (v *validator) importImages(imagesFile string) {
+	name := sourceName(imagesFile)
+	imported, err := importImages(imagesFile, v.parser)
+	if err != nil {
+		v.errorf(name, "%v", err)
+		v.incomplete = true
+		return
+	}
+
+	for _, warning := range imported.Warnings {
+		v.warnf(name, "%v", warning)
+	}
+	var keys []string
+	for key, auth := range imported.Auth {
+		if _, exist := v.authList[key]; !exist {
+			v.authList[key] = auth
+			v.authLocations[key] = name
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := checkSecretReferences(v.authList[key]); err != nil {
+			v.errorf(name, "invalid auth information of %v: %v", key, err)
+		}
+	}
+	v.authKeys = append(v.authKeys, keys...)
+
+	v.groups = append(v.groups, ruleGroup{location: name, images: imported.Images})
+}
+
+// checkRules checks each group of rules, and all the rules together if every group is valid.
+func (v *validator) checkRules() {
+	config := &Config{AuthList: v.authList}
+	reported := map[string]bool{}
+
+	useAuth := func(location, url string) {
+		registry, repository, err := repositoryOf(url, v.parser)
+		if err != nil {
+			// invalid urls are reported by the checks of rules
+			return
+		}
+
+		key, exist := config.authKey(registry + "/" + repository)
+		if exist {
+			v.usedAuth[key] = true
+			return
+		}
+
+		// the namespace of a wildcard source is empty if all the repositories of registry are matched
+		name := strings.TrimSuffix(registry+"/"+repository, "/")
+		if len(v.authKeys) != 0 && !reported[location+" "+name] {
+			reported[location+" "+name] = true
+			v.warnf(location, "no auth information matches %v, it will be accessed anonymously", name)
+		}
+	}
+
+	for _, group := range v.groups {
+		rules, err := types.NewImageList(group.images, v.parser)
+		if err != nil {
+			v.errorf(group.location, "%v", err)
+			v.incomplete = true
+			continue
+		}
+
+		for _, rule := range rules {
+			for _, source := range append([]string{rule.Source}, rule.FailoverSources...) {
+				useAuth(group.location, source)
+			}
+
+			for _, dest := range rule.Destinations {
+				destination, warning, err := checkRuleDestination(rule, dest, v.parser)
+				if err != nil {
+					v.errorf(group.location, "%v -> %v: %v", rule.Source, dest, err)
+					continue
+				}
+				if warning != "" {
+					v.warnf(group.location, "%v -> %v: %v", rule.Source, dest, warning)
+				}
+				useAuth(group.location, destination)
+			}
+		}
+	}
+
+	// rules are also checked together, e.g., repositories mapped from different sources should not collide
+	if !v.incomplete && v.merged != nil {
+		if _, err := types.NewImageList(v.merged, v.parser); err != nil {
+			v.errorf("", "%v", err)
+		}
+	}
+}
+
+// checkUnusedAuth reports the auth information which no source or destination matches.
+func (v *validator) checkUnusedAuth() {
+	for _, key := range v.authKeys {
+		if !v.usedAuth[key] {
+			v.warnf(v.authLocations[key], "auth information of %v is not used by any rule", key)
+		}
+	}
+}
+
+// checkRuleDestination checks the source and a destination of rule like a rule task does, except that the tags
+// listed from registries are unknown. It returns the destination repository url with wildcards replaced and
+// repository mapping applied, and a warning if the urls might not match at runtime.
+func checkRuleDestination(rule *types.Rule, destination string, parser *utils.URLParser) (string, string, error) {
+	source := rule.Source
+	if parser.IsWildcardURL(source) {
+		wildcard, err := parser.ParseWildcardURL(source)
+		if err != nil {
+			return "", "", err
+		}
+
+		repository := placeholderRepository
+		if wildcard.Namespace != "" {
+			repository = wildcard.Namespace + "/" + repository
+		}
+		source = wildcard.URL(repository)
+
+		if strings.Contains(destination, "*") {
+			destination = strings.Replace(destination, "*", placeholderRepository, 1)
+		} else if rule.RepositoryMapping != nil {
+			if destination, err = rule.RepositoryMapping.MapDestination(destination, repository); err != nil {
+				return "", "", fmt.Errorf("failed to map repository: %v", err)
+			}
+		}
+	} else if rule.RepositoryMapping != nil {
+		_, repository, err := parser.ParseRepositoryOfURL(source)
+		if err != nil {
+			return "", "", err
+		}
+
+		if destination, err = rule.RepositoryMapping.MapDestination(destination, repository); err != nil {
+			return "", "", fmt.Errorf("failed to map repository: %v", err)
+		}
+	}
+
+	sourceListed := false
+	sourceURLs, err := parser.GenerateRepoURLs(source, func(registry, repository string) ([]string, error) {
+		sourceListed = true
+		return nil, nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("source url format error: %v", err)
+	}
+
+	var destinationTags []string
+	for _, s := range sourceURLs {
+		if rule.TagTemplate != nil && s.HasDigest() {
+			return "", "", fmt.Errorf("tag template cannot be used with source digest %v", s.GetTagOrDigest())
+		}
+		destinationTags = append(destinationTags, s.GetTagOrDigest())
+	}
+
+	destinationListed := false
+	destinationURLs, err := parser.GenerateRepoURLs(destination, func(registry, repository string) ([]string, error) {
+		destinationListed = true
+		return destinationTags, nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("destination url format error: %v", err)
+	}
+
+	for _, d := range destinationURLs {
+		if d.GetPinnedDigest() != "" {
+			return "", "", fmt.Errorf("destination url should not pin a digest")
+		}
+	}
+
+	var warning string
+	switch {
+	case rule.TagTemplate != nil:
+		if !destinationListed {
+			return "", "", fmt.Errorf("destination url should not have tags or digest if tag template is used")
+		}
+	case !sourceListed:
+		if err = task.CheckSourceAndDestinationURLs(sourceURLs, destinationURLs); err != nil {
+			return "", "", err
+		}
+	case !destinationListed:
+		warning = "tags of source are listed from registry, the number of them must match the tags of destination"
+	}
+
+	return destination, warning, nil
+}
+
+// repositoryOf returns the registry and repository of an image url, or the registry and namespace of a wildcard url.
+func repositoryOf(url string, parser *utils.URLParser) (string, string, error) {
+	if parser.IsWildcardURL(url) {
+		wildcard, err := parser.ParseWildcardURL(url)
+		if err != nil {
+			return "", "", err
+		}
+		return wildcard.Registry, wildcard.Namespace, nil
+	}
+	return parser.ParseRepositoryOfURL(url)
+}
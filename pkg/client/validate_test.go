@@ -0,0 +1,214 @@
+package client
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	zeros, ones := strings.Repeat("0", 64), strings.Repeat("1", 64)
+	auth := `docker.io:
+  username: user
+  password: password
+registry.example.com:
+  username: user
+  password: password
+`
+
+	for _, c := range []struct {
+		name string
+		// files are written into a temporary directory, whose path takes the place of "$DIR" in expected problems
+		files                        map[string]string
+		configFile, authFile, images string
+		expected                     []Problem
+	}{
+		{
+			name: "valid files",
+			files: map[string]string{
+				"auth.yaml":   auth,
+				"images.yaml": "docker.io/library/nginx:1.25: registry.example.com/library/nginx\n",
+			},
+			authFile: "auth.yaml",
+			images:   "images.yaml",
+		},
+		{
+			name: "tags and digest mismatch",
+			files: map[string]string{
+				"auth.yaml": auth,
+				"images.yaml": `docker.io/library/nginx:1.25,1.26: registry.example.com/library/nginx:stable
+docker.io/library/redis@sha256:` + zeros + `: registry.example.com/library/redis@sha256:` + ones + `
+docker.io/library/python: registry.example.com/library/python:3.12
+`,
+			},
+			authFile: "auth.yaml",
+			images:   "images.yaml",
+			expected: []Problem{
+				{Location: "$DIR/images.yaml:1", Message: "docker.io/library/nginx:1.25,1.26 -> " +
+					"registry.example.com/library/nginx:stable: the number of tags of source and destination is not " +
+					"matched"},
+				{Location: "$DIR/images.yaml:2", Message: "docker.io/library/redis@sha256:" + zeros + " -> " +
+					"registry.example.com/library/redis@sha256:" + ones + ": the digest of source and destination " +
+					"must match"},
+				{Location: "$DIR/images.yaml:3", Warning: true, Message: "docker.io/library/python -> " +
+					"registry.example.com/library/python:3.12: tags of source are listed from registry, the number " +
+					"of them must match the tags of destination"},
+			},
+		},
+		{
+			name: "problems of all the files",
+			files: map[string]string{
+				"auth.yaml": auth,
+				"images/a.yaml": `docker.io/library/nginx:1.25: registry.example.com/library/nginx
+docker.io/library/redis:7: registry.example.com/library/redis
+`,
+				"images/b.yaml": `docker.io/library/redis:7: registry.example.com/mirror/redis
+docker.io/library/busybox:
+  platforms: [linux]
+  destinations: registry.example.com/library/busybox
+`,
+				"images/c.json": `{
+  "ghcr.io/org/app:v1": "registry.example.com/org/app"
+}
+`,
+			},
+			authFile: "auth.yaml",
+			images:   "images",
+			expected: []Problem{
+				{Location: "$DIR/images/b.yaml:1", Message: "rule docker.io/library/redis:7 is already defined at " +
+					"$DIR/images/a.yaml:2"},
+				{Location: "$DIR/images/b.yaml:2", Message: "invalid rule for source \"docker.io/library/busybox\": " +
+					"invalid platform linux, which should be os/arch[/variant]"},
+				{Location: "$DIR/images/c.json:2", Warning: true, Message: "no auth information matches " +
+					"ghcr.io/org/app, it will be accessed anonymously"},
+			},
+		},
+		{
+			name: "auth warnings",
+			files: map[string]string{
+				"auth.yaml": auth + `quay.io:
+  username: user
+  password: password
+`,
+				"images.yaml": `ghcr.io/org/app:v1: registry.example.com/org/app
+harbor.corp/platform/*: registry.example.com/platform/*
+`,
+			},
+			authFile: "auth.yaml",
+			images:   "images.yaml",
+			expected: []Problem{
+				{Location: "$DIR/images.yaml:1", Warning: true, Message: "no auth information matches " +
+					"ghcr.io/org/app, it will be accessed anonymously"},
+				{Location: "$DIR/images.yaml:2", Warning: true, Message: "no auth information matches " +
+					"harbor.corp/platform, it will be accessed anonymously"},
+				{Location: "$DIR/auth.yaml:1", Warning: true, Message: "auth information of docker.io is not used " +
+					"by any rule"},
+				{Location: "$DIR/auth.yaml:7", Warning: true, Message: "auth information of quay.io is not used " +
+					"by any rule"},
+			},
+		},
+		{
+			name: "no auth file",
+			files: map[string]string{
+				"images.yaml": "ghcr.io/org/app:v1: registry.example.com/org/app\n",
+			},
+			images: "images.yaml",
+		},
+		{
+			name: "registry served under a path prefix",
+			files: map[string]string{
+				"auth.yaml": `artifactory.example.com:
+  basePath: /artifactory/api/docker/docker-local
+registry.example.com:
+  username: user
+  password: password
+`,
+				"images.yaml": `artifactory.example.com/artifactory/api/docker/docker-local/team/*:
+  destinations: registry.example.com/team
+  repositoryMapping:
+    strip: 1
+artifactory.example.com/artifactory/api/docker/docker-local/team/app:v1:
+  destinations: registry.example.com
+  repositoryMapping:
+    strip: 2
+`,
+			},
+			authFile: "auth.yaml",
+			images:   "images.yaml",
+			// the repository is the part after base path
+			expected: []Problem{
+				{Location: "$DIR/images.yaml:5", Message: "failed to map repository for source " +
+					"\"artifactory.example.com/artifactory/api/docker/docker-local/team/app:v1\": cannot strip 2 " +
+					"components from repository team/app"},
+			},
+		},
+		{
+			name: "invalid auth",
+			files: map[string]string{
+				"auth.yaml": `registry.example.com/ns:
+  basePath: /v2/../x
+`,
+				"images.yaml": "docker.io/library/nginx:1.25: registry.example.com/ns/nginx\n",
+			},
+			authFile: "auth.yaml",
+			images:   "images.yaml",
+			expected: []Problem{
+				{Location: "$DIR/auth.yaml:1", Message: "invalid auth information of registry.example.com/ns: " +
+					"invalid base path \"v2/../x\""},
+				{Location: "$DIR/images.yaml:1", Warning: true, Message: "no auth information matches " +
+					"docker.io/library/nginx, it will be accessed anonymously"},
+			},
+		},
+		{
+			name: "deprecated config file",
+			files: map[string]string{
+				"config.yaml": `auth:
+  registry.example.com:
+    username: user
+    password: password
+images:
+  docker.io/library/nginx:1.25,1.26: registry.example.com/library/nginx:stable
+`,
+			},
+			configFile: "config.yaml",
+			// the line numbers of deprecated config file are unknown, and destinations with problems use no auth
+			expected: []Problem{
+				{Location: "$DIR/config.yaml", Warning: true, Message: "no auth information matches " +
+					"docker.io/library/nginx, it will be accessed anonymously"},
+				{Location: "$DIR/config.yaml", Message: "docker.io/library/nginx:1.25,1.26 -> " +
+					"registry.example.com/library/nginx:stable: the number of tags of source and destination is not " +
+					"matched"},
+				{Location: "$DIR/config.yaml", Warning: true, Message: "auth information of registry.example.com " +
+					"is not used by any rule"},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, c.files)
+
+			path := func(name string) string {
+				if name == "" {
+					return ""
+				}
+				return filepath.Join(dir, name)
+			}
+
+			var expected []Problem
+			for _, problem := range c.expected {
+				problem.Location = strings.ReplaceAll(problem.Location, "$DIR", dir)
+				problem.Message = strings.ReplaceAll(problem.Message, "$DIR", dir)
+				expected = append(expected, problem)
+			}
+
+			problems, err := Validate(path(c.configFile), path(c.authFile), path(c.images))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, problems)
+		})
+	}
+
+	_, err := Validate("", "auth.yaml", "")
+	assert.EqualError(t, err, "neither config.json nor images.json is provided")
+}
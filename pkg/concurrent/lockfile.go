@@ -0,0 +1,56 @@
+package concurrent
+
+import (
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+type Lockfile struct {
+	sync.Mutex
+	content *types.Lockfile
+}
+
+func NewLockfile(content *types.Lockfile) *Lockfile {
+	return &Lockfile{
+		content: content,
+	}
+}
+
+func (l *Lockfile) Add(source, destination string, manifestDigest, filteredDigest digest.Digest) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.content.Add(source, destination, manifestDigest, filteredDigest)
+}
+
+func (l *Lockfile) Get(source string) (types.LockedImage, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	image, exist := l.content.Images[source]
+	return image, exist
+}
+
+func (l *Lockfile) Tags(registry, repository string) []string {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.content.Tags(registry, repository)
+}
+
+func (l *Lockfile) Repositories(registry, namespace string) []string {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.content.Repositories(registry, namespace)
+}
+
+func (l *Lockfile) Content() *types.Lockfile {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.content
+}
@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// IsUnauthorized returns true if err is caused by a 401 response from registry.
+func IsUnauthorized(err error) bool {
+	var credentialErr docker.ErrUnauthorizedForCredentials
+	if errors.As(err, &credentialErr) {
+		return true
+	}
+
+	var codeErr errcode.Error
+	return errors.As(err, &codeErr) && codeErr.Code == errcode.ErrorCodeUnauthorized
+}
+
+// CheckAuth validates the credentials of auth by logging into registry with the token flow of "/v2/" endpoint.
+func CheckAuth(registry string, auth utilstypes.Auth) error {
+	ep, err := resolveEndpoint(registry, "", auth)
+	if err != nil {
+		return err
+	}
+
+	sysctx, err := newSystemContext(auth, ep)
+	if err != nil {
+		return err
+	}
+
+	if sysctx.DockerAuthConfig == nil {
+		return fmt.Errorf("username and password should not be empty")
+	}
+
+	return docker.CheckAuth(context.Background(), sysctx,
+		sysctx.DockerAuthConfig.Username, sysctx.DockerAuthConfig.Password, ep.registry)
+}
+
+// endpoint is the registry and repository accessed by containers/image, they are different from the origin ones
+// if registry is accessed through a gateway.
+type endpoint struct {
+	registry   string
+	repository string
+	// userAgent is not empty if registry is accessed through a gateway
+	userAgent string
+}
+
+// resolveEndpoint returns the endpoint of repository in registry with the settings of auth.
+func resolveEndpoint(registry, repository string, auth utilstypes.Auth) (endpoint, error) {
+	if !needGateway(registry, auth) {
+		return endpoint{registry: registry, repository: repository}, nil
+	}
+
+	g, err := getGateway(registry, auth)
+	if err != nil {
+		return endpoint{}, err
+	}
+
+	if registry == "docker.io" && repository != "" && !strings.Contains(repository, "/") {
+		// containers/image only normalizes official images of docker.io
+		repository = "library/" + repository
+	}
+
+	return endpoint{registry: g.address, repository: repository, userAgent: g.userAgent}, nil
+}
+
+// newSystemContext generates a SystemContext to access ep with the TLS settings and current credentials of auth.
+// If the credential provider of auth is nil, access to registry will be anonymous.
+func newSystemContext(auth utilstypes.Auth, ep endpoint) (*types.SystemContext, error) {
+	sysctx := &types.SystemContext{}
+	if ep.userAgent != "" {
+		// gateway is a http service, TLS settings are applied by gateway
+		sysctx.DockerInsecureSkipTLSVerify = types.OptionalBoolTrue
+		sysctx.DockerRegistryUserAgent = ep.userAgent
+	} else {
+		if auth.Insecure {
+			// registry is http service
+			sysctx.DockerInsecureSkipTLSVerify = types.OptionalBoolTrue
+		}
+
+		if hasCertFiles(auth) {
+			dir, err := certDir(auth)
+			if err != nil {
+				return nil, err
+			}
+			sysctx.DockerCertPath = dir
+		}
+	}
+
+	if auth.Credential != nil {
+		username, password, err := auth.Credential.Credentials()
+		if err != nil {
+			return nil, err
+		}
+
+		if username != "" && password != "" {
+			sysctx.DockerAuthConfig = &types.DockerAuthConfig{
+				Username: username,
+				Password: password,
+			}
+		}
+	}
+
+	return sysctx, nil
+}
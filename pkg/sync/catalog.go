@@ -0,0 +1,447 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution/registry/client/auth/challenge"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+const (
+	// RegistryCatalog lists repositories with the "/v2/_catalog" endpoint of distribution spec
+	RegistryCatalog = "registry"
+	// HarborCatalog lists repositories with the projects and repositories API of Harbor v2
+	HarborCatalog = "harbor"
+	// DockerHubCatalog lists repositories of a namespace with the API of hub.docker.com
+	DockerHubCatalog = "dockerhub"
+	// AzureCatalog lists repositories with the "/acr/v1/_catalog" endpoint of Azure Container Registry
+	AzureCatalog = "azure"
+
+	catalogPageSize = 100
+	catalogScope    = "registry:catalog:*"
+)
+
+var (
+	// dockerHubAPI is a variable for tests
+	dockerHubAPI = "https://hub.docker.com"
+
+	nextLinkRegexp = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+)
+
+// ListRepositories lists all the repositories of registry which are in namespace (or its sub-namespaces), all the
+// repositories of registry will be listed if namespace is empty. The API used is decided by the catalog of auth.
+func ListRepositories(registry, namespace string, auth utilstypes.Auth) ([]string, error) {
+	kind, err := catalogType(registry, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newCatalogClient(registry, kind, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	var repositories []string
+	switch kind {
+	case HarborCatalog:
+		repositories, err = c.listHarbor(namespace)
+	case DockerHubCatalog:
+		repositories, err = c.listDockerHub(namespace)
+	case AzureCatalog:
+		repositories, err = c.listCatalog("/acr/v1/_catalog")
+	default:
+		repositories, err = c.listCatalog("/v2/_catalog")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories of %v with %v catalog: %v", registry, kind, err)
+	}
+
+	var result []string
+	for _, repository := range repositories {
+		if namespace == "" || strings.HasPrefix(repository, namespace+"/") {
+			result = append(result, repository)
+		}
+	}
+	return result, nil
+}
+
+// catalogType returns the catalog API of registry, an empty registry means it is only validated.
+func catalogType(registry string, auth utilstypes.Auth) (string, error) {
+	switch auth.Catalog {
+	case RegistryCatalog, HarborCatalog, DockerHubCatalog, AzureCatalog:
+		return auth.Catalog, nil
+	case "":
+	default:
+		return "", fmt.Errorf("invalid catalog %q, should be %v, %v, %v or %v", auth.Catalog,
+			RegistryCatalog, HarborCatalog, DockerHubCatalog, AzureCatalog)
+	}
+
+	if registry == "docker.io" {
+		return DockerHubCatalog, nil
+	}
+	if strings.HasSuffix(registry, ".azurecr.io") {
+		return AzureCatalog, nil
+	}
+	return RegistryCatalog, nil
+}
+
+// catalogClient sends the requests of listing repositories with the TLS and network settings of registry.
+type catalogClient struct {
+	client  *http.Client
+	baseURL *url.URL
+	// pathPrefix is the path prefix which registry API is served under
+	pathPrefix string
+	auth       utilstypes.Auth
+
+	// authorization is the value of Authorization header got by login or token flow
+	authorization string
+}
+
+func newCatalogClient(registry, kind string, auth utilstypes.Auth) (*catalogClient, error) {
+	host, pathPrefix := utils.SplitRegistryHost(registry)
+	baseURL := &url.URL{Scheme: "https", Host: host}
+	if auth.PlainHTTP {
+		baseURL.Scheme = "http"
+	}
+
+	// hub.docker.com is verified with the system CAs
+	var tlsConfig *tls.Config
+	var err error
+	if kind == DockerHubCatalog {
+		baseURL, err = url.Parse(dockerHubAPI)
+	} else {
+		tlsConfig, err = newTLSConfig(auth)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := newTransport(auth, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &catalogClient{
+		client:     &http.Client{Transport: transport},
+		baseURL:    baseURL,
+		pathPrefix: pathPrefix,
+		auth:       auth,
+	}, nil
+}
+
+// credentials returns the username and password of registry, both are empty if access is anonymous.
+func (c *catalogClient) credentials() (string, string, error) {
+	if c.auth.Credential == nil {
+		return "", "", nil
+	}
+	return c.auth.Credential.Credentials()
+}
+
+// get sends a GET request to the url relative to base url of registry, the token flow of distribution spec will be
+// used if 401 is responded. A http url will be tried if registry is insecure and https fails.
+func (c *catalogClient) get(reference string) (*http.Response, error) {
+	if c.pathPrefix != "" && strings.HasPrefix(reference, "/") && !strings.HasPrefix(reference, c.pathPrefix+"/") {
+		reference = c.pathPrefix + reference
+	}
+
+	target, err := c.baseURL.Parse(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(http.MethodGet, target.String(), nil)
+	if err != nil && c.auth.Insecure && target.Scheme == "https" && target.Host == c.baseURL.Host {
+		c.baseURL.Scheme, target.Scheme = "http", "http"
+		resp, err = c.do(http.MethodGet, target.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && c.authorization == "" {
+		challenges := challenge.ResponseChallenges(resp)
+		_ = resp.Body.Close()
+
+		if c.authorization, err = c.authorize(challenges); err != nil {
+			return nil, err
+		}
+		return c.do(http.MethodGet, target.String(), nil)
+	}
+
+	return resp, nil
+}
+
+// do sends a request to target, the Authorization header is only sent to the host of registry which issues it,
+// rather than the other hosts which pages might link to.
+func (c *catalogClient) do(method, target string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.authorization != "" && req.URL.Host == c.baseURL.Host {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	return c.client.Do(req)
+}
+
+// authorize returns the Authorization header for the challenges of a 401 response.
+func (c *catalogClient) authorize(challenges []challenge.Challenge) (string, error) {
+	username, password, err := c.credentials()
+	if err != nil {
+		return "", err
+	}
+
+	for _, ch := range challenges {
+		switch ch.Scheme {
+		case "bearer":
+			return c.fetchToken(ch.Parameters, username, password)
+		case "basic":
+			if username == "" {
+				return "", fmt.Errorf("unauthorized: username and password are required")
+			}
+			req := &http.Request{Header: http.Header{}}
+			req.SetBasicAuth(username, password)
+			return req.Header.Get("Authorization"), nil
+		}
+	}
+	return "", fmt.Errorf("unauthorized: no supported authentication challenge")
+}
+
+// fetchToken gets a bearer token of catalog scope from the realm of challenge.
+func (c *catalogClient) fetchToken(parameters map[string]string, username, password string) (string, error) {
+	realm, err := url.Parse(parameters["realm"])
+	if err != nil || !realm.IsAbs() {
+		return "", fmt.Errorf("invalid token realm %q", parameters["realm"])
+	}
+
+	query := realm.Query()
+	if service := parameters["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", catalogScope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = decodeResponse(resp, &token); err != nil {
+		return "", fmt.Errorf("failed to get token from %v: %v", realm.Host, err)
+	}
+
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("empty token got from %v", realm.Host)
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// listCatalog lists repositories with the catalog endpoint of path, pages are followed by the "next" links.
+func (c *catalogClient) listCatalog(path string) ([]string, error) {
+	var result []string
+
+	next := path + "?n=" + strconv.Itoa(catalogPageSize)
+	for next != "" {
+		resp, err := c.get(next)
+		if err != nil {
+			return nil, err
+		}
+
+		next = ""
+		if match := nextLinkRegexp.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			next = match[1]
+		}
+
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		if err = decodeResponse(resp, &page); err != nil {
+			return nil, err
+		}
+		result = append(result, page.Repositories...)
+	}
+
+	return result, nil
+}
+
+// listHarbor lists repositories of the project which namespace is in, or all the projects if namespace is empty.
+func (c *catalogClient) listHarbor(namespace string) ([]string, error) {
+	username, password, err := c.credentials()
+	if err != nil {
+		return nil, err
+	}
+	if username != "" {
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(username, password)
+		c.authorization = req.Header.Get("Authorization")
+	}
+
+	var projects []string
+	if namespace != "" {
+		projects = []string{strings.SplitN(namespace, "/", 2)[0]}
+	} else {
+		if projects, err = c.listHarborNames("/api/v2.0/projects"); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []string
+	for _, project := range projects {
+		repositories, err := c.listHarborNames("/api/v2.0/projects/" + url.PathEscape(project) + "/repositories")
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, repositories...)
+	}
+	return result, nil
+}
+
+// listHarborNames lists the names of all the items in pages of a Harbor API.
+func (c *catalogClient) listHarborNames(path string) ([]string, error) {
+	var result []string
+
+	for page := 1; ; page++ {
+		resp, err := c.get(fmt.Sprintf("%v?page=%v&page_size=%v", path, page, catalogPageSize))
+		if err != nil {
+			return nil, err
+		}
+
+		var items []struct {
+			Name string `json:"name"`
+		}
+		if err = decodeResponse(resp, &items); err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			result = append(result, item.Name)
+		}
+		if len(items) < catalogPageSize {
+			return result, nil
+		}
+	}
+}
+
+// listDockerHub lists repositories of a namespace of Docker Hub, namespace is required because Docker Hub doesn't
+// list all the repositories.
+func (c *catalogClient) listDockerHub(namespace string) ([]string, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+	// Docker Hub has only one level of namespace
+	namespace = strings.SplitN(namespace, "/", 2)[0]
+
+	if err := c.loginDockerHub(); err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	next := fmt.Sprintf("/v2/repositories/%v/?page_size=%v", url.PathEscape(namespace), catalogPageSize)
+	for next != "" {
+		resp, err := c.get(next)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Next    string `json:"next"`
+			Results []struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"results"`
+		}
+		if err = decodeResponse(resp, &page); err != nil {
+			return nil, err
+		}
+
+		for _, item := range page.Results {
+			if item.Namespace == "" {
+				item.Namespace = namespace
+			}
+			result = append(result, item.Namespace+"/"+item.Name)
+		}
+		next = page.Next
+	}
+
+	return result, nil
+}
+
+// loginDockerHub gets a JWT of Docker Hub, so that private repositories will be listed too.
+func (c *catalogClient) loginDockerHub() error {
+	username, password, err := c.credentials()
+	if err != nil || username == "" {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{"username": username, "password": password})
+	if err != nil {
+		return err
+	}
+
+	target, err := c.baseURL.Parse("/v2/users/login")
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(http.MethodPost, target.String(), body)
+	if err != nil {
+		return err
+	}
+
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err = decodeResponse(resp, &token); err != nil {
+		return fmt.Errorf("failed to login Docker Hub: %v", err)
+	}
+	c.authorization = "Bearer " + token.Token
+	return nil
+}
+
+// decodeResponse decodes the json body of a successful response into v, the body is always closed.
+func decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %v from %v: %s", resp.Status, resp.Request.URL.Redacted(),
+			strings.TrimSpace(string(message)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response from %v: %v", resp.Request.URL.Redacted(), err)
+	}
+	return nil
+}
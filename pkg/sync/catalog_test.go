@@ -0,0 +1,196 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/auth"
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+func TestCatalogType(t *testing.T) {
+	for registry, expected := range map[string]string{
+		"docker.io":           DockerHubCatalog,
+		"example.azurecr.io":  AzureCatalog,
+		"harbor.example.com":  RegistryCatalog,
+		"registry.k8s.io:443": RegistryCatalog,
+	} {
+		kind, err := catalogType(registry, utilstypes.Auth{})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, kind, registry)
+	}
+
+	kind, err := catalogType("harbor.example.com", utilstypes.Auth{Catalog: HarborCatalog})
+	assert.NoError(t, err)
+	assert.Equal(t, HarborCatalog, kind)
+}
+
+func TestListRepositoriesWithCatalog(t *testing.T) {
+	repositories := []string{"library/nginx", "platform/api", "platform/team/web", "platformx/app"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "pass" || r.URL.Query().Get("scope") != catalogScope {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token": "secret"}`))
+	})
+	mux.HandleFunc("/v2/_catalog", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="http://%v/token",service="registry"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// one repository per page
+		index := 0
+		for i, repository := range repositories {
+			if repository == r.URL.Query().Get("last") {
+				index = i + 1
+			}
+		}
+		if index+1 < len(repositories) {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?last=%v&n=1>; rel="next"`, repositories[index]))
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]string{"repositories": repositories[index : index+1]})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+	authInfo := utilstypes.Auth{PlainHTTP: true, Credential: auth.NewStaticProvider("user", "pass", nil)}
+
+	result, err := ListRepositories(registry, "platform", authInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"platform/api", "platform/team/web"}, result)
+
+	result, err = ListRepositories(registry, "", authInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories, result)
+
+	_, err = ListRepositories(registry, "", utilstypes.Auth{PlainHTTP: true})
+	assert.Error(t, err)
+}
+
+func TestListRepositoriesCrossHostLink(t *testing.T) {
+	// authorization headers received by the other host
+	var authorizations []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		_ = json.NewEncoder(w).Encode(map[string][]string{"repositories": {"platform/web"}})
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, _, ok := r.BasicAuth(); !ok || username != "user" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%v/v2/_catalog?last=platform/api&n=1>; rel="next"`, other.URL))
+		_ = json.NewEncoder(w).Encode(map[string][]string{"repositories": {"platform/api"}})
+	}))
+	defer server.Close()
+
+	result, err := ListRepositories(strings.TrimPrefix(server.URL, "http://"), "", utilstypes.Auth{
+		PlainHTTP:  true,
+		Credential: auth.NewStaticProvider("user", "pass", nil),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"platform/api", "platform/web"}, result)
+
+	// credentials of registry are not sent to the host of next page
+	assert.Equal(t, []string{""}, authorizations)
+}
+
+func TestListRepositoriesWithHarbor(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2.0/projects", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name": "platform"}, {"name": "infra"}]`))
+	})
+	mux.HandleFunc("/api/v2.0/projects/", func(w http.ResponseWriter, r *http.Request) {
+		if username, _, ok := r.BasicAuth(); !ok || username != "user" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		project := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v2.0/projects/"), "/")[0]
+		var items []map[string]string
+		if r.URL.Query().Get("page") == "1" {
+			// a full page, so that the next page is requested
+			for i := 0; i < catalogPageSize; i++ {
+				items = append(items, map[string]string{"name": fmt.Sprintf("%v/app%03d", project, i)})
+			}
+		} else if r.URL.Query().Get("page") == "2" {
+			items = append(items, map[string]string{"name": project + "/team/web"})
+		}
+		_ = json.NewEncoder(w).Encode(items)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+	authInfo := utilstypes.Auth{PlainHTTP: true, Catalog: HarborCatalog,
+		Credential: auth.NewStaticProvider("user", "pass", nil)}
+
+	result, err := ListRepositories(registry, "platform/team", authInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"platform/team/web"}, result)
+
+	result, err = ListRepositories(registry, "", authInfo)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2*(catalogPageSize+1))
+	assert.Equal(t, "infra/app000", result[catalogPageSize+1])
+}
+
+func TestListRepositoriesWithDockerHub(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/users/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["password"] != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token": "jwt"}`))
+	})
+	mux.HandleFunc("/v2/repositories/bitnami/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer jwt" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("page") == "" {
+			_, _ = fmt.Fprintf(w, `{"next": "http://%v/v2/repositories/bitnami/?page=2", `+
+				`"results": [{"name": "redis", "namespace": "bitnami"}]}`, r.Host)
+			return
+		}
+		_, _ = w.Write([]byte(`{"next": null, "results": [{"name": "nginx", "namespace": "bitnami"}]}`))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	origin := dockerHubAPI
+	dockerHubAPI = server.URL
+	defer func() { dockerHubAPI = origin }()
+
+	result, err := ListRepositories("docker.io", "bitnami", utilstypes.Auth{
+		Credential: auth.NewStaticProvider("user", "pass", nil),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bitnami/redis", "bitnami/nginx"}, result)
+
+	_, err = ListRepositories("docker.io", "", utilstypes.Auth{})
+	assert.Error(t, err)
+}
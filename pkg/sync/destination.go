@@ -7,8 +7,9 @@ import (
 	"io"
 	"reflect"
 	"strings"
+	gosync "sync"
 
-	"github.com/AliyunContainerService/image-syncer/pkg/utils/auth"
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
 
 	"github.com/containers/image/v5/manifest"
 	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -21,11 +22,22 @@ import (
 
 // ImageDestination is a reference of a remote image we will push to
 type ImageDestination struct {
+	// lock protects destination, sysctx and superseded, destination and sysctx will be replaced while credentials
+	// are refreshed
+	lock gosync.RWMutex
+
 	ref         types.ImageReference
 	destination types.ImageDestination
 	ctx         context.Context
 	sysctx      *types.SystemContext
 
+	// superseded are the destinations replaced while credentials are refreshed, which might still be used by other
+	// goroutines, so they are closed by Close
+	superseded []types.ImageDestination
+
+	auth     utilstypes.Auth
+	endpoint endpoint
+
 	// destination image description
 	registry    string
 	repository  string
@@ -33,48 +45,30 @@ type ImageDestination struct {
 }
 
 // NewImageDestination generates an ImageDestination by repository, the repository string must include tag or digest.
-// If username or password is empty, access to repository will be anonymous.
-func NewImageDestination(registry, repository, tagOrDigest, username, password string, insecure bool) (*ImageDestination, error) {
+// If the credential provider of auth is nil, access to repository will be anonymous.
+func NewImageDestination(registry, repository, tagOrDigest string, auth utilstypes.Auth) (*ImageDestination, error) {
 	if strings.Contains(repository, ":") {
 		return nil, fmt.Errorf("repository string should not include ':'")
 	}
 
 	// if tagOrDigest is empty, will attach to the "latest" tag
-	destRef, err := docker.ParseReference("//" + registry + "/" + repository + utils.AttachConnectorToTagOrDigest(tagOrDigest))
+	ep, err := resolveEndpoint(registry, repository, auth)
 	if err != nil {
 		return nil, err
 	}
 
-	var sysctx *types.SystemContext
-	if insecure {
-		// destination registry is http service
-		sysctx = &types.SystemContext{
-			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
-		}
-	} else {
-		sysctx = &types.SystemContext{}
+	destRef, err := docker.ParseReference("//" + ep.registry + "/" + ep.repository + utils.AttachConnectorToTagOrDigest(tagOrDigest))
+	if err != nil {
+		return nil, err
 	}
 
-	ctx := context.WithValue(context.Background(), utils.CTXKey("ImageDestination"), repository)
-	if username != "" && password != "" {
-		//fmt.Printf("Credential processing for %s/%s ...\n", registry, repository)
-		if auth.IsGCRPermanentServiceAccountToken(registry, username) {
-			fmt.Printf("Getting oauth2 token for %s...\n", username)
-			token, expiry, err := auth.GCPTokenFromCreds(password)
-			if err != nil {
-				return nil, err
-			}
-
-			fmt.Printf("oauth2 token expiry: %s\n", expiry)
-			password = token
-			username = "oauth2accesstoken"
-		}
-		sysctx.DockerAuthConfig = &types.DockerAuthConfig{
-			Username: username,
-			Password: password,
-		}
+	sysctx, err := newSystemContext(auth, ep)
+	if err != nil {
+		return nil, err
 	}
 
+	ctx := context.WithValue(context.Background(), utils.CTXKey("ImageDestination"), repository)
+
 	destination, err := destRef.NewImageDestination(ctx, sysctx)
 	if err != nil {
 		return nil, err
@@ -85,6 +79,8 @@ func NewImageDestination(registry, repository, tagOrDigest, username, password s
 		destination: destination,
 		ctx:         ctx,
 		sysctx:      sysctx,
+		auth:        auth,
+		endpoint:    ep,
 		registry:    registry,
 		repository:  repository,
 		tagOrDigest: tagOrDigest,
@@ -95,7 +91,9 @@ func NewImageDestination(registry, repository, tagOrDigest, username, password s
 // If instanceDigest is not nil, it contains a digest of the specific manifest instance to write the manifest for
 // (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
 func (i *ImageDestination) PushManifest(manifestByte []byte, instanceDigest *digest.Digest) error {
-	return i.destination.PutManifest(i.ctx, manifestByte, instanceDigest)
+	return i.withCredentialRetry(func(destination types.ImageDestination, _ *types.SystemContext) error {
+		return destination.PutManifest(i.ctx, manifestByte, instanceDigest)
+	})
 }
 
 // CheckManifestChanged checks if manifest of specified tag or digest has changed.
@@ -109,7 +107,7 @@ func (i *ImageDestination) GetManifest(instanceDigest *digest.Digest) []byte {
 	var srcRef types.ImageReference
 
 	if instanceDigest != nil {
-		manifestURL := i.registry + "/" + i.repository + utils.AttachConnectorToTagOrDigest(instanceDigest.String())
+		manifestURL := i.endpoint.registry + "/" + i.endpoint.repository + utils.AttachConnectorToTagOrDigest(instanceDigest.String())
 
 		// create source to check manifest
 		srcRef, err = docker.ParseReference("//" + manifestURL)
@@ -120,15 +118,20 @@ func (i *ImageDestination) GetManifest(instanceDigest *digest.Digest) []byte {
 		srcRef = i.ref
 	}
 
-	source, err := srcRef.NewImageSource(i.ctx, i.sysctx)
-	if err != nil {
-		// if the source cannot be created, manifest not exist
-		return nil
-	}
+	var tManifestByte []byte
+	var mineType string
+	err = i.withCredentialRetry(func(_ types.ImageDestination, sysctx *types.SystemContext) error {
+		source, err := srcRef.NewImageSource(i.ctx, sysctx)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
 
-	tManifestByte, mineType, err := source.GetManifest(i.ctx, instanceDigest)
+		tManifestByte, mineType, err = source.GetManifest(i.ctx, instanceDigest)
+		return err
+	})
 	if err != nil {
-		// if error happens, it's considered that the manifest not exist
+		// if the source cannot be created or error happens, it's considered that the manifest not exist
 		return nil
 	}
 
@@ -166,34 +169,110 @@ func (i *ImageDestination) GetManifest(instanceDigest *digest.Digest) []byte {
 	return tManifestByte
 }
 
-// PutABlob push a blob to destination image
+// PutABlob push a blob to destination image.
+// The blob cannot be read again if a 401 response is got, so the credentials will be refreshed without retry,
+// and caller should get the blob again and retry if IsUnauthorized(err) is true.
 func (i *ImageDestination) PutABlob(blob io.ReadCloser, blobInfo types.BlobInfo) error {
-	_, err := i.destination.PutBlob(i.ctx, blob, types.BlobInfo{
+	// io.ReadCloser need to be close
+	defer blob.Close()
+
+	i.lock.RLock()
+	destination, sysctx := i.destination, i.sysctx
+	i.lock.RUnlock()
+
+	_, err := destination.PutBlob(i.ctx, blob, types.BlobInfo{
 		Digest: blobInfo.Digest,
 		Size:   blobInfo.Size,
 	}, NoCache, true)
 
-	// io.ReadCloser need to be close
-	defer blob.Close()
+	if err != nil && i.auth.Credential != nil && IsUnauthorized(err) {
+		if refreshErr := i.refreshCredential(sysctx); refreshErr != nil {
+			return fmt.Errorf("%v, and failed to refresh credentials: %v", err, refreshErr)
+		}
+	}
 
 	return err
 }
 
 // CheckBlobExist checks if a blob exist for destination and reuse exist blobs
 func (i *ImageDestination) CheckBlobExist(blobInfo types.BlobInfo) (bool, error) {
-	exist, _, err := i.destination.TryReusingBlob(i.ctx, types.BlobInfo{
-		Digest: blobInfo.Digest,
-		Size:   blobInfo.Size,
-	}, NoCache, false)
+	var exist bool
+	err := i.withCredentialRetry(func(destination types.ImageDestination, _ *types.SystemContext) error {
+		var err error
+		exist, _, err = destination.TryReusingBlob(i.ctx, types.BlobInfo{
+			Digest: blobInfo.Digest,
+			Size:   blobInfo.Size,
+		}, NoCache, false)
+		return err
+	})
 
 	return exist, err
 }
 
-// Close a ImageDestination
+// Close a ImageDestination, the destinations superseded by refreshed credentials are closed too
 func (i *ImageDestination) Close() error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for _, destination := range i.superseded {
+		_ = destination.Close()
+	}
+	i.superseded = nil
+
 	return i.destination.Close()
 }
 
+// withCredentialRetry calls f with the current destination and SystemContext. If f fails because of a 401 response,
+// the cached credentials will be invalidated and refreshed, then f will be retried once.
+func (i *ImageDestination) withCredentialRetry(f func(destination types.ImageDestination, sysctx *types.SystemContext) error) error {
+	i.lock.RLock()
+	destination, sysctx := i.destination, i.sysctx
+	i.lock.RUnlock()
+
+	err := f(destination, sysctx)
+	if err == nil || i.auth.Credential == nil || !IsUnauthorized(err) {
+		return err
+	}
+
+	if refreshErr := i.refreshCredential(sysctx); refreshErr != nil {
+		return fmt.Errorf("%v, and failed to refresh credentials: %v", err, refreshErr)
+	}
+
+	i.lock.RLock()
+	destination, sysctx = i.destination, i.sysctx
+	i.lock.RUnlock()
+
+	return f(destination, sysctx)
+}
+
+// refreshCredential re-creates SystemContext and destination with new credentials, stale is the SystemContext which
+// got a 401 response, nothing will be done if it has been replaced by another goroutine.
+func (i *ImageDestination) refreshCredential(stale *types.SystemContext) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.sysctx != stale {
+		return nil
+	}
+
+	i.auth.Credential.Invalidate()
+	sysctx, err := newSystemContext(i.auth, i.endpoint)
+	if err != nil {
+		return err
+	}
+
+	destination, err := i.ref.NewImageDestination(i.ctx, sysctx)
+	if err != nil {
+		return err
+	}
+
+	// the old destination is closed by Close because it might still be used by other goroutines
+	i.superseded = append(i.superseded, i.destination)
+	i.destination = destination
+	i.sysctx = sysctx
+	return nil
+}
+
 // GetRegistry returns the registry of a ImageDestination
 func (i *ImageDestination) GetRegistry() string {
 	return i.registry
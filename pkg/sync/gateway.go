@@ -0,0 +1,310 @@
+package sync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+const (
+	// requests to other hosts, such as token servers and blob storages registry redirects to, are sent to
+	// "/_external/<scheme>/<host>/<path>" of gateway
+	externalPathPrefix = "/_external/"
+
+	gatewayUserAgent = "image-syncer"
+)
+
+var (
+	// gateways caches the running gateways, keyed by registry and the settings gateway depends on
+	gateways     = map[string]*gateway{}
+	gatewaysLock gosync.Mutex
+
+	realmRegexp = regexp.MustCompile(`realm="([^"]*)"`)
+)
+
+// gateway is a loopback reverse proxy of a registry. The docker transport of containers/image can only be configured
+// with CA and client certificates, so registries with other TLS or network settings are accessed through a gateway,
+// which talks plain HTTP with containers/image and forwards requests to the registry with its own transport.
+//
+// Token realms and redirect locations of responses are rewritten to the gateway, so that all the traffic of the
+// registry goes through the same transport. Only requests with the random user agent of gateway are accepted,
+// because gateway presents the client certificate of registry for every request it forwards.
+//
+// All the hosts share the origin of gateway, so clients no longer drop credentials when they are redirected to
+// another host. Credentials are only forwarded to registry and its token realms, and never to the hosts which blobs
+// are redirected to, e.g., presigned urls of S3 or CDN.
+type gateway struct {
+	upstream  *url.URL
+	address   string
+	userAgent string
+
+	// realms are the external token endpoints (scheme://host/path) rewritten from WWW-Authenticate headers
+	realms     map[string]bool
+	realmsLock gosync.Mutex
+
+	registryTransport http.RoundTripper
+	externalTransport http.RoundTripper
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// needGateway returns true if registry should be accessed through a gateway with the settings of auth, registries
+// served under a path prefix and IPv6 literal hosts are always accessed through a gateway because containers/image
+// cannot express them.
+func needGateway(registry string, auth utilstypes.Auth) bool {
+	host, pathPrefix := utils.SplitRegistryHost(registry)
+	return pathPrefix != "" || strings.HasPrefix(host, "[") ||
+		auth.ServerName != "" || auth.MinTLSVersion != "" || hasNetworkSettings(auth)
+}
+
+// getGateway returns the running gateway of registry, a new one will be started if not exist.
+func getGateway(registry string, auth utilstypes.Auth) (*gateway, error) {
+	// gateways are shared by the auth entries with the same settings
+	settings := auth
+	settings.Username, settings.Password, settings.Credential = "", "", nil
+	key := fmt.Sprintf("%v\x00%+v", registry, settings)
+
+	gatewaysLock.Lock()
+	defer gatewaysLock.Unlock()
+
+	if g, exist := gateways[key]; exist {
+		return g, nil
+	}
+
+	g, err := newGateway(registry, auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start gateway of %v: %v", registry, err)
+	}
+
+	gateways[key] = g
+	return g, nil
+}
+
+func newGateway(registry string, auth utilstypes.Auth) (*gateway, error) {
+	tlsConfig, err := newTLSConfig(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	host, pathPrefix := utils.SplitRegistryHost(registry)
+	if host == "docker.io" {
+		// the same as containers/image
+		host = "registry-1.docker.io"
+	}
+
+	token := make([]byte, 16)
+	if _, err = rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	registryTransport, err := newTransport(auth, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// token servers and blob storages share the proxy, resolve and timeout settings of registry
+	externalTransport, err := newTransport(auth, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "https"
+	if auth.PlainHTTP {
+		scheme = "http"
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	g := &gateway{
+		upstream:          &url.URL{Scheme: scheme, Host: host, Path: pathPrefix},
+		address:           listener.Addr().String(),
+		userAgent:         gatewayUserAgent + "/" + hex.EncodeToString(token),
+		registryTransport: registryTransport,
+		externalTransport: externalTransport,
+		listener:          listener,
+	}
+
+	g.server = &http.Server{
+		Handler:           g,
+		ReadHeaderTimeout: time.Minute,
+	}
+
+	go func() {
+		if err := g.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("Gateway of %v stopped: %v", registry, err)
+		}
+	}()
+
+	return g, nil
+}
+
+// ServeHTTP implements http.Handler
+func (g *gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.UserAgent() != g.userAgent {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	target, err := g.targetURL(req.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(out *http.Request) {
+			out.URL = target
+			out.Host = target.Host
+			out.Header.Set("User-Agent", gatewayUserAgent)
+			out.Header.Del("X-Forwarded-For")
+
+			if target.Host != g.upstream.Host && !g.isRealm(target) {
+				out.Header.Del("Authorization")
+				out.Header.Del("Cookie")
+			}
+		},
+		Transport:      g,
+		ModifyResponse: g.modifyResponse,
+		FlushInterval:  -1,
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, req)
+}
+
+// RoundTrip implements http.RoundTripper, requests to registry are sent with the transport of registry.
+func (g *gateway) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == g.upstream.Scheme && req.URL.Host == g.upstream.Host {
+		return g.registryTransport.RoundTrip(req)
+	}
+	return g.externalTransport.RoundTrip(req)
+}
+
+// targetURL converts the url of a request to gateway into the url to be forwarded.
+func (g *gateway) targetURL(reqURL *url.URL) (*url.URL, error) {
+	target := *reqURL
+	target.Scheme, target.Host = g.upstream.Scheme, g.upstream.Host
+	target.Path, target.RawPath = g.upstream.Path+reqURL.Path, ""
+
+	if rest, ok := strings.CutPrefix(reqURL.Path, externalPathPrefix); ok {
+		parts := strings.SplitN(rest, "/", 3)
+		if len(parts) < 2 || (parts[0] != "http" && parts[0] != "https") || parts[1] == "" {
+			return nil, fmt.Errorf("invalid external path %v", reqURL.Path)
+		}
+
+		target.Scheme, target.Host, target.Path = parts[0], parts[1], "/"
+		if len(parts) == 3 {
+			target.Path += parts[2]
+		}
+		target.RawPath = ""
+	}
+
+	return &target, nil
+}
+
+// gatewayURL converts a url of registry or external hosts into the url of gateway.
+func (g *gateway) gatewayURL(target *url.URL) string {
+	result := url.URL{
+		Scheme:   "http",
+		Host:     g.address,
+		Path:     target.Path,
+		RawQuery: target.RawQuery,
+	}
+
+	// paths of registry outside its path prefix are accessed as the ones of external hosts
+	internal := target.Scheme == g.upstream.Scheme && target.Host == g.upstream.Host
+	if internal && g.upstream.Path != "" {
+		result.Path, internal = strings.CutPrefix(target.Path, g.upstream.Path+"/")
+		result.Path = "/" + result.Path
+	}
+
+	if !internal {
+		result.Path = externalPathPrefix + target.Scheme + "/" + target.Host + target.Path
+	}
+
+	return result.String()
+}
+
+// modifyResponse rewrites the redirect location and token realm of a response to gateway.
+func (g *gateway) modifyResponse(resp *http.Response) error {
+	if location := resp.Header.Get("Location"); location != "" {
+		if locationURL, err := resp.Request.URL.Parse(location); err == nil {
+			resp.Header.Set("Location", g.gatewayURL(locationURL))
+		}
+	}
+
+	if values := resp.Header.Values("WWW-Authenticate"); len(values) != 0 {
+		resp.Header.Del("WWW-Authenticate")
+		for _, value := range values {
+			value = realmRegexp.ReplaceAllStringFunc(value, func(realm string) string {
+				realmURL, err := url.Parse(realmRegexp.FindStringSubmatch(realm)[1])
+				if err != nil || !realmURL.IsAbs() {
+					return realm
+				}
+				g.addRealm(realmURL)
+				return `realm="` + g.gatewayURL(realmURL) + `"`
+			})
+			resp.Header.Add("WWW-Authenticate", value)
+		}
+	}
+
+	return nil
+}
+
+// addRealm records a token endpoint, which basic auth credentials are forwarded to.
+func (g *gateway) addRealm(realmURL *url.URL) {
+	g.realmsLock.Lock()
+	defer g.realmsLock.Unlock()
+
+	if g.realms == nil {
+		g.realms = map[string]bool{}
+	}
+	g.realms[realmKey(realmURL)] = true
+}
+
+// isRealm returns true if target is a token endpoint of registry.
+func (g *gateway) isRealm(target *url.URL) bool {
+	g.realmsLock.Lock()
+	defer g.realmsLock.Unlock()
+
+	return g.realms[realmKey(target)]
+}
+
+func realmKey(target *url.URL) string {
+	return target.Scheme + "://" + target.Host + target.Path
+}
+
+func (g *gateway) close() error {
+	return g.server.Close()
+}
+
+// Cleanup stops all the gateways and removes the temporary files generated for TLS settings of registries,
+// it should be called after all the sync tasks are finished.
+func Cleanup() {
+	gatewaysLock.Lock()
+	for key, g := range gateways {
+		_ = g.close()
+		delete(gateways, key)
+	}
+	gatewaysLock.Unlock()
+
+	removeCertDirs()
+}
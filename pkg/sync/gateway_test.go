@@ -0,0 +1,232 @@
+package sync
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+func newTestRegistry(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			_, _ = w.Write([]byte(`{"token": "test-token"}`))
+		case "/v2/", "/v2/library/test/tags/list":
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="test"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+			_, _ = w.Write([]byte(`{"name": "library/test", "tags": ["v1", "v2"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	server.TLS = &tls.Config{MinVersion: tls.VersionTLS13}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	for _, version := range []string{"1.2", "TLS1.2", "tls12", "v1.2"} {
+		value, err := ParseTLSVersion(version)
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(tls.VersionTLS12), value)
+	}
+
+	_, err := ParseTLSVersion("1.4")
+	assert.Error(t, err)
+}
+
+func writeCAFile(t *testing.T, server *httptest.Server) string {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0600))
+	return caFile
+}
+
+func TestCAFileWithoutGateway(t *testing.T) {
+	server := newTestRegistry(t)
+	defer Cleanup()
+
+	registry := server.Listener.Addr().String()
+	source, err := NewImageSource(registry, "library/test", "", utilstypes.Auth{CAFile: writeCAFile(t, server)})
+	assert.NoError(t, err)
+	assert.Equal(t, registry, source.endpoint.registry)
+
+	tags, err := source.GetSourceRepoTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1", "v2"}, tags)
+
+	// certificate of server is not trusted
+	source, err = NewImageSource(registry, "library/test", "", utilstypes.Auth{})
+	assert.NoError(t, err)
+	_, err = source.GetSourceRepoTags()
+	assert.Error(t, err)
+}
+
+func TestGatewayWithServerName(t *testing.T) {
+	server := newTestRegistry(t)
+	defer Cleanup()
+
+	caFile := writeCAFile(t, server)
+	registry := server.Listener.Addr().String()
+	auth := utilstypes.Auth{
+		CAFile: caFile,
+		// the certificate of httptest server is issued to example.com and 127.0.0.1
+		ServerName:    "example.com",
+		MinTLSVersion: "1.3",
+	}
+
+	source, err := NewImageSource(registry, "library/test", "", auth)
+	assert.NoError(t, err)
+	assert.Equal(t, registry, source.GetRegistry())
+	assert.NotEqual(t, registry, source.endpoint.registry)
+
+	tags, err := source.GetSourceRepoTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1", "v2"}, tags)
+
+	// certificate is not valid for the server name
+	auth.ServerName = "invalid.example.org"
+	source, err = NewImageSource(registry, "library/test", "", auth)
+	assert.NoError(t, err)
+	_, err = source.GetSourceRepoTags()
+	assert.Error(t, err)
+
+	// requests without the user agent of gateway are rejected
+	resp, err := http.Get("http://" + source.endpoint.registry + "/v2/")
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestGatewayRewrite(t *testing.T) {
+	g := &gateway{
+		upstream: mustParseURL(t, "https://registry.example.com"),
+		address:  "127.0.0.1:5000",
+	}
+
+	assert.Equal(t, "http://127.0.0.1:5000/v2/test/blobs/uploads/1?state=x",
+		g.gatewayURL(mustParseURL(t, "https://registry.example.com/v2/test/blobs/uploads/1?state=x")))
+	assert.Equal(t, "http://127.0.0.1:5000/_external/https/auth.example.com/token",
+		g.gatewayURL(mustParseURL(t, "https://auth.example.com/token")))
+
+	target, err := g.targetURL(mustParseURL(t, "/_external/https/auth.example.com/token?scope=pull"))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://auth.example.com/token?scope=pull", target.String())
+
+	target, err = g.targetURL(mustParseURL(t, "/v2/"))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://registry.example.com/v2/", target.String())
+
+	_, err = g.targetURL(mustParseURL(t, "/_external/ftp/example.com/"))
+	assert.Error(t, err)
+}
+
+func TestGatewayRewriteWithPathPrefix(t *testing.T) {
+	g := &gateway{
+		upstream: mustParseURL(t, "https://artifactory.example.com/artifactory/api/docker/docker-local"),
+		address:  "127.0.0.1:5000",
+	}
+
+	target, err := g.targetURL(mustParseURL(t, "/v2/team/app/manifests/v1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://artifactory.example.com/artifactory/api/docker/docker-local/v2/team/app/manifests/v1",
+		target.String())
+
+	assert.Equal(t, "http://127.0.0.1:5000/v2/token",
+		g.gatewayURL(mustParseURL(t, "https://artifactory.example.com/artifactory/api/docker/docker-local/v2/token")))
+	// paths outside the prefix are forwarded as external ones
+	assert.Equal(t, "http://127.0.0.1:5000/_external/https/artifactory.example.com/artifactory/api/docker/null/v2/token",
+		g.gatewayURL(mustParseURL(t, "https://artifactory.example.com/artifactory/api/docker/null/v2/token")))
+
+	target, err = g.targetURL(mustParseURL(t, "/_external/https/artifactory.example.com/artifactory/api/docker/null/v2/token"))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://artifactory.example.com/artifactory/api/docker/null/v2/token", target.String())
+
+	assert.True(t, needGateway("[fd00::1]:5000", utilstypes.Auth{}))
+	assert.False(t, needGateway("registry.example.com", utilstypes.Auth{}))
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	result, err := url.Parse(rawURL)
+	assert.NoError(t, err)
+	return result
+}
+
+func TestGatewayStripsCredentialsOnRedirect(t *testing.T) {
+	headers := map[string]string{}
+	record := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			headers[name] = r.Header.Get("Authorization")
+			_, _ = w.Write([]byte(name))
+		}
+	}
+
+	storage := httptest.NewServer(record("storage"))
+	defer storage.Close()
+	tokenServer := httptest.NewServer(record("token"))
+	defer tokenServer.Close()
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers["registry"] = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="test"`,
+				tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/v2/library/test/blobs/sha256:test":
+			// presigned url of blob storage
+			http.Redirect(w, r, storage.URL+"/blob?signature=test", http.StatusTemporaryRedirect)
+		}
+	}))
+	defer registry.Close()
+	defer Cleanup()
+
+	g, err := getGateway(registry.Listener.Addr().String(), utilstypes.Auth{PlainHTTP: true})
+	assert.NoError(t, err)
+
+	get := func(url string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		assert.NoError(t, err)
+		req.Header.Set("User-Agent", g.userAgent)
+		req.Header.Set("Authorization", "Basic secret")
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	// credentials are forwarded to the token realm of registry
+	resp := get("http://" + g.address + "/v2/")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	realm := realmRegexp.FindStringSubmatch(resp.Header.Get("WWW-Authenticate"))[1]
+	get(realm)
+	assert.Equal(t, "Basic secret", headers["token"])
+
+	// but not to the blob storage which registry redirects to
+	resp = get("http://" + g.address + "/v2/library/test/blobs/sha256:test")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Basic secret", headers["registry"])
+	_, requested := headers["storage"]
+	assert.True(t, requested)
+	assert.Equal(t, "", headers["storage"])
+}
@@ -1,15 +1,21 @@
 package sync
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
 	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/tidwall/gjson"
+
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
 )
 
 type ManifestInfo struct {
@@ -27,8 +33,12 @@ type ManifestInfo struct {
 // For list type manifest, the origin manifest info might be modified because of platform filters, and a nil manifest
 // object will be returned if no sub manifest need to transport.
 // For non-list type manifests, which doesn't match the filters, a nil manifest object will be returned.
-func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList, archFilterList []string,
-	i *ImageSource, parent *manifest.Schema2List) (interface{}, []byte, []*ManifestInfo, error) {
+// The "os/arch[/variant]" selectors of platformFilterList are checked together with osFilterList and archFilterList.
+// If metadataFilter is not nil, non-list type manifests which don't pass it cause a *FilteredError, and sub manifests
+// which don't pass it are removed from list type manifests.
+func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList, archFilterList,
+	platformFilterList []string, metadataFilter *utilstypes.MetadataFilter, i *ImageSource,
+	parent *manifest.Schema2List) (interface{}, []byte, []*ManifestInfo, error) {
 
 	switch manifestType {
 	case manifest.DockerV2Schema2MediaType:
@@ -38,22 +48,22 @@ func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList
 		}
 
 		// platform info stored in config blob
-		if parent == nil && manifestObj.ConfigInfo().Digest != "" {
-			blob, _, err := i.GetABlob(manifestObj.ConfigInfo())
-			if err != nil {
-				return nil, nil, nil, err
-			}
-			defer blob.Close()
-			bytes, err := io.ReadAll(blob)
+		if (parent == nil || metadataFilter != nil) && manifestObj.ConfigInfo().Digest != "" {
+			bytes, err := getConfigBlob(i, manifestObj.ConfigInfo())
 			if err != nil {
 				return nil, nil, nil, err
 			}
-			results := gjson.GetManyBytes(bytes, "architecture", "os")
+			results := gjson.GetManyBytes(bytes, "architecture", "os", "variant")
 
-			if !platformValidate(osFilterList, archFilterList,
-				&manifest.Schema2PlatformSpec{Architecture: results[0].String(), OS: results[1].String()}) {
+			if parent == nil && !platformValidate(osFilterList, archFilterList, platformFilterList,
+				&manifest.Schema2PlatformSpec{Architecture: results[0].String(), OS: results[1].String(),
+					Variant: results[2].String()}) {
 				return nil, nil, nil, nil
 			}
+
+			if err = checkMetadata(metadataFilter, bytes, manifestObj.LayerInfos()); err != nil {
+				return nil, nil, nil, err
+			}
 		}
 
 		return manifestObj, manifestBytes, nil, nil
@@ -64,11 +74,16 @@ func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList
 		}
 
 		// v1 only support architecture and this field is for information purposes and not currently used by the engine.
-		if parent == nil && !platformValidate(osFilterList, archFilterList,
+		if parent == nil && !platformValidate(osFilterList, archFilterList, platformFilterList,
 			&manifest.Schema2PlatformSpec{Architecture: manifestObj.Architecture}) {
 			return nil, nil, nil, nil
 		}
 
+		// v1 has no config blob
+		if metadataFilter != nil {
+			return nil, nil, nil, &FilteredError{reason: "metadata filters are not supported by docker v2 schema1 manifest"}
+		}
+
 		return manifestObj, manifestBytes, nil, nil
 	case specsv1.MediaTypeImageManifest:
 		//TODO: platform filter?
@@ -76,6 +91,18 @@ func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList
 		if err != nil {
 			return nil, nil, nil, err
 		}
+
+		if metadataFilter != nil {
+			bytes, err := getConfigBlob(i, manifestObj.ConfigInfo())
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			if err = checkMetadata(metadataFilter, bytes, manifestObj.LayerInfos()); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
 		return manifestObj, manifestBytes, nil, nil
 	case manifest.DockerV2ListMediaType:
 		var subManifestInfoSlice []*ManifestInfo
@@ -86,26 +113,30 @@ func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList
 		}
 
 		var filteredDescriptors []manifest.Schema2ManifestDescriptor
+		var filteredErr *FilteredError
 
 		for index, manifestDescriptorElem := range manifestSchemaListObj.Manifests {
 			// select os and arch
-			if !platformValidate(osFilterList, archFilterList, &manifestDescriptorElem.Platform) {
+			if !platformValidate(osFilterList, archFilterList, platformFilterList, &manifestDescriptorElem.Platform) {
 				continue
 			}
 
-			filteredDescriptors = append(filteredDescriptors, manifestDescriptorElem)
-			mfstBytes, mfstType, err := i.source.GetManifest(i.ctx, &manifestDescriptorElem.Digest)
+			mfstBytes, mfstType, err := i.getManifest(&manifestDescriptorElem.Digest)
 			if err != nil {
 				return nil, nil, nil, err
 			}
 
 			//TODO: will the sub manifest be list-type?
 			subManifest, _, _, err := GenerateManifestObj(mfstBytes, mfstType,
-				archFilterList, osFilterList, i, manifestSchemaListObj)
+				osFilterList, archFilterList, platformFilterList, metadataFilter, i, manifestSchemaListObj)
+			if errors.As(err, &filteredErr) {
+				continue
+			}
 			if err != nil {
 				return nil, nil, nil, err
 			}
 
+			filteredDescriptors = append(filteredDescriptors, manifestDescriptorElem)
 			if subManifest != nil {
 				subManifestInfoSlice = append(subManifestInfoSlice, &ManifestInfo{
 					Obj: subManifest.(manifest.Manifest),
@@ -119,6 +150,9 @@ func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList
 
 		// no sub manifests need to transport
 		if len(filteredDescriptors) == 0 {
+			if filteredErr != nil {
+				return nil, nil, nil, filteredErr
+			}
 			return nil, nil, nil, nil
 		}
 
@@ -139,30 +173,35 @@ func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList
 		}
 
 		var filteredDescriptors []specsv1.Descriptor
+		var filteredErr *FilteredError
 
 		for index, descriptor := range ociIndexesObj.Manifests {
 			// select os and arch
-			if !platformValidate(osFilterList, archFilterList, &manifest.Schema2PlatformSpec{
+			if !platformValidate(osFilterList, archFilterList, platformFilterList, &manifest.Schema2PlatformSpec{
 				Architecture: descriptor.Platform.Architecture,
 				OS:           descriptor.Platform.OS,
+				Variant:      descriptor.Platform.Variant,
 			}) {
 				continue
 			}
 
-			filteredDescriptors = append(filteredDescriptors, descriptor)
-
-			mfstBytes, mfstType, innerErr := i.source.GetManifest(i.ctx, &descriptor.Digest)
+			mfstBytes, mfstType, innerErr := i.getManifest(&descriptor.Digest)
 			if innerErr != nil {
 				return nil, nil, nil, innerErr
 			}
 
 			//TODO: will the sub manifest be list-type?
 			subManifest, _, _, innerErr := GenerateManifestObj(mfstBytes, mfstType,
-				archFilterList, osFilterList, i, nil)
+				osFilterList, archFilterList, platformFilterList, metadataFilter, i, nil)
+			if errors.As(innerErr, &filteredErr) {
+				continue
+			}
 			if innerErr != nil {
-				return nil, nil, nil, err
+				return nil, nil, nil, innerErr
 			}
 
+			filteredDescriptors = append(filteredDescriptors, descriptor)
+
 			if subManifest != nil {
 				subManifestInfoSlice = append(subManifestInfoSlice, &ManifestInfo{
 					Obj: subManifest.(manifest.Manifest),
@@ -176,6 +215,9 @@ func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList
 
 		// no sub manifests need to transport
 		if len(filteredDescriptors) == 0 {
+			if filteredErr != nil {
+				return nil, nil, nil, filteredErr
+			}
 			return nil, nil, nil, nil
 		}
 
@@ -192,6 +234,53 @@ func GenerateManifestObj(manifestBytes []byte, manifestType string, osFilterList
 	}
 }
 
+// FilteredError means an image is filtered by metadata filter.
+type FilteredError struct {
+	reason string
+}
+
+func (e *FilteredError) Error() string {
+	return e.reason
+}
+
+// getConfigBlob returns the content of config blob.
+func getConfigBlob(i *ImageSource, info types.BlobInfo) ([]byte, error) {
+	blob, _, err := i.GetABlob(info)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	return io.ReadAll(blob)
+}
+
+// checkMetadata returns a *FilteredError if the image with config and layers doesn't pass metadata filter.
+func checkMetadata(metadataFilter *utilstypes.MetadataFilter, config []byte, layers []manifest.LayerInfo) error {
+	if metadataFilter == nil {
+		return nil
+	}
+
+	// docker and oci image configs have the same fields
+	var image specsv1.Image
+	if err := json.Unmarshal(config, &image); err != nil {
+		return fmt.Errorf("failed to decode image config: %v", err)
+	}
+
+	var size int64
+	for _, layer := range layers {
+		size += layer.Size
+	}
+
+	reason, err := metadataFilter.Match(image.Config.Labels, image.Created, size, time.Now())
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return &FilteredError{reason: reason}
+	}
+	return nil
+}
+
 // compare first:second to pat, second is optional
 func colonMatch(pat string, first string, second string) bool {
 	if strings.Index(pat, first) != 0 {
@@ -203,7 +292,8 @@ func colonMatch(pat string, first string, second string) bool {
 
 // Match platform selector according to the source image and its platform.
 // If platform.OS is not specified, the manifest will never be filtered, the same with platform.Architecture.
-func platformValidate(osFilterList, archFilterList []string, platform *manifest.Schema2PlatformSpec) bool {
+func platformValidate(osFilterList, archFilterList, platformFilterList []string,
+	platform *manifest.Schema2PlatformSpec) bool {
 	osMatched := true
 	archMatched := true
 
@@ -227,5 +317,33 @@ func platformValidate(osFilterList, archFilterList []string, platform *manifest.
 		}
 	}
 
-	return osMatched && archMatched
+	return osMatched && archMatched && platformMatch(platformFilterList, platform)
+}
+
+// platformMatch returns true if platform matches any "os/arch[/variant]" selector of platformFilterList, the variant
+// is only compared if the selector has one, and the unspecified fields of platform are not compared.
+func platformMatch(platformFilterList []string, platform *manifest.Schema2PlatformSpec) bool {
+	if len(platformFilterList) == 0 {
+		return true
+	}
+
+	for _, p := range platformFilterList {
+		parts := strings.SplitN(p, "/", 3)
+		if len(parts) < 2 {
+			continue
+		}
+
+		if platform.OS != "" && parts[0] != platform.OS {
+			continue
+		}
+		if platform.Architecture != "" && parts[1] != platform.Architecture {
+			continue
+		}
+		if len(parts) == 3 && platform.Architecture != "" && parts[2] != platform.Variant {
+			continue
+		}
+		return true
+	}
+
+	return false
 }
@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+func TestPlatformValidate(t *testing.T) {
+	platforms := []string{"linux/amd64", "linux/arm/v7"}
+
+	for _, c := range []struct {
+		platform manifest.Schema2PlatformSpec
+		expected bool
+	}{
+		{manifest.Schema2PlatformSpec{OS: "linux", Architecture: "amd64"}, true},
+		{manifest.Schema2PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v7"}, true},
+		{manifest.Schema2PlatformSpec{OS: "linux", Architecture: "arm", Variant: "v6"}, false},
+		{manifest.Schema2PlatformSpec{OS: "linux", Architecture: "arm64"}, false},
+		{manifest.Schema2PlatformSpec{OS: "windows", Architecture: "amd64"}, false},
+		// v1 manifests only have architecture
+		{manifest.Schema2PlatformSpec{Architecture: "amd64"}, true},
+	} {
+		assert.Equal(t, c.expected, platformValidate(nil, nil, platforms, &c.platform), "%+v", c.platform)
+	}
+
+	// os and arch filters still work without platforms
+	assert.True(t, platformValidate([]string{"linux"}, []string{"arm64"}, nil,
+		&manifest.Schema2PlatformSpec{OS: "linux", Architecture: "arm64"}))
+	assert.False(t, platformValidate([]string{"linux"}, []string{"arm64"}, nil,
+		&manifest.Schema2PlatformSpec{OS: "linux", Architecture: "amd64"}))
+}
+
+func TestCheckMetadata(t *testing.T) {
+	config := []byte(`{
+		"architecture": "amd64",
+		"os": "linux",
+		"created": "` + time.Now().Add(-time.Hour).Format(time.RFC3339) + `",
+		"config": {"Labels": {"org.opencontainers.image.vendor": "OurCorp"}}
+	}`)
+	layers := []manifest.LayerInfo{
+		{BlobInfo: types.BlobInfo{Size: 1000}},
+		{BlobInfo: types.BlobInfo{Size: 2000}},
+	}
+
+	assert.NoError(t, checkMetadata(nil, config, layers))
+	assert.NoError(t, checkMetadata(&utilstypes.MetadataFilter{
+		Labels:  map[string]string{"org.opencontainers.image.vendor": "OurCorp"},
+		MaxAge:  "1d",
+		MaxSize: "3kB",
+	}, config, layers))
+
+	var filteredErr *FilteredError
+	assert.ErrorAs(t, checkMetadata(&utilstypes.MetadataFilter{MaxSize: "2kB"}, config, layers), &filteredErr)
+	assert.ErrorAs(t, checkMetadata(&utilstypes.MetadataFilter{MaxAge: "30m"}, config, layers), &filteredErr)
+}
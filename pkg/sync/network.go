@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+const (
+	// DirectProxy disables proxies of a registry, including the ones from environment variables
+	DirectProxy = "direct"
+
+	defaultConnectTimeout = 30 * time.Second
+)
+
+// CheckAuthSettings validates the TLS and network settings of auth, so that misconfiguration can be reported before
+// any task starts.
+func CheckAuthSettings(auth utilstypes.Auth) error {
+	if auth.CertFile == "" != (auth.KeyFile == "") {
+		return fmt.Errorf("certFile and keyFile should be provided together")
+	}
+
+	if auth.MinTLSVersion != "" {
+		if _, err := ParseTLSVersion(auth.MinTLSVersion); err != nil {
+			return err
+		}
+	}
+
+	if _, err := proxyFunc(auth.Proxy); err != nil {
+		return err
+	}
+
+	for host := range auth.Resolve {
+		if host == "" {
+			return fmt.Errorf("host of resolve should not be empty")
+		}
+		if _, err := resolvedAddress(auth.Resolve, net.JoinHostPort(host, "443")); err != nil {
+			return err
+		}
+	}
+
+	if _, err := utils.RegistryPrefix("registry.invalid", auth.BasePath); err != nil {
+		return err
+	}
+
+	if _, err := catalogType("", auth); err != nil {
+		return err
+	}
+
+	if _, err := parseTimeout("connectTimeout", auth.ConnectTimeout); err != nil {
+		return err
+	}
+	_, err := parseTimeout("responseTimeout", auth.ResponseTimeout)
+	return err
+}
+
+// hasNetworkSettings returns true if any network setting which containers/image doesn't support is configured.
+func hasNetworkSettings(auth utilstypes.Auth) bool {
+	return auth.Proxy != "" || len(auth.Resolve) != 0 || auth.PlainHTTP ||
+		auth.ConnectTimeout != "" || auth.ResponseTimeout != ""
+}
+
+// newTransport generates a transport with the network settings of auth, tlsConfig is nil for hosts other than
+// registry, which are verified with the system CAs.
+func newTransport(auth utilstypes.Auth, tlsConfig *tls.Config) (*http.Transport, error) {
+	proxy, err := proxyFunc(auth.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	connectTimeout, err := parseTimeout("connectTimeout", auth.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if connectTimeout == 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+
+	responseTimeout, err := parseTimeout("responseTimeout", auth.ResponseTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsConfig
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = responseTimeout
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		// the addresses of proxies are overridden too
+		resolved, err := resolvedAddress(auth.Resolve, address)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, network, resolved)
+	}
+
+	return transport, nil
+}
+
+// proxyFunc returns the proxy function of http.Transport for a proxy url, proxy environment variables are used if
+// proxy is empty.
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case DirectProxy:
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %v: %v", proxy, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy %v: scheme should be http, https or socks5", proxy)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %v: host should not be empty", proxy)
+	}
+
+	return http.ProxyURL(proxyURL), nil
+}
+
+// resolvedAddress replaces the host of "host:port" address with the one in resolve, the address in resolve can
+// be an IP or "IP:port".
+func resolvedAddress(resolve map[string]string, address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+
+	override, exist := resolve[host]
+	if !exist {
+		return address, nil
+	}
+
+	if ip := net.ParseIP(override); ip != nil {
+		return net.JoinHostPort(ip.String(), port), nil
+	}
+
+	overrideHost, overridePort, err := net.SplitHostPort(override)
+	if err != nil || net.ParseIP(overrideHost) == nil {
+		return "", fmt.Errorf("invalid resolve address %q of %v, should be an IP or \"IP:port\"", override, host)
+	}
+	return net.JoinHostPort(overrideHost, overridePort), nil
+}
+
+func parseTimeout(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid %v %q, should be a positive duration like \"30s\"", name, value)
+	}
+	return timeout, nil
+}
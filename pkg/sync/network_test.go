@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// registryHandler serves the tags of "library/test" anonymously
+func registryHandler(requests *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+
+		switch r.URL.Path {
+		case "/v2/", "/v2/library/test/tags/list":
+			w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+			_, _ = w.Write([]byte(`{"name": "library/test", "tags": ["v1"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func TestResolvedAddress(t *testing.T) {
+	resolve := map[string]string{
+		"registry.example.com": "10.0.0.1",
+		"mirror.example.com":   "10.0.0.2:8443",
+		"ipv6.example.com":     "fd00::1",
+		"invalid.example.com":  "mirror.example.com",
+	}
+
+	for address, expected := range map[string]string{
+		"registry.example.com:443": "10.0.0.1:443",
+		"mirror.example.com:443":   "10.0.0.2:8443",
+		"ipv6.example.com:5000":    "[fd00::1]:5000",
+		"other.example.com:443":    "other.example.com:443",
+	} {
+		result, err := resolvedAddress(resolve, address)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, result)
+	}
+
+	_, err := resolvedAddress(resolve, "invalid.example.com:443")
+	assert.Error(t, err)
+}
+
+func TestCheckAuthSettings(t *testing.T) {
+	assert.NoError(t, CheckAuthSettings(utilstypes.Auth{
+		Proxy:           "socks5://127.0.0.1:1080",
+		Resolve:         map[string]string{"registry.example.com": "10.0.0.1"},
+		ConnectTimeout:  "5s",
+		ResponseTimeout: "1m",
+		MinTLSVersion:   "1.3",
+	}))
+	assert.NoError(t, CheckAuthSettings(utilstypes.Auth{Proxy: DirectProxy}))
+
+	for _, auth := range []utilstypes.Auth{
+		{Proxy: "ftp://127.0.0.1"},
+		{Proxy: "http://"},
+		{Resolve: map[string]string{"registry.example.com": "mirror.example.com"}},
+		{ConnectTimeout: "5"},
+		{ResponseTimeout: "-1s"},
+		{MinTLSVersion: "2.0"},
+		{CertFile: "client.pem"},
+		{Catalog: "quay"},
+	} {
+		assert.Error(t, CheckAuthSettings(auth), "%+v", auth)
+	}
+}
+
+func TestGatewayWithPlainHTTPAndResolve(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(registryHandler(&requests))
+	defer server.Close()
+	defer Cleanup()
+
+	// the host cannot be resolved without the override
+	registry := fmt.Sprintf("registry.invalid:%v", server.Listener.Addr().(*net.TCPAddr).Port)
+	source, err := NewImageSource(registry, "library/test", "", utilstypes.Auth{
+		PlainHTTP: true,
+		Proxy:     DirectProxy,
+		Resolve:   map[string]string{"registry.invalid": "127.0.0.1"},
+	})
+	assert.NoError(t, err)
+
+	tags, err := source.GetSourceRepoTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1"}, tags)
+	assert.NotZero(t, atomic.LoadInt32(&requests))
+}
+
+func TestGatewayWithProxy(t *testing.T) {
+	// the proxy serves registry itself, requests of plain http registries are sent to proxy with absolute urls
+	var requests int32
+	proxy := httptest.NewServer(registryHandler(&requests))
+	defer proxy.Close()
+	defer Cleanup()
+
+	source, err := NewImageSource("registry.invalid:5000", "library/test", "", utilstypes.Auth{
+		PlainHTTP:       true,
+		Proxy:           proxy.URL,
+		ConnectTimeout:  "5s",
+		ResponseTimeout: "5s",
+	})
+	assert.NoError(t, err)
+
+	tags, err := source.GetSourceRepoTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1"}, tags)
+	assert.NotZero(t, atomic.LoadInt32(&requests))
+}
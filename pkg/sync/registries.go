@@ -0,0 +1,172 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	"github.com/containers/image/v5/types"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// RegistriesConf is a containers registries.conf (v2) file, which provides mirrors, blocked registries, insecure
+// flags and short-name aliases. All the methods can be called with a nil RegistriesConf, which means
+// registries.conf is not used.
+type RegistriesConf struct {
+	path   string
+	sysctx *types.SystemContext
+}
+
+// PullSource is a registry and repository from which an image can be pulled
+type PullSource struct {
+	Registry   string
+	Repository string
+	// Insecure is true if the endpoint is marked as insecure in registries.conf
+	Insecure bool
+	// Mirror is false if it's the primary location of image
+	Mirror bool
+
+	// Failover and Auth are not provided by RegistriesConf. Failover is true if it's (or it's a mirror of) a failover
+	// source of image sync rule, and Auth is the authentication information used to pull image.
+	Failover bool
+	Auth     utilstypes.Auth
+}
+
+// String returns "registry/repository" of a PullSource
+func (p PullSource) String() string {
+	return p.Registry + "/" + p.Repository
+}
+
+// LoadRegistriesConf loads and validates a registries.conf file, the drop-in files in "<path>.d" are loaded too.
+func LoadRegistriesConf(path string) (*RegistriesConf, error) {
+	r := &RegistriesConf{
+		path: path,
+		sysctx: &types.SystemContext{
+			SystemRegistriesConfPath:    path,
+			SystemRegistriesConfDirPath: path + ".d",
+		},
+	}
+
+	// registries.conf is cached by containers/image, which is parsed only once
+	if _, err := sysregistriesv2.TryUpdatingCache(r.sysctx); err != nil {
+		return nil, fmt.Errorf("failed to load %v: %v", path, err)
+	}
+
+	return r, nil
+}
+
+// CheckBlocked returns an error if registry/repository is blocked.
+func (r *RegistriesConf) CheckBlocked(registry, repository string) error {
+	reg, err := r.findRegistry(registry, repository)
+	if err != nil || reg == nil {
+		return err
+	}
+
+	if reg.Blocked {
+		return fmt.Errorf("registry %v is blocked in %v", reg.Prefix, r.path)
+	}
+	return nil
+}
+
+// IsInsecure returns true if registry/repository is marked as insecure.
+func (r *RegistriesConf) IsInsecure(registry, repository string) bool {
+	reg, err := r.findRegistry(registry, repository)
+	return err == nil && reg != nil && reg.Insecure
+}
+
+// PullSources returns the locations from which image registry/repository:tagOrDigest should be tried to pull in
+// order, mirrors come first and the primary location is always the last one.
+func (r *RegistriesConf) PullSources(registry, repository, tagOrDigest string) ([]PullSource, error) {
+	primary := PullSource{Registry: registry, Repository: repository}
+
+	reg, err := r.findRegistry(registry, repository)
+	if err != nil {
+		return nil, err
+	}
+	if reg == nil {
+		return []PullSource{primary}, nil
+	}
+
+	if reg.Blocked {
+		return nil, fmt.Errorf("registry %v is blocked in %v", reg.Prefix, r.path)
+	}
+
+	ref, err := reference.ParseNormalizedNamed(registry + "/" + repository + utils.AttachConnectorToTagOrDigest(tagOrDigest))
+	if err != nil {
+		return nil, err
+	}
+
+	pullSources, err := reg.PullSourcesFromReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []PullSource
+	for index, pullSource := range pullSources {
+		result = append(result, PullSource{
+			Registry:   reference.Domain(pullSource.Reference),
+			Repository: reference.Path(pullSource.Reference),
+			Insecure:   pullSource.Endpoint.Insecure,
+			Mirror:     index != len(pullSources)-1,
+		})
+	}
+	return result, nil
+}
+
+// ResolveShortName replaces the unqualified short name at the beginning of an image url with its alias, e.g.,
+// "nginx:/1\..*/" might be resolved to "quay.io/nginx/nginx:/1\..*/". Urls are returned unchanged if they are
+// fully qualified or no alias is found, which means docker.io will be used.
+func (r *RegistriesConf) ResolveShortName(url string) (string, error) {
+	if r == nil {
+		return url, nil
+	}
+
+	if slash := strings.Index(url, "/"); slash != -1 {
+		// the first component is a registry if it has a domain or port, ":/" starts a tag regex
+		first := url[:slash]
+		if !strings.HasSuffix(first, ":") && (strings.ContainsAny(first, ".:") || first == "localhost") {
+			return url, nil
+		}
+	}
+
+	nameEnd := strings.IndexAny(url, ":@")
+	if nameEnd == -1 {
+		nameEnd = len(url)
+	}
+	name, rest := url[:nameEnd], url[nameEnd:]
+
+	alias, _, err := sysregistriesv2.ResolveShortNameAlias(r.sysctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve short name %v: %v", name, err)
+	}
+	if alias == nil {
+		return url, nil
+	}
+
+	return alias.String() + rest, nil
+}
+
+func (r *RegistriesConf) findRegistry(registry, repository string) (*sysregistriesv2.Registry, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	if utils.IsExplicitRegistry(registry) {
+		// registries.conf cannot express IPv6 literal hosts and registries served under a path prefix
+		return nil, nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(registry + "/" + repository)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := sysregistriesv2.FindRegistry(r.sysctx, named.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %v/%v in %v: %v", registry, repository, r.path, err)
+	}
+	return reg, nil
+}
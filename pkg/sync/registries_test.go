@@ -0,0 +1,93 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRegistriesConf = `
+unqualified-search-registries = ["docker.io"]
+
+[[registry]]
+prefix = "docker.io/library"
+location = "docker.io/library"
+
+[[registry.mirror]]
+location = "mirror.example.com/dockerhub"
+insecure = true
+
+[[registry.mirror]]
+location = "mirror.example.org/library"
+pull-from-mirror = "digest-only"
+
+[[registry]]
+location = "blocked.example.com"
+blocked = true
+
+[[registry]]
+location = "insecure.example.com:5000"
+insecure = true
+
+[aliases]
+"fedora" = "registry.fedoraproject.org/fedora"
+"tools/toolbox" = "registry.example.com/ns/toolbox"
+`
+
+func TestRegistriesConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registries.conf")
+	assert.NoError(t, os.WriteFile(path, []byte(testRegistriesConf), 0600))
+
+	r, err := LoadRegistriesConf(path)
+	assert.NoError(t, err)
+
+	assert.Error(t, r.CheckBlocked("blocked.example.com", "ns/image"))
+	assert.NoError(t, r.CheckBlocked("docker.io", "nginx"))
+
+	assert.True(t, r.IsInsecure("insecure.example.com:5000", "ns/image"))
+	assert.False(t, r.IsInsecure("docker.io", "nginx"))
+
+	sources, err := r.PullSources("docker.io", "nginx", "1.25")
+	assert.NoError(t, err)
+	assert.Equal(t, []PullSource{
+		{Registry: "mirror.example.com", Repository: "dockerhub/nginx", Insecure: true, Mirror: true},
+		{Registry: "docker.io", Repository: "library/nginx"},
+	}, sources)
+
+	sources, err = r.PullSources("docker.io", "library/nginx", "sha256:"+
+		"0000000000000000000000000000000000000000000000000000000000000000")
+	assert.NoError(t, err)
+	assert.Len(t, sources, 3)
+	assert.Equal(t, "mirror.example.org/library/nginx", sources[1].String())
+
+	sources, err = r.PullSources("quay.io", "coreos/etcd", "v3")
+	assert.NoError(t, err)
+	assert.Equal(t, []PullSource{{Registry: "quay.io", Repository: "coreos/etcd"}}, sources)
+
+	_, err = r.PullSources("blocked.example.com", "ns/image", "v1")
+	assert.Error(t, err)
+
+	for url, expected := range map[string]string{
+		"fedora:39":                     "registry.fedoraproject.org/fedora:39",
+		"fedora":                        "registry.fedoraproject.org/fedora",
+		"fedora:/^3[0-9]$/":             "registry.fedoraproject.org/fedora:/^3[0-9]$/",
+		"tools/toolbox:v1,v2":           "registry.example.com/ns/toolbox:v1,v2",
+		"nginx:1.25":                    "nginx:1.25",
+		"quay.io/fedora:39":             "quay.io/fedora:39",
+		"localhost/fedora:39":           "localhost/fedora:39",
+		"registry.example.com:5000/foo": "registry.example.com:5000/foo",
+	} {
+		result, err := r.ResolveShortName(url)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, result, url)
+	}
+
+	// registries.conf is not used
+	var empty *RegistriesConf
+	assert.NoError(t, empty.CheckBlocked("blocked.example.com", "ns/image"))
+	result, err := empty.ResolveShortName("fedora:39")
+	assert.NoError(t, err)
+	assert.Equal(t, "fedora:39", result)
+}
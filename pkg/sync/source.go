@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	gosync "sync"
+
+	"github.com/opencontainers/go-digest"
 
 	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
 	"github.com/containers/image/v5/docker"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
@@ -14,49 +18,64 @@ import (
 
 // ImageSource is a reference to a remote image need to be pulled.
 type ImageSource struct {
+	// lock protects source, sysctx and superseded, source and sysctx will be replaced while credentials are
+	// refreshed
+	lock gosync.RWMutex
+
 	ref    types.ImageReference
 	source types.ImageSource
 	ctx    context.Context
 	sysctx *types.SystemContext
 
+	// superseded are the sources replaced while credentials are refreshed, which might still be used by other
+	// goroutines, so they are closed by Close
+	superseded []types.ImageSource
+
+	auth     utilstypes.Auth
+	endpoint endpoint
+
 	// source image description
 	registry    string
 	repository  string
 	tagOrDigest string
+
+	// pinnedTag and pinnedDigest are reported by String if image is pinned to a digest under a tag
+	pinnedTag    string
+	pinnedDigest digest.Digest
+
+	// blobFallbacks are tried in order if a blob cannot be got from this source, the image sources of them are
+	// created on demand
+	blobFallbacks       []PullSource
+	blobFallbackSources []*ImageSource
+	blobFallbackLock    gosync.Mutex
 }
 
 // NewImageSource generates a PullTask by repository, the repository string must include tag or digest, or it can only be used
 // to list tags.
-// If username or password is empty, access to repository will be anonymous.
+// If the credential provider of auth is nil, access to repository will be anonymous.
 // A repository string is the rest part of the images url except tag digest and registry
-func NewImageSource(registry, repository, tagOrDigest, username, password string, insecure bool) (*ImageSource, error) {
+func NewImageSource(registry, repository, tagOrDigest string, auth utilstypes.Auth) (*ImageSource, error) {
 	if strings.Contains(repository, ":") {
 		return nil, fmt.Errorf("repository string should not include ':'")
 	}
 
-	srcRef, err := docker.ParseReference("//" + registry + "/" + repository + utils.AttachConnectorToTagOrDigest(tagOrDigest))
+	ep, err := resolveEndpoint(registry, repository, auth)
 	if err != nil {
 		return nil, err
 	}
 
-	var sysctx *types.SystemContext
-	if insecure {
-		// destination registry is http service
-		sysctx = &types.SystemContext{
-			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
-		}
-	} else {
-		sysctx = &types.SystemContext{}
+	srcRef, err := docker.ParseReference("//" + ep.registry + "/" + ep.repository + utils.AttachConnectorToTagOrDigest(tagOrDigest))
+	if err != nil {
+		return nil, err
 	}
 
-	ctx := context.WithValue(context.Background(), utils.CTXKey("ImageSource"), repository)
-	if username != "" && password != "" {
-		sysctx.DockerAuthConfig = &types.DockerAuthConfig{
-			Username: username,
-			Password: password,
-		}
+	sysctx, err := newSystemContext(auth, ep)
+	if err != nil {
+		return nil, err
 	}
 
+	ctx := context.WithValue(context.Background(), utils.CTXKey("ImageSource"), repository)
+
 	var source types.ImageSource
 	if tagOrDigest != "" {
 		// if tagOrDigest is empty, will attach to the "latest" tag, and will get an error if "latest" is not exist
@@ -71,6 +90,8 @@ func NewImageSource(registry, repository, tagOrDigest, username, password string
 		source:      source,
 		ctx:         ctx,
 		sysctx:      sysctx,
+		auth:        auth,
+		endpoint:    ep,
 		registry:    registry,
 		repository:  repository,
 		tagOrDigest: tagOrDigest,
@@ -79,10 +100,24 @@ func NewImageSource(registry, repository, tagOrDigest, username, password string
 
 // GetManifest get manifest file from source image
 func (i *ImageSource) GetManifest() ([]byte, string, error) {
+	return i.getManifest(nil)
+}
+
+// getManifest get manifest file from source image, instanceDigest refers to a sub manifest of manifest list,
+// and should be nil if the primary manifest is wanted.
+func (i *ImageSource) getManifest(instanceDigest *digest.Digest) ([]byte, string, error) {
 	if i.source == nil {
 		return nil, "", fmt.Errorf("cannot get manifest file without specified a tag or digest")
 	}
-	return i.source.GetManifest(i.ctx, nil)
+
+	var manifestBytes []byte
+	var manifestType string
+	err := i.withCredentialRetry(func(source types.ImageSource, _ *types.SystemContext) error {
+		var err error
+		manifestBytes, manifestType, err = source.GetManifest(i.ctx, instanceDigest)
+		return err
+	})
+	return manifestBytes, manifestType, err
 }
 
 // GetBlobInfos get blob infos from non-list type manifests.
@@ -107,13 +142,98 @@ func (i *ImageSource) GetBlobInfos(manifestObjSlice ...manifest.Manifest) ([]typ
 	return srcBlobs, nil
 }
 
-// GetABlob gets a blob from remote image
+// SetBlobFallbacks sets the sources which blobs will be got from in order if this source fails, blobs are content
+// addressed, so they are the same in all the sources which have the same image.
+func (i *ImageSource) SetBlobFallbacks(fallbacks []PullSource) {
+	i.blobFallbackLock.Lock()
+	defer i.blobFallbackLock.Unlock()
+
+	i.blobFallbacks = fallbacks
+	i.blobFallbackSources = make([]*ImageSource, len(fallbacks))
+}
+
+// GetABlob gets a blob from remote image, blob fallbacks will be tried in order if it fails.
 func (i *ImageSource) GetABlob(blobInfo types.BlobInfo) (io.ReadCloser, int64, error) {
-	return i.source.GetBlob(i.ctx, types.BlobInfo{Digest: blobInfo.Digest, URLs: blobInfo.URLs, Size: -1}, NoCache)
+	blob, size, err := i.getABlob(blobInfo)
+	if err == nil {
+		return blob, size, nil
+	}
+
+	i.blobFallbackLock.Lock()
+	fallbacks := i.blobFallbacks
+	i.blobFallbackLock.Unlock()
+
+	errs := []string{err.Error()}
+	for index, fallback := range fallbacks {
+		source, fallbackErr := i.getBlobFallbackSource(index)
+		if fallbackErr == nil {
+			if blob, size, fallbackErr = source.getABlob(blobInfo); fallbackErr == nil {
+				return blob, size, nil
+			}
+		}
+		errs = append(errs, fmt.Sprintf("%v: %v", fallback, fallbackErr))
+	}
+
+	if len(errs) == 1 {
+		return nil, 0, err
+	}
+	return nil, 0, fmt.Errorf("%v", strings.Join(errs, "; "))
+}
+
+func (i *ImageSource) getABlob(blobInfo types.BlobInfo) (io.ReadCloser, int64, error) {
+	var blob io.ReadCloser
+	var size int64
+	err := i.withCredentialRetry(func(source types.ImageSource, _ *types.SystemContext) error {
+		var err error
+		blob, size, err = source.GetBlob(i.ctx, types.BlobInfo{Digest: blobInfo.Digest, URLs: blobInfo.URLs, Size: -1}, NoCache)
+		return err
+	})
+	return blob, size, err
+}
+
+// getBlobFallbackSource returns the image source of the blob fallback at index, which is created at the first call.
+func (i *ImageSource) getBlobFallbackSource(index int) (*ImageSource, error) {
+	i.blobFallbackLock.Lock()
+	defer i.blobFallbackLock.Unlock()
+
+	if i.blobFallbackSources[index] != nil {
+		return i.blobFallbackSources[index], nil
+	}
+
+	fallback := i.blobFallbacks[index]
+	source, err := NewImageSource(fallback.Registry, fallback.Repository, i.tagOrDigest, fallback.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	i.blobFallbackSources[index] = source
+	return source, nil
 }
 
-// Close an ImageSource
+// Close an ImageSource, the image sources of blob fallbacks and the sources superseded by refreshed credentials are
+// closed too
 func (i *ImageSource) Close() error {
+	i.blobFallbackLock.Lock()
+	for _, source := range i.blobFallbackSources {
+		if source != nil {
+			_ = source.Close()
+		}
+	}
+	i.blobFallbackSources = make([]*ImageSource, len(i.blobFallbacks))
+	i.blobFallbackLock.Unlock()
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for _, source := range i.superseded {
+		_ = source.Close()
+	}
+	i.superseded = nil
+
+	// source is nil if ImageSource is only used to list tags
+	if i.source == nil {
+		return nil
+	}
 	return i.source.Close()
 }
 
@@ -132,12 +252,79 @@ func (i *ImageSource) GetTagOrDigest() string {
 	return i.tagOrDigest
 }
 
+// SetPinnedDigest records that the image is pinned to manifestDigest under tag, which will be reported by String.
+func (i *ImageSource) SetPinnedDigest(tag string, manifestDigest digest.Digest) {
+	i.pinnedTag, i.pinnedDigest = tag, manifestDigest
+}
+
 func (i *ImageSource) String() string {
+	if i.pinnedDigest != "" {
+		return i.registry + "/" + i.repository + ":" + i.pinnedTag + "@" + i.pinnedDigest.String()
+	}
 	return i.registry + "/" + i.repository + utils.AttachConnectorToTagOrDigest(i.tagOrDigest)
 }
 
 // GetSourceRepoTags gets all the tags of a repository which ImageSource belongs to
 func (i *ImageSource) GetSourceRepoTags() ([]string, error) {
-	// this function still works out even the tagOrDigest is empty
-	return docker.GetRepositoryTags(i.ctx, i.sysctx, i.ref)
+	var tags []string
+	err := i.withCredentialRetry(func(_ types.ImageSource, sysctx *types.SystemContext) error {
+		var err error
+		// this function still works out even the tagOrDigest is empty
+		tags, err = docker.GetRepositoryTags(i.ctx, sysctx, i.ref)
+		return err
+	})
+	return tags, err
+}
+
+// withCredentialRetry calls f with the current source and SystemContext. If f fails because of a 401 response,
+// the cached credentials will be invalidated and refreshed, then f will be retried once.
+func (i *ImageSource) withCredentialRetry(f func(source types.ImageSource, sysctx *types.SystemContext) error) error {
+	i.lock.RLock()
+	source, sysctx := i.source, i.sysctx
+	i.lock.RUnlock()
+
+	err := f(source, sysctx)
+	if err == nil || i.auth.Credential == nil || !IsUnauthorized(err) {
+		return err
+	}
+
+	if refreshErr := i.refreshCredential(sysctx); refreshErr != nil {
+		return fmt.Errorf("%v, and failed to refresh credentials: %v", err, refreshErr)
+	}
+
+	i.lock.RLock()
+	source, sysctx = i.source, i.sysctx
+	i.lock.RUnlock()
+
+	return f(source, sysctx)
+}
+
+// refreshCredential re-creates SystemContext and source with new credentials, stale is the SystemContext which got
+// a 401 response, nothing will be done if it has been replaced by another goroutine.
+func (i *ImageSource) refreshCredential(stale *types.SystemContext) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.sysctx != stale {
+		return nil
+	}
+
+	i.auth.Credential.Invalidate()
+	sysctx, err := newSystemContext(i.auth, i.endpoint)
+	if err != nil {
+		return err
+	}
+
+	if i.source != nil {
+		source, err := i.ref.NewImageSource(i.ctx, sysctx)
+		if err != nil {
+			return err
+		}
+		// the old source is closed by Close because it might still be used by other goroutines
+		i.superseded = append(i.superseded, i.source)
+		i.source = source
+	}
+
+	i.sysctx = sysctx
+	return nil
 }
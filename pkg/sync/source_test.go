@@ -0,0 +1,150 @@
+package sync
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	gosync "sync"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// fakeRegistry serves the manifest and blobs of an image under every repository, requests are authorized by basic
+// auth with user and the current password if it is not empty.
+type fakeRegistry struct {
+	*httptest.Server
+
+	lock     gosync.Mutex
+	password string
+
+	manifest []byte
+	blobs    map[digest.Digest][]byte
+}
+
+func newFakeRegistry(t *testing.T, password string, layers ...string) *fakeRegistry {
+	r := &fakeRegistry{
+		password: password,
+		blobs:    map[digest.Digest][]byte{},
+	}
+
+	config := []byte(`{"architecture": "amd64", "os": "linux"}`)
+	r.blobs[digest.FromBytes(config)] = config
+	m := manifest.Schema2{
+		SchemaVersion: 2,
+		MediaType:     manifest.DockerV2Schema2MediaType,
+		ConfigDescriptor: manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2ConfigMediaType,
+			Size:      int64(len(config)),
+			Digest:    digest.FromBytes(config),
+		},
+	}
+	for _, layer := range layers {
+		r.blobs[digest.FromString(layer)] = []byte(layer)
+		m.LayersDescriptors = append(m.LayersDescriptors, manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2LayerMediaType,
+			Size:      int64(len(layer)),
+			Digest:    digest.FromString(layer),
+		})
+	}
+
+	var err error
+	r.manifest, err = json.Marshal(m)
+	assert.NoError(t, err)
+
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *fakeRegistry) setPassword(password string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.password = password
+}
+
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	password := r.password
+	r.lock.Unlock()
+
+	if username, value, _ := req.BasicAuth(); password != "" && (username != "user" || value != password) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	switch {
+	case req.URL.Path == "/v2/":
+		_, _ = w.Write([]byte("{}"))
+	case strings.Contains(req.URL.Path, "/manifests/"):
+		w.Header().Set("Content-Type", manifest.DockerV2Schema2MediaType)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(r.manifest).String())
+		_, _ = w.Write(r.manifest)
+	case strings.Contains(req.URL.Path, "/blobs/"):
+		blob, exist := r.blobs[digest.Digest(req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:])]
+		if !exist {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(blob)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// rotatingProvider provides the passwords in order, the next one is provided after the current one is invalidated.
+type rotatingProvider struct {
+	passwords []string
+}
+
+func (p *rotatingProvider) Credentials() (string, string, error) {
+	return "user", p.passwords[0], nil
+}
+
+func (p *rotatingProvider) Invalidate() {
+	p.passwords = p.passwords[1:]
+}
+
+func TestImageSourceRefreshCredential(t *testing.T) {
+	registry := newFakeRegistry(t, "old", "layer")
+	auth := utilstypes.Auth{Insecure: true, Credential: &rotatingProvider{passwords: []string{"old", "new"}}}
+
+	source, err := NewImageSource(registry.host(), "library/app", "v1", auth)
+	assert.NoError(t, err)
+
+	// the source is replaced after the password is rotated
+	registry.setPassword("new")
+	blob, _, err := source.GetABlob(types.BlobInfo{Digest: digest.FromString("layer")})
+	assert.NoError(t, err)
+	content, err := io.ReadAll(blob)
+	assert.NoError(t, err)
+	assert.NoError(t, blob.Close())
+	assert.Equal(t, "layer", string(content))
+
+	// the replaced source is closed with the current one
+	assert.Len(t, source.superseded, 1)
+	assert.NoError(t, source.Close())
+	assert.Empty(t, source.superseded)
+}
+
+func TestImageSourceCloseWithoutTag(t *testing.T) {
+	registry := newFakeRegistry(t, "")
+
+	// a source without tag or digest is only used to list tags
+	source, err := NewImageSource(registry.host(), "library/app", "", utilstypes.Auth{Insecure: true})
+	assert.NoError(t, err)
+	assert.NoError(t, source.Close())
+}
@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+
+	utilstypes "github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+var (
+	// certDirs caches the certificate directories generated for containers/image, keyed by CA, cert and key files
+	certDirs     = map[string]string{}
+	certDirsLock gosync.Mutex
+
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// ParseTLSVersion converts a TLS version string like "1.2", "TLS1.2" or "tls12" to its value in crypto/tls.
+func ParseTLSVersion(version string) (uint16, error) {
+	normalized := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "tls")
+	normalized = strings.TrimPrefix(normalized, "v")
+	if len(normalized) == 2 && !strings.Contains(normalized, ".") {
+		normalized = normalized[:1] + "." + normalized[1:]
+	}
+
+	if value, exist := tlsVersions[normalized]; exist {
+		return value, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q, should be one of 1.0, 1.1, 1.2 and 1.3", version)
+}
+
+// hasCertFiles returns true if CA or client certificate is configured in auth.
+func hasCertFiles(auth utilstypes.Auth) bool {
+	return auth.CAFile != "" || auth.CertFile != "" || auth.KeyFile != ""
+}
+
+// certDir returns a directory in the layout of "/etc/docker/certs.d/<registry>" with the CA and client certificate of
+// auth, which can be used as SystemContext.DockerCertPath. Files are copied rather than linked because containers/image
+// only accepts "*.crt", "*.cert" and "*.key" files.
+func certDir(auth utilstypes.Auth) (string, error) {
+	if auth.CertFile == "" != (auth.KeyFile == "") {
+		return "", fmt.Errorf("certFile and keyFile should be provided together")
+	}
+
+	key := strings.Join([]string{auth.CAFile, auth.CertFile, auth.KeyFile}, "\x00")
+
+	certDirsLock.Lock()
+	defer certDirsLock.Unlock()
+
+	if dir, exist := certDirs[key]; exist {
+		return dir, nil
+	}
+
+	dir, err := os.MkdirTemp("", "image-syncer-certs-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create certificate directory: %v", err)
+	}
+
+	files := map[string]string{
+		auth.CAFile:   "ca.crt",
+		auth.CertFile: "client.cert",
+		auth.KeyFile:  "client.key",
+	}
+	for src, name := range files {
+		if src == "" {
+			continue
+		}
+
+		content, err := os.ReadFile(src)
+		if err != nil {
+			_ = os.RemoveAll(dir)
+			return "", fmt.Errorf("failed to read %v: %v", src, err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			_ = os.RemoveAll(dir)
+			return "", fmt.Errorf("failed to write %v: %v", name, err)
+		}
+	}
+
+	certDirs[key] = dir
+	return dir, nil
+}
+
+// newTLSConfig generates the TLS config used to access registry with the TLS settings of auth.
+func newTLSConfig(auth utilstypes.Auth) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         auth.ServerName,
+		InsecureSkipVerify: auth.Insecure,
+	}
+
+	if auth.MinTLSVersion != "" {
+		version, err := ParseTLSVersion(auth.MinTLSVersion)
+		if err != nil {
+			return nil, err
+		}
+		config.MinVersion = version
+	}
+
+	if auth.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		content, err := os.ReadFile(auth.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %v: %v", auth.CAFile, err)
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no valid certificate found in %v", auth.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if auth.CertFile != "" || auth.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(auth.CertFile, auth.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// removeCertDirs removes all the certificate directories generated by certDir.
+func removeCertDirs() {
+	certDirsLock.Lock()
+	defer certDirsLock.Unlock()
+
+	for key, dir := range certDirs {
+		_ = os.RemoveAll(dir)
+		delete(certDirs, key)
+	}
+}
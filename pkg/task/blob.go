@@ -42,16 +42,14 @@ func (b *BlobTask) Run() ([]Task, string, error) {
 
 	// ignore exist blob
 	if !blobExist {
-		// pull a blob from source
-		blob, size, err := src.GetABlob(b.info)
-		if err != nil {
-			return nil, resultMsg, fmt.Errorf("failed to get blob %s(%v): %v", b.info.Digest, size, err)
+		err = b.transport(src, dst)
+		if err != nil && sync.IsUnauthorized(err) {
+			// credentials of destination have been refreshed, the blob need to be pulled again to retry once
+			err = b.transport(src, dst)
 		}
 
-		b.info.Size = size
-		// push a blob to destination
-		if err = dst.PutABlob(blob, b.info); err != nil {
-			return nil, resultMsg, fmt.Errorf("failed to put blob %s(%v): %v", b.info.Digest, b.info.Size, err)
+		if err != nil {
+			return nil, resultMsg, err
 		}
 	} else {
 		resultMsg = "ignore exist blob"
@@ -64,6 +62,23 @@ func (b *BlobTask) Run() ([]Task, string, error) {
 	return nil, resultMsg, nil
 }
 
+// transport pulls a blob from source and pushes it to destination.
+func (b *BlobTask) transport(src *sync.ImageSource, dst *sync.ImageDestination) error {
+	// pull a blob from source
+	blob, size, err := src.GetABlob(b.info)
+	if err != nil {
+		return fmt.Errorf("failed to get blob %s(%v): %v", b.info.Digest, size, err)
+	}
+
+	b.info.Size = size
+	// push a blob to destination
+	if err = dst.PutABlob(blob, b.info); err != nil {
+		return fmt.Errorf("failed to put blob %s(%v): %w", b.info.Digest, b.info.Size, err)
+	}
+
+	return nil
+}
+
 func (b *BlobTask) GetPrimary() Task {
 	return b.primary
 }
@@ -0,0 +1,98 @@
+package task
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+)
+
+// taskSettings are the settings of a URLTask besides its source and destination urls, which decide how the image is
+// synchronized.
+type taskSettings struct {
+	sources []string
+	options URLTaskOptions
+}
+
+// Plan checks the URLTasks expanded from all the rules before synchronization. Duplicated tasks which have the same
+// source and destination urls and the same options are dropped and only the first one is kept, so tasks should be in
+// the order of rules. It fails if the same source and destination urls come from rules with different options,
+// distinct sources are synchronized to the same destination tag, or a destination is also the source of another
+// task, which forms a cycle. The number of dropped tasks is returned.
+func Plan(tasks []Task) ([]Task, int, error) {
+	var results []Task
+	var dropped int
+
+	// pairs records the settings of each source and destination pair
+	pairs := map[[2]string]taskSettings{}
+	// sources records the source url synchronized to each destination tag
+	sources := map[string]string{}
+	// destinations records a destination synchronized from each source reference
+	destinations := map[string]string{}
+
+	var errs []string
+	for _, t := range tasks {
+		u, ok := t.(*URLTask)
+		if !ok {
+			results = append(results, t)
+			continue
+		}
+
+		source, destination := u.source.String(), u.destination.String()
+		if settings, exist := pairs[[2]string{source, destination}]; exist {
+			if !reflect.DeepEqual(settings, u.settings()) {
+				errs = append(errs, fmt.Sprintf("%v -> %v comes from rules with different options", source,
+					destination))
+			}
+			dropped++
+			continue
+		}
+		pairs[[2]string{source, destination}] = u.settings()
+
+		// the same digest is always the same image, so only tags can conflict
+		if !u.destination.HasDigest() {
+			if other, exist := sources[destination]; exist {
+				errs = append(errs, fmt.Sprintf("%v is synchronized from both %v and %v", destination, other, source))
+			} else {
+				sources[destination] = source
+			}
+		}
+
+		if _, exist := destinations[urlReference(u.source)]; !exist {
+			destinations[urlReference(u.source)] = destination
+		}
+		results = append(results, t)
+	}
+
+	for _, t := range results {
+		if u, ok := t.(*URLTask); ok {
+			if next, exist := destinations[urlReference(u.destination)]; exist {
+				errs = append(errs, fmt.Sprintf("%v is the destination of %v and also the source of %v, which forms "+
+					"a cycle", u.destination, u.source, next))
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		sort.Strings(errs)
+		return nil, 0, fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return results, dropped, nil
+}
+
+// settings returns the settings of task which decide how the image is synchronized.
+func (u *URLTask) settings() taskSettings {
+	var sources []string
+	for _, pullSource := range u.sources {
+		sources = append(sources, pullSource.String())
+	}
+
+	return taskSettings{sources: sources, options: u.options}
+}
+
+// urlReference returns registry/repository:tag or registry/repository@digest of url, the pinned digest is ignored.
+func urlReference(url *utils.RepoURL) string {
+	return url.GetURLWithoutTagOrDigest() + utils.AttachConnectorToTagOrDigest(url.GetTagOrDigest())
+}
@@ -0,0 +1,85 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+func newTestURLTask(t *testing.T, source, destination string) Task {
+	sourceURLs, err := utils.GenerateRepoURLs(source, nil)
+	assert.NoError(t, err)
+	destinationURLs, err := utils.GenerateRepoURLs(destination, nil)
+	assert.NoError(t, err)
+
+	return NewURLTask(sourceURLs[0], destinationURLs[0], nil, types.Auth{}, URLTaskOptions{})
+}
+
+func TestPlan(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tasks := []Task{
+		newTestURLTask(t, "docker.io/library/nginx:1.25", "registry.example.com/library/nginx:1.25"),
+		newTestURLTask(t, "docker.io/library/nginx:1.19", "registry.example.com/library/nginx:1.19"),
+		// the same pair written with a short name, which is dropped as a duplicate
+		newTestURLTask(t, "nginx:1.25", "registry.example.com/library/nginx:1.25"),
+		newTestURLTask(t, "docker.io/library/nginx:1.25", "registry.example.com/mirror/nginx:1.25"),
+		newTestURLTask(t, "docker.io/library/nginx@"+digest, "registry.example.com/library/nginx@"+digest),
+		newTestURLTask(t, "quay.io/library/nginx@"+digest, "registry.example.com/library/nginx@"+digest),
+	}
+
+	results, dropped, err := Plan(tasks)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dropped)
+	assert.Equal(t, []Task{tasks[0], tasks[1], tasks[3], tasks[4], tasks[5]}, results)
+
+	_, _, err = Plan([]Task{
+		newTestURLTask(t, "docker.io/library/nginx:1.25", "registry.example.com/library/nginx:stable"),
+		newTestURLTask(t, "docker.io/library/nginx:1.26", "registry.example.com/library/nginx:stable"),
+	})
+	assert.EqualError(t, err, "registry.example.com/library/nginx:stable is synchronized from both "+
+		"docker.io/library/nginx:1.25 and docker.io/library/nginx:1.26")
+
+	_, _, err = Plan([]Task{
+		newTestURLTask(t, "docker.io/library/nginx:1.25", "registry.example.com/library/nginx:1.25"),
+		newTestURLTask(t, "registry.example.com/library/nginx:1.25", "docker.io/library/nginx:1.25"),
+	})
+	assert.EqualError(t, err, "docker.io/library/nginx:1.25 is the destination of "+
+		"registry.example.com/library/nginx:1.25 and also the source of registry.example.com/library/nginx:1.25, "+
+		"which forms a cycle; registry.example.com/library/nginx:1.25 is the destination of "+
+		"docker.io/library/nginx:1.25 and also the source of docker.io/library/nginx:1.25, which forms a cycle")
+
+	_, _, err = Plan([]Task{
+		newTestURLTask(t, "docker.io/library/nginx:1.25", "registry.example.com/library/nginx:1.25"),
+		newTestURLTask(t, "registry.example.com/library/nginx:1.25", "registry.example.com/mirror/nginx:1.25"),
+	})
+	assert.ErrorContains(t, err, "registry.example.com/library/nginx:1.25 is the destination of "+
+		"docker.io/library/nginx:1.25 and also the source of registry.example.com/mirror/nginx:1.25")
+
+	// the same pair from rules with different options is not a duplicate
+	sourceURLs, err := utils.GenerateRepoURLs("docker.io/library/nginx:1.25", nil)
+	assert.NoError(t, err)
+	destinationURLs, err := utils.GenerateRepoURLs("registry.example.com/library/nginx:1.25", nil)
+	assert.NoError(t, err)
+	linuxOnly := NewURLTask(sourceURLs[0], destinationURLs[0], nil, types.Auth{},
+		URLTaskOptions{PlatformFilterList: []string{"linux/amd64"}})
+	forced := NewURLTask(sourceURLs[0], destinationURLs[0], nil, types.Auth{}, URLTaskOptions{ForceUpdate: true})
+
+	_, _, err = Plan([]Task{
+		newTestURLTask(t, "docker.io/library/nginx:1.25", "registry.example.com/library/nginx:1.25"),
+		linuxOnly,
+		forced,
+	})
+	assert.EqualError(t, err, "docker.io/library/nginx:1.25 -> registry.example.com/library/nginx:1.25 comes "+
+		"from rules with different options; docker.io/library/nginx:1.25 -> registry.example.com/library/nginx:1.25 "+
+		"comes from rules with different options")
+
+	results, dropped, err = Plan([]Task{linuxOnly, NewURLTask(sourceURLs[0], destinationURLs[0], nil, types.Auth{},
+		URLTaskOptions{PlatformFilterList: []string{"linux/amd64"}})})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dropped)
+	assert.Equal(t, []Task{linuxOnly}, results)
+}
@@ -2,6 +2,13 @@ package task
 
 import (
 	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/opencontainers/go-digest"
 
 	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
 
@@ -9,21 +16,40 @@ import (
 	"github.com/AliyunContainerService/image-syncer/pkg/utils"
 )
 
+// RuleTaskOptions are the options of an image rule, they are shared by the tasks generated from the rule.
+type RuleTaskOptions struct {
+	URLTaskOptions
+
+	// FailoverSources are repositories tried in order if source fails
+	FailoverSources []string
+
+	// TagFilter selects the tags listed from source repository
+	TagFilter types.TagFilter
+
+	// TagTemplate is nil if destination tags are not rendered by template
+	TagTemplate *types.TagTemplate
+
+	// RepositoryMapping is nil if destination is a repository rather than registry[/namespace]
+	RepositoryMapping *types.RepositoryMapping
+
+	// Registries is nil if registries.conf is not used
+	Registries *sync.RegistriesConf
+
+	// URLParser knows the registries served under a path prefix
+	URLParser *utils.URLParser
+
+	GetAuthFunc func(repository string) types.Auth
+}
+
 // RuleTask analyze an image config rule ("xxx:xxx") and generates URLTask(s).
 type RuleTask struct {
 	source      string
 	destination string
 
-	osFilterList, archFilterList []string
-
-	getAuthFunc func(repository string) types.Auth
-
-	forceUpdate bool
+	options RuleTaskOptions
 }
 
-func NewRuleTask(source, destination string,
-	osFilterList, archFilterList []string,
-	getAuthFunc func(repository string) types.Auth, forceUpdate bool) (*RuleTask, error) {
+func NewRuleTask(source, destination string, options RuleTaskOptions) (*RuleTask, error) {
 	if source == "" {
 		return nil, fmt.Errorf("source url should not be empty")
 	}
@@ -33,12 +59,9 @@ func NewRuleTask(source, destination string,
 	}
 
 	return &RuleTask{
-		source:         source,
-		destination:    destination,
-		getAuthFunc:    getAuthFunc,
-		osFilterList:   osFilterList,
-		archFilterList: archFilterList,
-		forceUpdate:    forceUpdate,
+		source:      source,
+		destination: destination,
+		options:     options,
 	}, nil
 }
 
@@ -49,38 +72,106 @@ func (r *RuleTask) Run() ([]Task, string, error) {
 	//	return nil, "", fmt.Errorf("random failure")
 	//}
 
+	if r.options.URLParser.IsWildcardURL(r.source) {
+		return r.expandWildcard()
+	}
+
+	// unqualified short names are resolved by the aliases of registries.conf
+	source, err := r.options.Registries.ResolveShortName(r.source)
+	if err != nil {
+		return nil, "", err
+	}
+
+	destination, err := r.options.Registries.ResolveShortName(r.destination)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if r.options.RepositoryMapping != nil {
+		_, repository, err := r.options.URLParser.ParseRepositoryOfURL(source)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if destination, err = r.options.RepositoryMapping.MapDestination(destination, repository); err != nil {
+			return nil, "", fmt.Errorf("failed to map repository for %s: %v", r.source, err)
+		}
+	}
+
+	failoverRepos, err := r.failoverRepositories()
+	if err != nil {
+		return nil, "", err
+	}
+
+	listAllTags := func(registry, repository string) ([]string, error) {
+		if r.options.Lock != nil && r.options.Lock.Locked {
+			// only the locked tags are synchronized in locked mode
+			return r.options.TagFilter.Filter(r.options.Lock.Lockfile.Tags(registry, repository))
+		}
+
+		tags, err := r.listAllTags(append([][2]string{{registry, repository}}, failoverRepos...))
+		if err != nil {
+			return nil, err
+		}
+		return r.options.TagFilter.Filter(tags)
+	}
+
 	// if source tag is not specific, get all tags of this source repo
-	sourceURLs, err := utils.GenerateRepoURLs(r.source, r.listAllTags)
+	sourceURLs, err := r.options.URLParser.GenerateRepoURLs(source, listAllTags)
 	if err != nil {
 		return nil, "", fmt.Errorf("source url %s format error: %v", r.source, err)
 	}
 
-	// if destination tags or digest is not specific, reuse tags or digest of sourceURLs
-	destinationURLs, err := utils.GenerateRepoURLs(r.destination, func(registry, repository string) ([]string, error) {
-		var result []string
+	var destinationTags []string
+	if r.options.TagTemplate != nil {
+		if sourceURLs, destinationTags, err = r.renderTags(sourceURLs, failoverRepos); err != nil {
+			return nil, "", fmt.Errorf("failed to render tags for %s: %v", r.source, err)
+		}
+	} else {
 		for _, item := range sourceURLs {
-			result = append(result, item.GetTagOrDigest())
+			destinationTags = append(destinationTags, item.GetTagOrDigest())
 		}
-		return result, nil
-	})
+	}
+
+	// if destination tags or digest is not specific, reuse tags or digest of sourceURLs
+	destinationTagsUsed := false
+	destinationURLs, err := r.options.URLParser.GenerateRepoURLs(destination,
+		func(registry, repository string) ([]string, error) {
+			destinationTagsUsed = true
+			return destinationTags, nil
+		})
 	if err != nil {
 		return nil, "", fmt.Errorf("source url %s format error: %v", r.source, err)
 	}
 
-	// TODO: remove duplicated sourceURL and destinationURL pair?
-	if err = checkSourceAndDestinationURLs(sourceURLs, destinationURLs); err != nil {
+	if r.options.TagTemplate != nil && !destinationTagsUsed {
+		return nil, "", fmt.Errorf("destination url %s should not have tags or digest if tag template is used",
+			r.destination)
+	}
+
+	// duplicated source and destination url pairs are dropped by Plan
+	if err = CheckSourceAndDestinationURLs(sourceURLs, destinationURLs); err != nil {
 		return nil, "", fmt.Errorf("failed to check source and destination urls for %s:%s: %v",
 			r.source, r.destination, err)
 	}
 
 	var results []Task
 	for index, s := range sourceURLs {
+		d := destinationURLs[index]
+		if d.GetPinnedDigest() != "" {
+			return nil, "", fmt.Errorf("destination url %s should not pin a digest", r.destination)
+		}
+		if err = r.options.Registries.CheckBlocked(d.GetRegistry(), d.GetRepo()); err != nil {
+			return nil, "", err
+		}
+
+		pullSources, err := r.pullSources(s, failoverRepos)
+		if err != nil {
+			return nil, "", err
+		}
+
 		results = append(results,
-			NewURLTask(s, destinationURLs[index],
-				r.getAuthFunc(s.GetURLWithoutTagOrDigest()),
-				r.getAuthFunc(destinationURLs[index].GetURLWithoutTagOrDigest()),
-				r.osFilterList, r.archFilterList, r.forceUpdate,
-			),
+			NewURLTask(s, d, pullSources, r.getAuth(d.GetRegistry(), d.GetRepo()), r.options.URLTaskOptions),
 		)
 	}
 
@@ -117,11 +208,95 @@ func (r *RuleTask) Type() Type {
 	return RuleType
 }
 
-func (r *RuleTask) listAllTags(sourceRegistry, sourceRepository string) ([]string, error) {
-	auth := r.getAuthFunc(sourceRegistry + "/" + sourceRepository)
+// expandWildcard lists the repositories matched by wildcard source, and generates a RuleTask for each of them. The
+// destination repository is derived by replacing "*" with the matched part, or by repository mapping. Repositories
+// are listed from lockfile rather than registry in locked mode.
+func (r *RuleTask) expandWildcard() ([]Task, string, error) {
+	wildcard, err := r.options.URLParser.ParseWildcardURL(r.source)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var repositories []string
+	if r.options.Lock != nil && r.options.Lock.Locked {
+		repositories = r.options.Lock.Lockfile.Repositories(wildcard.Registry, wildcard.Namespace)
+	} else {
+		repositories, err = sync.ListRepositories(wildcard.Registry, wildcard.Namespace,
+			r.getAuth(wildcard.Registry, wildcard.Namespace))
+		if err != nil {
+			return nil, "", err
+		}
+		sort.Strings(repositories)
+	}
+
+	var results []Task
+	sources := map[string]string{}
+	for _, repository := range repositories {
+		matched, ok := wildcard.Match(repository)
+		if !ok {
+			continue
+		}
+
+		child := *r
+		child.source = wildcard.URL(repository)
+
+		destination := r.destination
+		if strings.Contains(r.destination, "*") {
+			child.destination = strings.Replace(r.destination, "*", matched, 1)
+			child.options.RepositoryMapping = nil
+			destination = child.destination
+		} else if destination, err = r.options.RepositoryMapping.MapDestination(r.destination, repository); err != nil {
+			return nil, "", fmt.Errorf("failed to map repository for %s: %v", child.source, err)
+		}
+
+		registry, destinationRepo, err := r.options.URLParser.ParseRepositoryOfURL(destination)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid destination %v for %s: %v", destination, child.source, err)
+		}
+		destinationRepo = registry + "/" + destinationRepo
+
+		if other, exist := sources[destinationRepo]; exist {
+			return nil, "", fmt.Errorf("repositories %v and %v are both synchronized to %v",
+				other, repository, destinationRepo)
+		}
+		sources[destinationRepo] = repository
+
+		results = append(results, &child)
+	}
+
+	if len(results) == 0 {
+		return nil, "no repository matched", nil
+	}
+	return results, fmt.Sprintf("%v repositories matched", len(results)), nil
+}
+
+// listAllTags lists tags of the first repository (registry and repository pair) which works.
+func (r *RuleTask) listAllTags(repositories [][2]string) ([]string, error) {
+	var errs []string
+	for _, repository := range repositories {
+		tags, err := r.listRepositoryTags(repository[0], repository[1])
+		if err == nil {
+			return tags, nil
+		}
+
+		if len(repositories) == 1 {
+			return nil, err
+		}
+		errs = append(errs, err.Error())
+	}
+
+	return nil, fmt.Errorf("all the sources failed: %v", strings.Join(errs, "; "))
+}
+
+func (r *RuleTask) listRepositoryTags(sourceRegistry, sourceRepository string) ([]string, error) {
+	// tags are always listed from the primary location, which is the same as containers/image
+	if err := r.options.Registries.CheckBlocked(sourceRegistry, sourceRepository); err != nil {
+		return nil, err
+	}
+
+	auth := r.getAuth(sourceRegistry, sourceRepository)
 
-	imageSource, err := sync.NewImageSource(sourceRegistry, sourceRepository, "",
-		auth.Username, auth.Password, auth.Insecure)
+	imageSource, err := sync.NewImageSource(sourceRegistry, sourceRepository, "", auth)
 	if err != nil {
 		return nil, fmt.Errorf("generate %s image source error: %v", sourceRegistry+"/"+sourceRepository, err)
 	}
@@ -129,7 +304,147 @@ func (r *RuleTask) listAllTags(sourceRegistry, sourceRepository string) ([]strin
 	return imageSource.GetSourceRepoTags()
 }
 
-func checkSourceAndDestinationURLs(sourceURLs, destinationURLs []*utils.RepoURL) error {
+// renderTags renders the destination tags of source urls by tag template, the source urls of alias tags are appended
+// to the returned source urls.
+func (r *RuleTask) renderTags(sourceURLs []*utils.RepoURL, failoverRepos [][2]string) ([]*utils.RepoURL, []string,
+	error) {
+	var tags []string
+	for _, s := range sourceURLs {
+		if s.HasDigest() {
+			return nil, nil, fmt.Errorf("tag template cannot be used with source digest %v", s.GetTagOrDigest())
+		}
+		tags = append(tags, s.GetTagOrDigest())
+	}
+
+	date := time.Now().UTC().Format("20060102")
+	destinationTags, newest, err := r.options.TagTemplate.RenderTags(tags, func(index int) (map[string]string, error) {
+		s := sourceURLs[index]
+		variables := map[string]string{
+			types.TagVariable:  s.GetTagOrDigest(),
+			types.RepoVariable: path.Base(s.GetRepo()),
+			types.DateVariable: date,
+		}
+
+		if r.options.TagTemplate.UsesDigest() {
+			manifestDigest, err := r.manifestDigest(s, failoverRepos)
+			if err != nil {
+				return nil, err
+			}
+			variables[types.DigestVariable] = manifestDigest.Encoded()[:12]
+		}
+		return variables, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resultURLs := sourceURLs
+	if newest != -1 {
+		for _, alias := range r.options.TagTemplate.Aliases {
+			resultURLs = append(resultURLs, sourceURLs[newest])
+			destinationTags = append(destinationTags, alias)
+		}
+	}
+
+	return resultURLs, destinationTags, nil
+}
+
+// manifestDigest returns the manifest digest of source url, which is got from the first pull source that works.
+func (r *RuleTask) manifestDigest(source *utils.RepoURL, failoverRepos [][2]string) (digest.Digest, error) {
+	if r.options.Lock != nil && r.options.Lock.Locked {
+		key := types.LockKey(source.GetRegistry(), source.GetRepo(), source.GetTagOrDigest())
+		image, exist := r.options.Lock.Lockfile.Get(key)
+		if !exist {
+			return "", fmt.Errorf("%v is not found in lockfile", key)
+		}
+		return digest.Digest(image.Digest), nil
+	}
+
+	pullSources, err := r.pullSources(source, failoverRepos)
+	if err != nil {
+		return "", err
+	}
+
+	var errs []string
+	for _, pullSource := range pullSources {
+		imageSource, err := sync.NewImageSource(pullSource.Registry, pullSource.Repository,
+			source.GetTagOrDigest(), pullSource.Auth)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		manifestBytes, _, err := imageSource.GetManifest()
+		_ = imageSource.Close()
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		return manifest.Digest(manifestBytes)
+	}
+
+	return "", fmt.Errorf("failed to get manifest digest of %v: %v", source, strings.Join(errs, "; "))
+}
+
+// failoverRepositories returns the registry and repository pairs of failover sources.
+func (r *RuleTask) failoverRepositories() ([][2]string, error) {
+	var result [][2]string
+	for _, failover := range r.options.FailoverSources {
+		url, err := r.options.Registries.ResolveShortName(failover)
+		if err != nil {
+			return nil, err
+		}
+
+		registry, repository, err := r.options.URLParser.ParseRepository(url)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, [2]string{registry, repository})
+	}
+	return result, nil
+}
+
+// pullSources returns all the locations which image of source url can be pulled from in order: mirrors of source,
+// source, and then each failover source after its mirrors.
+func (r *RuleTask) pullSources(source *utils.RepoURL, failoverRepos [][2]string) ([]sync.PullSource, error) {
+	var result []sync.PullSource
+
+	repositories := append([][2]string{{source.GetRegistry(), source.GetRepo()}}, failoverRepos...)
+	for index, repository := range repositories {
+		pullSources, err := r.options.Registries.PullSources(repository[0], repository[1], source.GetTagOrDigest())
+		if err != nil {
+			if index != 0 {
+				// a blocked failover source is skipped
+				continue
+			}
+			return nil, err
+		}
+
+		for _, pullSource := range pullSources {
+			pullSource.Failover = index != 0
+			pullSource.Auth = r.getAuth(pullSource.Registry, pullSource.Repository)
+			pullSource.Auth.Insecure = pullSource.Auth.Insecure || pullSource.Insecure
+			result = append(result, pullSource)
+		}
+	}
+
+	return result, nil
+}
+
+// getAuth returns the authentication information of registry/repository, which is insecure if registries.conf
+// says so.
+func (r *RuleTask) getAuth(registry, repository string) types.Auth {
+	auth := r.options.GetAuthFunc(registry + "/" + repository)
+	if r.options.Registries.IsInsecure(registry, repository) {
+		auth.Insecure = true
+	}
+	return auth
+}
+
+// CheckSourceAndDestinationURLs checks that source and destination urls are paired by tags, and that their digests
+// match if both have one.
+func CheckSourceAndDestinationURLs(sourceURLs, destinationURLs []*utils.RepoURL) error {
 	if len(sourceURLs) != len(destinationURLs) {
 		return fmt.Errorf("the number of tags of source and destination is not matched")
 	}
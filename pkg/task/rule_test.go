@@ -0,0 +1,56 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/concurrent"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+func TestExpandWildcardLocked(t *testing.T) {
+	manifestDigest := digest.FromString("manifest")
+	lockfile := types.NewLockfile()
+	for _, source := range []string{
+		"harbor.corp/platform/app:v1",
+		"harbor.corp/platform/app:v2",
+		"harbor.corp/platform/web:v1",
+		"harbor.corp/other/app:v1",
+	} {
+		lockfile.Add(source, "", manifestDigest, manifestDigest)
+	}
+	lock := &Lock{Locked: true, Lockfile: concurrent.NewLockfile(lockfile)}
+
+	// registry is not accessed in locked mode, the repositories are listed from lockfile
+	ruleTask, err := NewRuleTask("harbor.corp/platform/*", "registry.example.com/mirror/*", RuleTaskOptions{
+		URLTaskOptions: URLTaskOptions{Lock: lock},
+		GetAuthFunc: func(repository string) types.Auth {
+			return types.Auth{}
+		},
+	})
+	assert.NoError(t, err)
+
+	children, message, err := ruleTask.Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "2 repositories matched", message)
+	assert.Len(t, children, 2)
+	assert.Equal(t, "analyzing image rule for harbor.corp/platform/app -> registry.example.com/mirror/app",
+		children[0].String())
+	assert.Equal(t, "analyzing image rule for harbor.corp/platform/web -> registry.example.com/mirror/web",
+		children[1].String())
+
+	// tags are also listed from lockfile
+	tasks, _, err := children[0].Run()
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+
+	ruleTask, err = NewRuleTask("harbor.corp/team/*", "registry.example.com/mirror/*",
+		RuleTaskOptions{URLTaskOptions: URLTaskOptions{Lock: lock}})
+	assert.NoError(t, err)
+	children, message, err = ruleTask.Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "no repository matched", message)
+	assert.Empty(t, children)
+}
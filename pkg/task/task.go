@@ -1,9 +1,15 @@
 package task
 
 import (
+	"strings"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/concurrent"
 	"github.com/AliyunContainerService/image-syncer/pkg/sync"
 )
 
+// warningPrefix marks the result message of a task which succeeded with something to warn
+const warningPrefix = "warning: "
+
 type Type string
 
 const (
@@ -36,3 +42,16 @@ type Task interface {
 
 	Type() Type
 }
+
+// IsWarning returns true if the result message of a task is a warning.
+func IsWarning(message string) bool {
+	return strings.HasPrefix(message, warningPrefix)
+}
+
+// Lock describes how tasks work with a lockfile, it's nil if lockfile is not used.
+type Lock struct {
+	// Locked means images are synchronized from the digests in Lockfile and tags are listed from it, otherwise the
+	// digests of images are recorded into Lockfile without synchronization.
+	Locked   bool
+	Lockfile *concurrent.Lockfile
+}
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -8,59 +9,201 @@ import (
 
 	"github.com/AliyunContainerService/image-syncer/pkg/concurrent"
 	"github.com/containers/image/v5/manifest"
+	"github.com/opencontainers/go-digest"
 
 	"github.com/AliyunContainerService/image-syncer/pkg/utils"
 
 	"github.com/AliyunContainerService/image-syncer/pkg/sync"
 )
 
+// URLTaskOptions are the options of synchronizing an image.
+type URLTaskOptions struct {
+	OSFilterList, ArchFilterList, PlatformFilterList []string
+
+	// MetadataFilter is nil if images are not filtered by metadata
+	MetadataFilter *types.MetadataFilter
+
+	// DigestDrift decides what to do if source is pinned to a digest which its tag doesn't resolve to
+	DigestDrift string
+
+	// Lock is nil if lockfile is not used
+	Lock *Lock
+
+	ForceUpdate bool
+}
+
 // URLTask converts an image RepoURL pair (specific tag) to BlobTask(s) and ManifestTask(s).
 type URLTask struct {
 	source      *utils.RepoURL
 	destination *utils.RepoURL
 
-	sourceAuth      types.Auth
+	// sources are the locations which source image can be pulled from, they are tried in order
+	sources         []sync.PullSource
 	destinationAuth types.Auth
 
-	osFilterList, archFilterList []string
-
-	forceUpdate bool
+	options URLTaskOptions
 }
 
-func NewURLTask(source, destination *utils.RepoURL,
-	sourceAuth, destinationAuth types.Auth,
-	osFilterList, archFilterList []string,
-	forceUpdate bool) Task {
+func NewURLTask(source, destination *utils.RepoURL, sources []sync.PullSource, destinationAuth types.Auth,
+	options URLTaskOptions) Task {
 	return &URLTask{
 		source:          source,
 		destination:     destination,
-		sourceAuth:      sourceAuth,
+		sources:         sources,
 		destinationAuth: destinationAuth,
-		osFilterList:    osFilterList,
-		archFilterList:  archFilterList,
-		forceUpdate:     forceUpdate,
+		options:         options,
 	}
 }
 
 func (u *URLTask) Run() ([]Task, string, error) {
-	imageSource, err := sync.NewImageSource(u.source.GetRegistry(), u.source.GetRepo(), u.source.GetTagOrDigest(),
-		u.sourceAuth.Username, u.sourceAuth.Password, u.sourceAuth.Insecure)
+	key := types.LockKey(u.source.GetRegistry(), u.source.GetRepo(), u.source.GetTagOrDigest())
+
+	// images are pulled by the locked digests in locked mode
+	reference := u.source.GetTagOrDigest()
+	var lockedDigest digest.Digest
+	if u.options.Lock != nil && u.options.Lock.Locked {
+		image, exist := u.options.Lock.Lockfile.Get(key)
+		if !exist {
+			return nil, "", fmt.Errorf("%v is not found in lockfile", key)
+		}
+		reference = image.Digest
+		lockedDigest = digest.Digest(image.FilteredDigest(u.destination.String()))
+	}
+
+	imageSource, served, manifestBytes, manifestType, err := u.openSource(reference)
 	if err != nil {
-		return nil, "", fmt.Errorf("generate %s image source error: %v", u.source.String(), err)
+		return nil, "", err
+	}
+
+	var driftMsg string
+	if pinned := digest.Digest(u.source.GetPinnedDigest()); pinned != "" {
+		tag := u.source.GetTagOrDigest()
+
+		actual, err := manifest.Digest(manifestBytes)
+		if err != nil {
+			_ = imageSource.Close()
+			return nil, "", fmt.Errorf("failed to get manifest digest of %s: %v", u.source, err)
+		}
+
+		if actual != pinned {
+			_ = imageSource.Close()
+			driftMsg = fmt.Sprintf("tag %v has drifted from pinned digest %v to %v", tag, pinned, actual)
+			if u.options.DigestDrift != types.DigestDriftWarn {
+				return nil, "", fmt.Errorf("%v", driftMsg)
+			}
+
+			// the pinned image is synchronized under the tag
+			imageSource, served, manifestBytes, manifestType, err = u.openSource(pinned.String())
+			if err != nil {
+				return nil, "", err
+			}
+			driftMsg = warningPrefix + driftMsg + ", the pinned digest is synchronized"
+		}
+
+		imageSource.SetPinnedDigest(tag, pinned)
+	} else if reference != u.source.GetTagOrDigest() {
+		imageSource.SetPinnedDigest(u.source.GetTagOrDigest(), digest.Digest(reference))
+	}
+
+	if u.options.Lock != nil && !u.options.Lock.Locked {
+		msg, err := u.lockDigest(key, imageSource, manifestBytes, manifestType)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, joinMessages(driftMsg, msg), nil
 	}
 
 	imageDestination, err := sync.NewImageDestination(u.destination.GetRegistry(), u.destination.GetRepo(),
-		u.destination.GetTagOrDigest(), u.destinationAuth.Username, u.destinationAuth.Password, u.destinationAuth.Insecure)
+		u.destination.GetTagOrDigest(), u.destinationAuth)
 	if err != nil {
 		return nil, "", fmt.Errorf("generate %s image destination error: %v", u.destination.String(), err)
 	}
 
-	tasks, msg, err := u.generateSyncTasks(imageSource, imageDestination, u.osFilterList, u.archFilterList)
+	tasks, msg, err := u.generateSyncTasks(imageSource, manifestBytes, manifestType, imageDestination,
+		u.options.OSFilterList, u.options.ArchFilterList, u.options.PlatformFilterList, u.options.MetadataFilter,
+		lockedDigest)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to generate manifest/blob tasks: %v", err)
 	}
 
-	return tasks, msg, nil
+	var servedMsg string
+	if served.Mirror || served.Failover {
+		servedMsg = fmt.Sprintf("served by %v", served)
+	}
+
+	return tasks, joinMessages(driftMsg, servedMsg, msg), nil
+}
+
+// lockDigest records the manifest digest of source, and the digest of manifest to push after filters, into lockfile.
+func (u *URLTask) lockDigest(key string, source *sync.ImageSource, manifestBytes []byte,
+	manifestType string) (string, error) {
+	defer source.Close()
+
+	manifestDigest, err := manifest.Digest(manifestBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to get manifest digest of %s: %v", u.source, err)
+	}
+
+	destManifestObj, destManifestBytes, _, err := sync.GenerateManifestObj(manifestBytes, manifestType,
+		u.options.OSFilterList, u.options.ArchFilterList, u.options.PlatformFilterList, u.options.MetadataFilter,
+		source, nil)
+	var filteredErr *sync.FilteredError
+	if errors.As(err, &filteredErr) {
+		return fmt.Sprintf("skip locking because image is filtered: %v", err), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get manifest info: %v", err)
+	}
+	if destManifestObj == nil {
+		return "skip locking because no manifest fits platform filters", nil
+	}
+
+	filteredDigest, err := manifest.Digest(destManifestBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to get digest of filtered manifest: %v", err)
+	}
+
+	u.options.Lock.Lockfile.Add(key, u.destination.String(), manifestDigest, filteredDigest)
+	return fmt.Sprintf("locked to %v", manifestDigest), nil
+}
+
+// joinMessages joins non-empty messages in order.
+func joinMessages(messages ...string) string {
+	var result []string
+	for _, msg := range messages {
+		if msg != "" {
+			result = append(result, msg)
+		}
+	}
+	return strings.Join(result, ", ")
+}
+
+// openSource creates the image source of tagOrDigest and gets its manifest from sources in order, the first one which
+// serves the manifest will be used, and the rest will be blob fallbacks of it.
+func (u *URLTask) openSource(tagOrDigest string) (*sync.ImageSource, sync.PullSource, []byte, string, error) {
+	var errs []string
+	for index, pullSource := range u.sources {
+		url := pullSource.String() + utils.AttachConnectorToTagOrDigest(tagOrDigest)
+
+		imageSource, err := sync.NewImageSource(pullSource.Registry, pullSource.Repository,
+			tagOrDigest, pullSource.Auth)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("generate %s image source error: %v", url, err))
+			continue
+		}
+
+		manifestBytes, manifestType, err := imageSource.GetManifest()
+		if err != nil {
+			_ = imageSource.Close()
+			errs = append(errs, fmt.Sprintf("failed to get manifest of %s: %v", url, err))
+			continue
+		}
+
+		imageSource.SetBlobFallbacks(u.sources[index+1:])
+		return imageSource, pullSource, manifestBytes, manifestType, nil
+	}
+
+	return nil, sync.PullSource{}, nil, "", fmt.Errorf("%v", strings.Join(errs, "; "))
 }
 
 func (u *URLTask) GetPrimary() Task {
@@ -94,19 +237,19 @@ func (u *URLTask) Type() Type {
 }
 
 // generateSyncTasks generates blob/manifest tasks.
-func (u *URLTask) generateSyncTasks(source *sync.ImageSource, destination *sync.ImageDestination,
-	osFilterList, archFilterList []string) ([]Task, string, error) {
+func (u *URLTask) generateSyncTasks(source *sync.ImageSource, manifestBytes []byte, manifestType string,
+	destination *sync.ImageDestination, osFilterList, archFilterList, platformFilterList []string,
+	metadataFilter *types.MetadataFilter, lockedDigest digest.Digest) ([]Task, string, error) {
 	var results []Task
 	var resultMsg string
 
-	// get manifest from source
-	manifestBytes, manifestType, err := source.GetManifest()
-	if err != nil {
-		return nil, resultMsg, fmt.Errorf("failed to get manifest: %v", err)
-	}
-
 	destManifestObj, destManifestBytes, subManifestInfoSlice, err := sync.GenerateManifestObj(manifestBytes,
-		manifestType, osFilterList, archFilterList, source, nil)
+		manifestType, osFilterList, archFilterList, platformFilterList, metadataFilter, source, nil)
+	var filteredErr *sync.FilteredError
+	if errors.As(err, &filteredErr) {
+		resultMsg = fmt.Sprintf("skip synchronization because image is filtered: %v", err)
+		return nil, resultMsg, nil
+	}
 	if err != nil {
 		return nil, resultMsg, fmt.Errorf(" failed to get manifest info: %v", err)
 	}
@@ -116,7 +259,19 @@ func (u *URLTask) generateSyncTasks(source *sync.ImageSource, destination *sync.
 		return nil, resultMsg, nil
 	}
 
-	if changed := destination.CheckManifestChanged(destManifestBytes, nil); !u.forceUpdate && !changed {
+	if lockedDigest != "" {
+		// in locked mode, the manifest to push should be exactly the locked one
+		destManifestDigest, err := manifest.Digest(destManifestBytes)
+		if err != nil {
+			return nil, resultMsg, fmt.Errorf("failed to get manifest digest: %v", err)
+		}
+		if destManifestDigest != lockedDigest {
+			return nil, resultMsg, fmt.Errorf("manifest to push is %v rather than locked %v, filters might have "+
+				"changed since locking", destManifestDigest, lockedDigest)
+		}
+	}
+
+	if changed := destination.CheckManifestChanged(destManifestBytes, nil); !u.options.ForceUpdate && !changed {
 		// do nothing if image is unchanged
 		resultMsg = "skip synchronization because destination image exists"
 		return nil, resultMsg, nil
@@ -144,7 +299,8 @@ func (u *URLTask) generateSyncTasks(source *sync.ImageSource, destination *sync.
 		var ignoredManifestDigests []string
 
 		for _, mfstInfo := range subManifestInfoSlice {
-			if changed := destination.CheckManifestChanged(mfstInfo.Bytes, mfstInfo.Digest); !u.forceUpdate && !changed {
+			changed := destination.CheckManifestChanged(mfstInfo.Bytes, mfstInfo.Digest)
+			if !u.options.ForceUpdate && !changed {
 				// do nothing if manifest is unchanged
 				ignoredManifestDigests = append(ignoredManifestDigests, mfstInfo.Digest.String())
 				continue
@@ -0,0 +1,177 @@
+package task
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	containertypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/concurrent"
+	"github.com/AliyunContainerService/image-syncer/pkg/sync"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/types"
+)
+
+// testRegistry serves the manifests of references (tags or digests) and blobs under every repository.
+type testRegistry struct {
+	*httptest.Server
+
+	manifests map[string][]byte
+	blobs     map[digest.Digest][]byte
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{
+		manifests: map[string][]byte{},
+		blobs:     map[digest.Digest][]byte{},
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		name := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+
+		switch {
+		case req.URL.Path == "/v2/":
+			_, _ = w.Write([]byte("{}"))
+		case strings.Contains(req.URL.Path, "/manifests/") && r.manifests[name] != nil:
+			w.Header().Set("Content-Type", manifest.DockerV2Schema2MediaType)
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(r.manifests[name]).String())
+			_, _ = w.Write(r.manifests[name])
+		case strings.Contains(req.URL.Path, "/blobs/") && r.blobs[digest.Digest(name)] != nil:
+			_, _ = w.Write(r.blobs[digest.Digest(name)])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *testRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+// addImage adds an image whose config blob is config under tag, its manifest can also be got by the returned digest.
+func (r *testRegistry) addImage(t *testing.T, tag, config string) digest.Digest {
+	r.blobs[digest.FromString(config)] = []byte(config)
+	content, err := json.Marshal(manifest.Schema2{
+		SchemaVersion: 2,
+		MediaType:     manifest.DockerV2Schema2MediaType,
+		ConfigDescriptor: manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2ConfigMediaType,
+			Size:      int64(len(config)),
+			Digest:    digest.FromString(config),
+		},
+	})
+	assert.NoError(t, err)
+
+	manifestDigest := digest.FromBytes(content)
+	r.manifests[tag] = content
+	r.manifests[manifestDigest.String()] = content
+	return manifestDigest
+}
+
+func (r *testRegistry) pullSource() sync.PullSource {
+	return sync.PullSource{Registry: r.host(), Repository: "library/app", Auth: types.Auth{Insecure: true}}
+}
+
+func parseRepoURL(t *testing.T, url string) *utils.RepoURL {
+	urls, err := utils.GenerateRepoURLs(url, nil)
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	return urls[0]
+}
+
+func TestURLTaskFailover(t *testing.T) {
+	config := `{"architecture": "amd64", "os": "linux"}`
+
+	// the primary source doesn't have the image, and the config blob is missing in the first failover source
+	primary := newTestRegistry(t)
+	failover := newTestRegistry(t)
+	manifestDigest := failover.addImage(t, "v1", config)
+	delete(failover.blobs, digest.FromString(config))
+	backup := newTestRegistry(t)
+	backup.addImage(t, "v1", config)
+
+	lock := &Lock{Lockfile: concurrent.NewLockfile(types.NewLockfile())}
+	task := NewURLTask(parseRepoURL(t, primary.host()+"/library/app:v1"),
+		parseRepoURL(t, "registry.example.com/library/app:v1"),
+		[]sync.PullSource{primary.pullSource(), failover.pullSource(), backup.pullSource()}, types.Auth{},
+		URLTaskOptions{Lock: lock}).(*URLTask)
+
+	// the first source which serves the manifest is used, and the rest are blob fallbacks of it
+	source, served, manifestBytes, _, err := task.openSource("v1")
+	assert.NoError(t, err)
+	assert.Equal(t, failover.pullSource(), served)
+	assert.Equal(t, manifestDigest, digest.FromBytes(manifestBytes))
+
+	blob, _, err := source.GetABlob(containertypes.BlobInfo{Digest: digest.FromString(config)})
+	assert.NoError(t, err)
+	content, err := io.ReadAll(blob)
+	assert.NoError(t, err)
+	assert.NoError(t, blob.Close())
+	assert.Equal(t, config, string(content))
+	assert.NoError(t, source.Close())
+
+	// the config blob is got from the backup source while locking
+	_, message, err := task.Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "locked to "+manifestDigest.String(), message)
+
+	// errors of all the sources are reported in order
+	task.sources = []sync.PullSource{primary.pullSource(), newTestRegistry(t).pullSource()}
+	_, _, _, _, err = task.openSource("v1")
+	assert.Error(t, err)
+	errs := strings.Split(err.Error(), "; ")
+	assert.Len(t, errs, 2)
+	assert.Contains(t, errs[0], primary.host()+"/library/app:v1")
+	assert.Contains(t, errs[1], task.sources[1].String()+":v1")
+}
+
+func TestURLTaskDigestDrift(t *testing.T) {
+	registry := newTestRegistry(t)
+	pinned := registry.addImage(t, "v1", `{"architecture": "amd64", "os": "linux"}`)
+
+	newTask := func(pinned digest.Digest, digestDrift string) (Task, *Lock) {
+		lock := &Lock{Lockfile: concurrent.NewLockfile(types.NewLockfile())}
+		return NewURLTask(parseRepoURL(t, registry.host()+"/library/app:v1@"+pinned.String()),
+			parseRepoURL(t, "registry.example.com/library/app:v1"), []sync.PullSource{registry.pullSource()},
+			types.Auth{}, URLTaskOptions{DigestDrift: digestDrift, Lock: lock}), lock
+	}
+	key := types.LockKey(registry.host(), "library/app", "v1")
+
+	// the tag still resolves to the pinned digest
+	task, lock := newTask(pinned, types.DigestDriftFail)
+	_, message, err := task.Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "locked to "+pinned.String(), message)
+	image, exist := lock.Lockfile.Get(key)
+	assert.True(t, exist)
+	assert.Equal(t, pinned.String(), image.Digest)
+
+	// the tag is moved to another image
+	current := registry.addImage(t, "v1", `{"architecture": "arm64", "os": "linux"}`)
+	drift := "tag v1 has drifted from pinned digest " + pinned.String() + " to " + current.String()
+
+	task, lock = newTask(pinned, types.DigestDriftFail)
+	_, _, err = task.Run()
+	assert.EqualError(t, err, drift)
+	_, exist = lock.Lockfile.Get(key)
+	assert.False(t, exist)
+
+	// the pinned image is still synchronized under the tag with a warning
+	task, lock = newTask(pinned, types.DigestDriftWarn)
+	_, message, err = task.Run()
+	assert.NoError(t, err)
+	assert.True(t, IsWarning(message))
+	assert.Equal(t, warningPrefix+drift+", the pinned digest is synchronized, locked to "+pinned.String(), message)
+	image, exist = lock.Lockfile.Get(key)
+	assert.True(t, exist)
+	assert.Equal(t, pinned.String(), image.Digest)
+}
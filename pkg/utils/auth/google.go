@@ -9,7 +9,12 @@ import (
 	"golang.org/x/oauth2/google"
 )
 
-const Oauth2User = "_oauth2_"
+const (
+	Oauth2User = "_oauth2_"
+
+	// GCPAccessTokenUser is the username to use with an oauth2 access token of GCR
+	GCPAccessTokenUser = "oauth2accesstoken"
+)
 
 // IsGCRPermanentServiceAccountToken returns true if user is a Google permanent service account token
 func IsGCRPermanentServiceAccountToken(registry string, username string) bool {
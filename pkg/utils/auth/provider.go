@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenRefreshAhead is how long before expiry a cached token will be refreshed, to avoid it expires while a
+	// request is in flight.
+	tokenRefreshAhead = 5 * time.Minute
+)
+
+// CredentialProvider provides the username and password of a registry on demand.
+// Providers are only queried when an image source or destination is created, or when registry rejects the cached
+// credentials with a 401 response, so a token is not refreshed before it expires, but after it has been rejected.
+type CredentialProvider interface {
+	// Credentials returns the username and password, a cached value will be returned if it is still valid.
+	Credentials() (username string, password string, err error)
+
+	// Invalidate drops the cached credentials, the next call of Credentials will refresh them.
+	Invalidate()
+}
+
+// TokenFetcher gets a new token and the time it expires at. A zero expiry means the token never expires.
+type TokenFetcher func() (token string, expiry time.Time, err error)
+
+// SecretResolver resolves the username and password which might refer to secrets stored somewhere else.
+type SecretResolver interface {
+	// Resolve returns the secret value which value refers to, or value itself if it is not a reference.
+	Resolve(value string) (string, error)
+
+	// Forget drops the cached secret value of a reference.
+	Forget(value string)
+}
+
+// NewCredentialProvider creates a CredentialProvider for the username and password of a registry (or
+// registry/namespace), which will be resolved by resolver lazily if it is not nil. A nil provider will be returned
+// if username or password is empty, which means access will be anonymous.
+func NewCredentialProvider(registry, username, password string, resolver SecretResolver) CredentialProvider {
+	if username == "" || password == "" {
+		return nil
+	}
+
+	if IsGCRPermanentServiceAccountToken(registry, username) {
+		provider := NewTokenProvider(GCPAccessTokenUser, func() (string, time.Time, error) {
+			creds := password
+			if resolver != nil {
+				var err error
+				if creds, err = resolver.Resolve(password); err != nil {
+					return "", time.Time{}, err
+				}
+			}
+			return GCPTokenFromCreds(creds)
+		})
+
+		// the service account key might have been rotated if the token is rejected
+		if resolver != nil {
+			provider.forget = func() {
+				resolver.Forget(password)
+			}
+		}
+		return provider
+	}
+
+	return NewStaticProvider(username, password, resolver)
+}
+
+// StaticProvider provides a username and password which are not changed unless they refer to secrets which have
+// been rotated.
+type StaticProvider struct {
+	username string
+	password string
+
+	resolver SecretResolver
+}
+
+// NewStaticProvider creates a StaticProvider, username and password will be resolved by resolver if it is not nil.
+func NewStaticProvider(username, password string, resolver SecretResolver) *StaticProvider {
+	return &StaticProvider{
+		username: username,
+		password: password,
+		resolver: resolver,
+	}
+}
+
+// Credentials returns the username and password
+func (s *StaticProvider) Credentials() (string, string, error) {
+	if s.resolver == nil {
+		return s.username, s.password, nil
+	}
+
+	username, err := s.resolver.Resolve(s.username)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve username: %v", err)
+	}
+
+	password, err := s.resolver.Resolve(s.password)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve password: %v", err)
+	}
+
+	return username, password, nil
+}
+
+// Invalidate drops the cached secrets, so that rotated secrets will be resolved again
+func (s *StaticProvider) Invalidate() {
+	if s.resolver != nil {
+		s.resolver.Forget(s.username)
+		s.resolver.Forget(s.password)
+	}
+}
+
+// TokenProvider provides a token as password, the token is cached until shortly before it expires.
+type TokenProvider struct {
+	sync.Mutex
+
+	username string
+	fetch    TokenFetcher
+	// forget drops the cached secrets which tokens are fetched with, nil if there are none
+	forget func()
+
+	token  string
+	expiry time.Time
+}
+
+// NewTokenProvider creates a TokenProvider, tokens are fetched lazily by the first call of Credentials.
+func NewTokenProvider(username string, fetch TokenFetcher) *TokenProvider {
+	return &TokenProvider{
+		username: username,
+		fetch:    fetch,
+	}
+}
+
+// Credentials returns the cached token, or fetches a new one if the cached token is missing or about to expire.
+func (t *TokenProvider) Credentials() (string, string, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.token != "" && (t.expiry.IsZero() || time.Now().Add(tokenRefreshAhead).Before(t.expiry)) {
+		return t.username, t.token, nil
+	}
+
+	token, expiry, err := t.fetch()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch token for %v: %v", t.username, err)
+	}
+
+	t.token = token
+	t.expiry = expiry
+	return t.username, t.token, nil
+}
+
+// Invalidate drops the cached token and the secrets it is fetched with
+func (t *TokenProvider) Invalidate() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.token = ""
+	t.expiry = time.Time{}
+	if t.forget != nil {
+		t.forget()
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenProvider(t *testing.T) {
+	fetched := 0
+	expiry := time.Now().Add(time.Hour)
+	provider := NewTokenProvider("user", func() (string, time.Time, error) {
+		fetched++
+		return fmt.Sprintf("token-%d", fetched), expiry, nil
+	})
+
+	// token is cached before expiry
+	username, password, err := provider.Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "token-1", password)
+	_, password, _ = provider.Credentials()
+	assert.Equal(t, "token-1", password)
+
+	// token is refreshed after being invalidated
+	provider.Invalidate()
+	_, password, _ = provider.Credentials()
+	assert.Equal(t, "token-2", password)
+
+	// token is refreshed shortly before expiry
+	expiry = time.Now().Add(time.Minute)
+	provider.Invalidate()
+	_, password, _ = provider.Credentials()
+	assert.Equal(t, "token-3", password)
+	_, password, _ = provider.Credentials()
+	assert.Equal(t, "token-4", password)
+
+	provider = NewTokenProvider("user", func() (string, time.Time, error) {
+		return "", time.Time{}, fmt.Errorf("fetch error")
+	})
+	_, _, err = provider.Credentials()
+	assert.Error(t, err)
+}
+
+func TestNewCredentialProvider(t *testing.T) {
+	assert.Nil(t, NewCredentialProvider("docker.io", "", "password", nil))
+	assert.IsType(t, &StaticProvider{}, NewCredentialProvider("docker.io", "user", "password", nil))
+	assert.IsType(t, &TokenProvider{}, NewCredentialProvider("us.gcr.io", Oauth2User, "creds", nil))
+}
+
+type fakeResolver struct {
+	forgotten []string
+}
+
+func (f *fakeResolver) Resolve(value string) (string, error) {
+	return value, nil
+}
+
+func (f *fakeResolver) Forget(value string) {
+	f.forgotten = append(f.forgotten, value)
+}
+
+func TestInvalidateForgetsSecrets(t *testing.T) {
+	resolver := &fakeResolver{}
+	NewCredentialProvider("docker.io", "user", "exec://get-password", resolver).Invalidate()
+	assert.Equal(t, []string{"user", "exec://get-password"}, resolver.forgotten)
+
+	// the rotated service account key is read again after the token is rejected
+	resolver = &fakeResolver{}
+	NewCredentialProvider("us.gcr.io", Oauth2User, "vault://secret/gcr#key", resolver).Invalidate()
+	assert.Equal(t, []string{"vault://secret/gcr#key"}, resolver.forgotten)
+}
@@ -0,0 +1,329 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	agearmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+const (
+	// environment variables which provide decryption keys
+	AgeKeyEnv        = "IMAGE_SYNCER_AGE_KEY"
+	AgeKeyFileEnv    = "IMAGE_SYNCER_AGE_KEY_FILE"
+	PGPKeyEnv        = "IMAGE_SYNCER_PGP_KEY"
+	PGPKeyFileEnv    = "IMAGE_SYNCER_PGP_KEY_FILE"
+	PGPPassphraseEnv = "IMAGE_SYNCER_PGP_PASSPHRASE"
+
+	ageBinaryHeader  = "age-encryption.org/v1"
+	pgpMessageType   = "PGP MESSAGE"
+	pgpMessageHeader = "-----BEGIN " + pgpMessageType + "-----"
+
+	// an encrypted value is a format of "ENC[<age|pgp>,<base64 encoded ciphertext>]"
+	valuePrefix = "ENC["
+	valueSuffix = "]"
+	methodAge   = "age"
+	methodPGP   = "pgp"
+)
+
+// IsEncrypted returns true if data is a whole file encrypted by age (armored or not) or PGP (armored).
+func IsEncrypted(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return bytes.HasPrefix(data, []byte(agearmor.Header)) ||
+		bytes.HasPrefix(data, []byte(ageBinaryHeader)) ||
+		bytes.HasPrefix(data, []byte(pgpMessageHeader))
+}
+
+// IsEncryptedValue returns true if value is a single value encrypted by EncryptValue.
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, valuePrefix) && strings.HasSuffix(value, valueSuffix)
+}
+
+// Keys holds the private keys used to decrypt files and values.
+type Keys struct {
+	ageIdentities []age.Identity
+	pgpKeyRing    openpgp.EntityList
+}
+
+// LoadKeysFromEnv loads age identities from IMAGE_SYNCER_AGE_KEY or IMAGE_SYNCER_AGE_KEY_FILE, and armored PGP
+// private keys from IMAGE_SYNCER_PGP_KEY or IMAGE_SYNCER_PGP_KEY_FILE, which will be decrypted with
+// IMAGE_SYNCER_PGP_PASSPHRASE if they are protected.
+func LoadKeysFromEnv() (*Keys, error) {
+	ageKey, err := contentFromEnv(AgeKeyEnv, AgeKeyFileEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	pgpKey, err := contentFromEnv(PGPKeyEnv, PGPKeyFileEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeys(ageKey, pgpKey, []byte(os.Getenv(PGPPassphraseEnv)))
+}
+
+// NewKeys creates Keys from the content of an age identity file and an armored PGP private key, either of them
+// can be empty.
+func NewKeys(ageKey, pgpKey, pgpPassphrase []byte) (*Keys, error) {
+	keys := &Keys{}
+
+	if len(bytes.TrimSpace(ageKey)) != 0 {
+		identities, err := age.ParseIdentities(bytes.NewReader(ageKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse age identities: %v", err)
+		}
+		keys.ageIdentities = identities
+	}
+
+	if len(bytes.TrimSpace(pgpKey)) != 0 {
+		keyRing, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(pgpKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pgp private key: %v", err)
+		}
+
+		for _, entity := range keyRing {
+			if err := decryptPrivateKeys(entity, pgpPassphrase); err != nil {
+				return nil, err
+			}
+		}
+		keys.pgpKeyRing = keyRing
+	}
+
+	if len(keys.ageIdentities) == 0 && len(keys.pgpKeyRing) == 0 {
+		return nil, fmt.Errorf("no decryption key is provided, please set one of %v, %v, %v and %v",
+			AgeKeyEnv, AgeKeyFileEnv, PGPKeyEnv, PGPKeyFileEnv)
+	}
+
+	return keys, nil
+}
+
+// Decrypt decrypts a whole file encrypted by age or PGP.
+func (k *Keys) Decrypt(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(data, []byte(agearmor.Header)):
+		return k.decryptAge(agearmor.NewReader(bytes.NewReader(data)))
+	case bytes.HasPrefix(data, []byte(ageBinaryHeader)):
+		return k.decryptAge(bytes.NewReader(data))
+	case bytes.HasPrefix(data, []byte(pgpMessageHeader)):
+		block, err := pgparmor.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode pgp armor: %v", err)
+		}
+		return k.decryptPGP(block.Body)
+	default:
+		return nil, fmt.Errorf("unknown encryption format")
+	}
+}
+
+// DecryptValue decrypts a single value encrypted by EncryptValue.
+func (k *Keys) DecryptValue(value string) (string, error) {
+	if !IsEncryptedValue(value) {
+		return "", fmt.Errorf("not an encrypted value")
+	}
+
+	method, encoded, found := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(value, valuePrefix), valueSuffix), ",")
+	if !found {
+		return "", fmt.Errorf("encrypted value must be a format of ENC[<age|pgp>,<ciphertext>]")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %v", err)
+	}
+
+	var plaintext []byte
+	switch method {
+	case methodAge:
+		plaintext, err = k.decryptAge(bytes.NewReader(ciphertext))
+	case methodPGP:
+		plaintext, err = k.decryptPGP(bytes.NewReader(ciphertext))
+	default:
+		return "", fmt.Errorf("unknown encryption method %v", method)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+func (k *Keys) decryptAge(r io.Reader) ([]byte, error) {
+	if len(k.ageIdentities) == 0 {
+		return nil, fmt.Errorf("no age identity is provided")
+	}
+
+	reader, err := age.Decrypt(r, k.ageIdentities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with age: %v", err)
+	}
+
+	return io.ReadAll(reader)
+}
+
+func (k *Keys) decryptPGP(r io.Reader) ([]byte, error) {
+	if len(k.pgpKeyRing) == 0 {
+		return nil, fmt.Errorf("no pgp private key is provided")
+	}
+
+	md, err := openpgp.ReadMessage(r, k.pgpKeyRing, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with pgp: %v", err)
+	}
+
+	return io.ReadAll(md.UnverifiedBody)
+}
+
+// Recipients holds the public keys used to encrypt files and values. Only one of age and PGP can be used.
+type Recipients struct {
+	age []age.Recipient
+	pgp openpgp.EntityList
+}
+
+// NewRecipients creates Recipients from age recipients ("age1...") and the content of armored PGP public keys.
+func NewRecipients(ageRecipients []string, pgpPublicKeys [][]byte) (*Recipients, error) {
+	recipients := &Recipients{}
+
+	for _, r := range ageRecipients {
+		parsed, err := age.ParseRecipients(strings.NewReader(r))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse age recipient %v: %v", r, err)
+		}
+		recipients.age = append(recipients.age, parsed...)
+	}
+
+	for _, key := range pgpPublicKeys {
+		keyRing, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pgp public key: %v", err)
+		}
+		recipients.pgp = append(recipients.pgp, keyRing...)
+	}
+
+	if len(recipients.age) != 0 && len(recipients.pgp) != 0 {
+		return nil, fmt.Errorf("age recipients and pgp public keys cannot be used at the same time")
+	}
+
+	if len(recipients.age) == 0 && len(recipients.pgp) == 0 {
+		return nil, fmt.Errorf("no recipient is provided")
+	}
+
+	return recipients, nil
+}
+
+// Encrypt encrypts a whole file, the result is armored so that it can be committed as a text file.
+func (r *Recipients) Encrypt(data []byte) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+
+	if len(r.age) != 0 {
+		armorWriter := agearmor.NewWriter(buffer)
+		if err := r.encryptAge(armorWriter, data); err != nil {
+			return nil, err
+		}
+		if err := armorWriter.Close(); err != nil {
+			return nil, err
+		}
+	} else {
+		armorWriter, err := pgparmor.Encode(buffer, pgpMessageType, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.encryptPGP(armorWriter, data); err != nil {
+			return nil, err
+		}
+		if err := armorWriter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	buffer.WriteString("\n")
+	return buffer.Bytes(), nil
+}
+
+// EncryptValue encrypts a single value, the result is a format of "ENC[<age|pgp>,<base64 encoded ciphertext>]".
+func (r *Recipients) EncryptValue(value string) (string, error) {
+	buffer := &bytes.Buffer{}
+	method := methodAge
+
+	var err error
+	if len(r.age) != 0 {
+		err = r.encryptAge(buffer, []byte(value))
+	} else {
+		method = methodPGP
+		err = r.encryptPGP(buffer, []byte(value))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return valuePrefix + method + "," + base64.StdEncoding.EncodeToString(buffer.Bytes()) + valueSuffix, nil
+}
+
+func (r *Recipients) encryptAge(w io.Writer, data []byte) error {
+	writer, err := age.Encrypt(w, r.age...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt with age: %v", err)
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("failed to encrypt with age: %v", err)
+	}
+
+	return writer.Close()
+}
+
+func (r *Recipients) encryptPGP(w io.Writer, data []byte) error {
+	writer, err := openpgp.Encrypt(w, r.pgp, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt with pgp: %v", err)
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("failed to encrypt with pgp: %v", err)
+	}
+
+	return writer.Close()
+}
+
+func decryptPrivateKeys(entity *openpgp.Entity, passphrase []byte) error {
+	if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt(passphrase); err != nil {
+			return fmt.Errorf("failed to decrypt pgp private key, please check %v: %v", PGPPassphraseEnv, err)
+		}
+	}
+
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			if err := subkey.PrivateKey.Decrypt(passphrase); err != nil {
+				return fmt.Errorf("failed to decrypt pgp private subkey, please check %v: %v", PGPPassphraseEnv, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// contentFromEnv returns the value of contentEnv, or the content of file which fileEnv refers to.
+func contentFromEnv(contentEnv, fileEnv string) ([]byte, error) {
+	if content := os.Getenv(contentEnv); content != "" {
+		return []byte(content), nil
+	}
+
+	if path := os.Getenv(fileEnv); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %v: %v", fileEnv, err)
+		}
+		return content, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,82 @@
+package encrypt
+
+import (
+	"bytes"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAge(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+
+	recipients, err := NewRecipients([]string{identity.Recipient().String()}, nil)
+	assert.NoError(t, err)
+	keys, err := NewKeys([]byte(identity.String()), nil, nil)
+	assert.NoError(t, err)
+
+	content := []byte("quay.io:\n  username: xxx\n  password: xxxxxxxxx\n")
+	encrypted, err := recipients.Encrypt(content)
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.False(t, IsEncrypted(content))
+
+	decrypted, err := keys.Decrypt(encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, content, decrypted)
+
+	value, err := recipients.EncryptValue("password")
+	assert.NoError(t, err)
+	assert.True(t, IsEncryptedValue(value))
+
+	decryptedValue, err := keys.DecryptValue(value)
+	assert.NoError(t, err)
+	assert.Equal(t, "password", decryptedValue)
+
+	other, _ := age.GenerateX25519Identity()
+	otherKeys, _ := NewKeys([]byte(other.String()), nil, nil)
+	_, err = otherKeys.DecryptValue(value)
+	assert.Error(t, err)
+}
+
+func TestPGP(t *testing.T) {
+	entity, err := openpgp.NewEntity("image-syncer", "", "test@example.com", nil)
+	assert.NoError(t, err)
+
+	publicKey := &bytes.Buffer{}
+	writer, _ := armor.Encode(publicKey, openpgp.PublicKeyType, nil)
+	assert.NoError(t, entity.Serialize(writer))
+	assert.NoError(t, writer.Close())
+
+	privateKey := &bytes.Buffer{}
+	writer, _ = armor.Encode(privateKey, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, entity.SerializePrivate(writer, nil))
+	assert.NoError(t, writer.Close())
+
+	recipients, err := NewRecipients(nil, [][]byte{publicKey.Bytes()})
+	assert.NoError(t, err)
+	keys, err := NewKeys(nil, privateKey.Bytes(), nil)
+	assert.NoError(t, err)
+
+	content := []byte(`{"quay.io": {"username": "xxx", "password": "xxxxxxxxx"}}`)
+	encrypted, err := recipients.Encrypt(content)
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+
+	decrypted, err := keys.Decrypt(encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, content, decrypted)
+
+	value, err := recipients.EncryptValue("password")
+	assert.NoError(t, err)
+	decryptedValue, err := keys.DecryptValue(value)
+	assert.NoError(t, err)
+	assert.Equal(t, "password", decryptedValue)
+
+	_, err = NewKeys(nil, nil, nil)
+	assert.Error(t, err)
+}
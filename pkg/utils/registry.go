@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// placeholderRegistry takes the place of the registries which docker references cannot express while urls are
+// parsed, i.e., IPv6 literal hosts and registries served under a path prefix.
+const placeholderRegistry = "explicit-registry.invalid"
+
+// URLParser parses image urls with the registries served under a path prefix, e.g.,
+// "artifactory.example.com/artifactory/api/docker/docker-local", the part of an url after one of them is parsed as
+// repository. A nil URLParser knows no such registries.
+type URLParser struct {
+	// prefixes are the registries served under a path prefix, longer ones come first
+	prefixes []string
+}
+
+// NewURLParser creates a URLParser with the registries served under a path prefix.
+func NewURLParser(prefixes []string) *URLParser {
+	sorted := RemoveDuplicateItems(append([]string{}, prefixes...))
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	return &URLParser{prefixes: sorted}
+}
+
+// RegistryPrefix returns the registry boundary of host and base path, e.g.,
+// "artifactory.example.com/artifactory/api/docker/docker-local" for "artifactory.example.com" and
+// "/artifactory/api/docker/docker-local/".
+func RegistryPrefix(host, basePath string) (string, error) {
+	basePath = strings.Trim(basePath, "/")
+	if basePath == "" {
+		return host, nil
+	}
+
+	for _, component := range strings.Split(basePath, "/") {
+		if component == "" || component == "." || component == ".." || strings.ContainsAny(component, "?#%:@ ") {
+			return "", fmt.Errorf("invalid base path %q", basePath)
+		}
+	}
+	return host + "/" + basePath, nil
+}
+
+// SplitExplicitRegistry splits url into registry and the rest part if its registry cannot be expressed by docker
+// references, which is an IPv6 literal host like "[fd00::1]:5000" or a registry served under a path prefix.
+func (p *URLParser) SplitExplicitRegistry(url string) (registry string, rest string, ok bool) {
+	if p != nil {
+		for _, prefix := range p.prefixes {
+			if rest, found := strings.CutPrefix(url, prefix+"/"); found {
+				return prefix, rest, true
+			}
+		}
+	}
+
+	if strings.HasPrefix(url, "[") {
+		if slash := strings.Index(url, "/"); slash != -1 && strings.Contains(url[:slash], "]") {
+			return url[:slash], url[slash+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
+// IsExplicitRegistry returns true if a registry split from url cannot be expressed by docker references, which is an
+// IPv6 literal host or a registry served under a path prefix.
+func IsExplicitRegistry(registry string) bool {
+	return strings.HasPrefix(registry, "[") || strings.Contains(registry, "/")
+}
+
+// SplitRegistryHost splits a registry into host and path prefix, e.g., "artifactory.example.com" and
+// "/artifactory/api/docker/docker-local" for "artifactory.example.com/artifactory/api/docker/docker-local".
+func SplitRegistryHost(registry string) (host string, pathPrefix string) {
+	if slash := strings.Index(registry, "/"); slash != -1 {
+		return registry[:slash], registry[slash:]
+	}
+	return registry, ""
+}
+
+// maskRegistry replaces the explicit registry of url with placeholderRegistry, so that it can be parsed as a docker
+// reference. The origin registry is returned if url is masked.
+func (p *URLParser) maskRegistry(url string) (string, string) {
+	registry, rest, ok := p.SplitExplicitRegistry(url)
+	if !ok {
+		return url, ""
+	}
+	return placeholderRegistry + "/" + rest, registry
+}
+
+// unmaskRegistry converts a masked url back with the origin registry.
+func unmaskRegistry(url, registry string) string {
+	if registry == "" {
+		return url
+	}
+	if rest, found := strings.CutPrefix(url, placeholderRegistry); found {
+		return registry + rest
+	}
+	return url
+}
@@ -0,0 +1,205 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/encrypt"
+)
+
+const (
+	FilePrefix  = "file://"
+	ExecPrefix  = "exec://"
+	VaultPrefix = "vault://"
+
+	execTimeout = time.Minute
+)
+
+// IsReference returns true if value refers to a secret stored somewhere else rather than the secret itself.
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, FilePrefix) ||
+		strings.HasPrefix(value, ExecPrefix) ||
+		strings.HasPrefix(value, VaultPrefix) ||
+		encrypt.IsEncryptedValue(value)
+}
+
+// IsLocalReference returns true if value refers to a local file or a command, which should only be resolved if value
+// comes from a trusted source.
+func IsLocalReference(value string) bool {
+	return strings.HasPrefix(value, FilePrefix) || strings.HasPrefix(value, ExecPrefix)
+}
+
+// Resolver resolves secret references lazily and caches the results. Secret values are never included in the
+// returned errors, so that they will not appear in logs.
+type Resolver struct {
+	// the lock only guards cache, vault and keys, secrets are resolved with the lock of each reference, so that a
+	// slow command or Vault request doesn't block the other references
+	sync.Mutex
+
+	cache map[string]*cachedSecret
+	vault *vaultClient
+	keys  *encrypt.Keys
+}
+
+// cachedSecret is the secret value of a reference, it's resolved once by the first caller and shared by the others
+type cachedSecret struct {
+	sync.Mutex
+
+	value    string
+	resolved bool
+}
+
+// NewResolver creates a Resolver, Vault and decryption keys are configured by environment variables when they are
+// used at the first time.
+func NewResolver() *Resolver {
+	return &Resolver{
+		cache: map[string]*cachedSecret{},
+	}
+}
+
+// Resolve returns the secret value which value refers to, or value itself if it is not a reference.
+//   - file://<path> reads the content of a file
+//   - exec://<command> runs a shell command and uses its stdout
+//   - vault://<path>#<key> reads a field of a HashiCorp Vault KV secret
+//   - ENC[<age|pgp>,<ciphertext>] decrypts an encrypted value
+//
+// The trailing newline of file content and command output is trimmed.
+func (r *Resolver) Resolve(value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+
+	r.Lock()
+	secret, exist := r.cache[value]
+	if !exist {
+		secret = &cachedSecret{}
+		r.cache[value] = secret
+	}
+	r.Unlock()
+
+	secret.Lock()
+	defer secret.Unlock()
+
+	if secret.resolved {
+		return secret.value, nil
+	}
+
+	result, err := r.resolve(value)
+	if err != nil {
+		return "", err
+	}
+
+	secret.value, secret.resolved = result, true
+	return result, nil
+}
+
+// resolve reads the secret value of a reference without cache.
+func (r *Resolver) resolve(value string) (string, error) {
+	var result string
+	var err error
+
+	switch {
+	case strings.HasPrefix(value, FilePrefix):
+		result, err = readFile(strings.TrimPrefix(value, FilePrefix))
+	case strings.HasPrefix(value, ExecPrefix):
+		result, err = execCommand(strings.TrimPrefix(value, ExecPrefix))
+	case strings.HasPrefix(value, VaultPrefix):
+		vault, vaultErr := r.vaultClient()
+		if vaultErr != nil {
+			return "", fmt.Errorf("failed to resolve %v: %v", value, vaultErr)
+		}
+		result, err = vault.read(strings.TrimPrefix(value, VaultPrefix))
+	case encrypt.IsEncryptedValue(value):
+		keys, keysErr := r.decryptionKeys()
+		if keysErr != nil {
+			// the ciphertext is too long to be printed
+			return "", fmt.Errorf("failed to decrypt value: %v", keysErr)
+		}
+		if result, err = keys.DecryptValue(value); err != nil {
+			return "", fmt.Errorf("failed to decrypt value: %v", err)
+		}
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %v: %v", value, err)
+	}
+	return result, nil
+}
+
+// vaultClient returns the Vault client configured by environment variables, which is created at the first time.
+func (r *Resolver) vaultClient() (*vaultClient, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.vault == nil {
+		vault, err := newVaultClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		r.vault = vault
+	}
+	return r.vault, nil
+}
+
+// decryptionKeys returns the decryption keys configured by environment variables, which are loaded at the first time.
+func (r *Resolver) decryptionKeys() (*encrypt.Keys, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.keys == nil {
+		keys, err := encrypt.LoadKeysFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		r.keys = keys
+	}
+	return r.keys, nil
+}
+
+// Forget drops the cached secret value of a reference, it will be resolved again next time. A resolution in progress
+// is not affected, but its result will not be cached any more.
+func (r *Resolver) Forget(value string) {
+	r.Lock()
+	delete(r.cache, value)
+	vault := r.vault
+	r.Unlock()
+
+	if vault != nil && strings.HasPrefix(value, VaultPrefix) {
+		vault.forget(strings.TrimPrefix(value, VaultPrefix))
+	}
+}
+
+func readFile(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("file path is empty")
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func execCommand(command string) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", fmt.Errorf("command is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	// neither stdout nor stderr is included in error, because they might contain the secret
+	output, err := exec.CommandContext(ctx, "sh", "-c", command).Output()
+	if err != nil {
+		return "", fmt.Errorf("command failed: %v", err)
+	}
+
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
@@ -0,0 +1,151 @@
+package secret
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveFileAndExec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "harbor")
+	assert.NoError(t, os.WriteFile(path, []byte("file-secret\n"), 0600))
+
+	resolver := NewResolver()
+
+	value, err := resolver.Resolve("plain")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", value)
+
+	value, err = resolver.Resolve(FilePrefix + path)
+	assert.NoError(t, err)
+	assert.Equal(t, "file-secret", value)
+
+	// cached until forgotten
+	assert.NoError(t, os.WriteFile(path, []byte("rotated"), 0600))
+	value, _ = resolver.Resolve(FilePrefix + path)
+	assert.Equal(t, "file-secret", value)
+	resolver.Forget(FilePrefix + path)
+	value, _ = resolver.Resolve(FilePrefix + path)
+	assert.Equal(t, "rotated", value)
+
+	value, err = resolver.Resolve(ExecPrefix + "echo exec-secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "exec-secret", value)
+
+	t.Setenv("TEST_SECRET", "leaked-secret")
+	_, err = resolver.Resolve(ExecPrefix + "echo $TEST_SECRET && exit 1")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "leaked-secret")
+
+	_, err = resolver.Resolve(FilePrefix + filepath.Join(t.TempDir(), "not-exist"))
+	assert.Error(t, err)
+}
+
+func TestResolveVault(t *testing.T) {
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			logins++
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"approle-token"}}`))
+		case "/v1/secret/data/registry":
+			if token := r.Header.Get("X-Vault-Token"); token != "root-token" && token != "approle-token" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":{"data":{"username":"robot","password":"vault-secret"},"metadata":{"version":1}}}`))
+		case "/v1/kv/registry":
+			_, _ = w.Write([]byte(`{"data":{"password":"kv1-secret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "root-token")
+
+	resolver := NewResolver()
+	value, err := resolver.Resolve(VaultPrefix + "secret/data/registry#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "vault-secret", value)
+
+	value, err = resolver.Resolve(VaultPrefix + "secret/data/registry#username")
+	assert.NoError(t, err)
+	assert.Equal(t, "robot", value)
+
+	value, err = resolver.Resolve(VaultPrefix + "kv/registry#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "kv1-secret", value)
+
+	_, err = resolver.Resolve(VaultPrefix + "secret/data/registry#token")
+	assert.Error(t, err)
+
+	_, err = resolver.Resolve(VaultPrefix + "secret/data/registry")
+	assert.Error(t, err)
+
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+
+	resolver = NewResolver()
+	value, err = resolver.Resolve(VaultPrefix + "secret/data/registry#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "vault-secret", value)
+	assert.Equal(t, 1, logins)
+
+	// login again after being forgotten
+	resolver.Forget(VaultPrefix + "secret/data/registry#password")
+	_, err = resolver.Resolve(VaultPrefix + "secret/data/registry#password")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, logins)
+}
+
+func TestResolveConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "harbor")
+	assert.NoError(t, os.WriteFile(path, []byte("file-secret"), 0600))
+
+	resolver := NewResolver()
+
+	// a slow command doesn't block the other references
+	slow := make(chan error)
+	go func() {
+		_, err := resolver.Resolve(ExecPrefix + "sleep 2 && echo slow-secret")
+		slow <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	value, err := resolver.Resolve(FilePrefix + path)
+	assert.NoError(t, err)
+	assert.Equal(t, "file-secret", value)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.NoError(t, <-slow)
+
+	// a reference is resolved once by concurrent callers
+	counter := filepath.Join(dir, "counter")
+	command := ExecPrefix + "echo run >> " + counter + " && sleep 0.2 && echo exec-secret"
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := resolver.Resolve(command)
+			assert.NoError(t, err)
+			assert.Equal(t, "exec-secret", value)
+		}()
+	}
+	wg.Wait()
+
+	content, err := os.ReadFile(counter)
+	assert.NoError(t, err)
+	assert.Equal(t, "run\n", string(content))
+}
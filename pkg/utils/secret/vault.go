@@ -0,0 +1,213 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	vaultRequestTimeout = 30 * time.Second
+
+	defaultVaultAppRolePath = "approle"
+)
+
+// vaultClient reads secrets from the KV secrets engine of HashiCorp Vault, authenticated by a token or AppRole. It's
+// safe to read secrets concurrently, the lock only guards token and data but not the requests.
+type vaultClient struct {
+	sync.Mutex
+	// loginLock makes concurrent reads share one AppRole login
+	loginLock sync.Mutex
+
+	client *http.Client
+
+	address   string
+	namespace string
+
+	token string
+
+	// AppRole is used to login if token is empty
+	appRolePath string
+	roleID      string
+	secretID    string
+
+	// secret data of each path, a path might be referred by more than one keys
+	data map[string]gjson.Result
+}
+
+// newVaultClientFromEnv creates a vaultClient configured by VAULT_ADDR, VAULT_NAMESPACE, VAULT_TOKEN, or
+// VAULT_ROLE_ID, VAULT_SECRET_ID and VAULT_APPROLE_PATH for AppRole.
+func newVaultClientFromEnv() (*vaultClient, error) {
+	address := os.Getenv("VAULT_ADDR")
+	if address == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is not set")
+	}
+
+	client := &vaultClient{
+		client:      &http.Client{Timeout: vaultRequestTimeout},
+		address:     strings.TrimSuffix(address, "/"),
+		namespace:   os.Getenv("VAULT_NAMESPACE"),
+		token:       os.Getenv("VAULT_TOKEN"),
+		appRolePath: os.Getenv("VAULT_APPROLE_PATH"),
+		roleID:      os.Getenv("VAULT_ROLE_ID"),
+		secretID:    os.Getenv("VAULT_SECRET_ID"),
+		data:        map[string]gjson.Result{},
+	}
+
+	if client.appRolePath == "" {
+		client.appRolePath = defaultVaultAppRolePath
+	}
+
+	if client.token == "" && (client.roleID == "" || client.secretID == "") {
+		return nil, fmt.Errorf("neither VAULT_TOKEN nor VAULT_ROLE_ID and VAULT_SECRET_ID is set")
+	}
+
+	return client, nil
+}
+
+// read returns a field of secret, ref is a format of "<path>#<key>", e.g., "secret/data/registry#password".
+// Both KV version 1 and version 2 paths are supported.
+func (v *vaultClient) read(ref string) (string, error) {
+	path, key, found := strings.Cut(ref, "#")
+	if !found || path == "" || key == "" {
+		return "", fmt.Errorf("vault reference must be a format of <path>#<key>")
+	}
+
+	v.Lock()
+	data, exist := v.data[path]
+	v.Unlock()
+
+	if !exist {
+		token, err := v.clientToken()
+		if err != nil {
+			return "", err
+		}
+
+		body, err := v.request(http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"), nil, token)
+		if err != nil {
+			return "", err
+		}
+
+		// KV version 2 wraps the secret in an extra "data" object
+		data = gjson.GetBytes(body, "data")
+		if inner := data.Get("data"); inner.IsObject() && data.Get("metadata").Exists() {
+			data = inner
+		}
+		v.Lock()
+		v.data[path] = data
+		v.Unlock()
+	}
+
+	value := data.Get(gjson.Escape(key))
+	if !value.Exists() {
+		return "", fmt.Errorf("key %v not found in vault path %v", key, path)
+	}
+
+	return value.String(), nil
+}
+
+// forget drops the cached secret data of the path which ref refers to, and the token got by AppRole which might
+// have expired.
+func (v *vaultClient) forget(ref string) {
+	v.Lock()
+	defer v.Unlock()
+
+	path, _, _ := strings.Cut(ref, "#")
+	delete(v.data, path)
+
+	if v.roleID != "" && v.secretID != "" {
+		v.token = ""
+	}
+}
+
+// clientToken returns the token to read secrets, which is got by AppRole if it's not provided or has been forgotten.
+func (v *vaultClient) clientToken() (string, error) {
+	v.loginLock.Lock()
+	defer v.loginLock.Unlock()
+
+	v.Lock()
+	token := v.token
+	v.Unlock()
+	if token != "" {
+		return token, nil
+	}
+
+	token, err := v.login()
+	if err != nil {
+		return "", err
+	}
+
+	v.Lock()
+	v.token = token
+	v.Unlock()
+	return token, nil
+}
+
+// login gets a client token by AppRole.
+func (v *vaultClient) login() (string, error) {
+	payload, _ := json.Marshal(map[string]string{
+		"role_id":   v.roleID,
+		"secret_id": v.secretID,
+	})
+
+	body, err := v.request(http.MethodPost, "/v1/auth/"+v.appRolePath+"/login", payload, "")
+	if err != nil {
+		return "", fmt.Errorf("approle login failed: %v", err)
+	}
+
+	token := gjson.GetBytes(body, "auth.client_token").String()
+	if token == "" {
+		return "", fmt.Errorf("approle login failed: no client token returned")
+	}
+	return token, nil
+}
+
+// request sends a request to Vault, it's not authenticated if token is empty.
+func (v *vaultClient) request(method, path string, payload []byte, token string) ([]byte, error) {
+	req, err := http.NewRequest(method, v.address+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// the response body of an error only contains error messages
+		return nil, fmt.Errorf("vault returns status code %v: %v", resp.StatusCode,
+			strings.Join(gjsonStrings(gjson.GetBytes(body, "errors")), "; "))
+	}
+
+	return body, nil
+}
+
+func gjsonStrings(result gjson.Result) []string {
+	var strs []string
+	for _, item := range result.Array() {
+		strs = append(strs, item.String())
+	}
+	return strs
+}
@@ -1,8 +1,44 @@
 package types
 
+import "github.com/AliyunContainerService/image-syncer/pkg/utils/auth"
+
 // Auth describes the authentication information of a registry or a repository
 type Auth struct {
 	Username string `json:"username" yaml:"username"`
 	Password string `json:"password" yaml:"password"`
 	Insecure bool   `json:"insecure" yaml:"insecure"`
+
+	// CAFile is a PEM bundle of CA certificates trusted besides the system ones
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	// CertFile and KeyFile are PEM files of the client certificate and key for mutual TLS
+	CertFile string `json:"certFile,omitempty" yaml:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	// ServerName is used to verify the certificate of registry instead of its hostname
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	// MinTLSVersion is the minimum TLS version accepted, e.g., "1.2" or "1.3"
+	MinTLSVersion string `json:"minTLSVersion,omitempty" yaml:"minTLSVersion,omitempty"`
+
+	// Proxy is the url of a http, https or socks5 proxy, "direct" means proxy environment variables are ignored
+	Proxy string `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+	// Resolve overrides the addresses of hosts like "/etc/hosts", e.g., {"harbor.example.com": "10.0.0.10"}
+	Resolve map[string]string `json:"resolve,omitempty" yaml:"resolve,omitempty"`
+	// PlainHTTP means registry is a http service, unlike Insecure, https will not be tried
+	PlainHTTP bool `json:"plainHTTP,omitempty" yaml:"plainHTTP,omitempty"`
+	// ConnectTimeout and ResponseTimeout are durations like "10s", ResponseTimeout limits the time to wait for
+	// response headers, which doesn't include the time to transfer blobs
+	ConnectTimeout  string `json:"connectTimeout,omitempty" yaml:"connectTimeout,omitempty"`
+	ResponseTimeout string `json:"responseTimeout,omitempty" yaml:"responseTimeout,omitempty"`
+
+	// BasePath is the path prefix which registry API is served under, e.g., "/artifactory/api/docker/docker-local",
+	// the part of image urls after it is parsed as repository.
+	BasePath string `json:"basePath,omitempty" yaml:"basePath,omitempty"`
+
+	// Catalog is the API used to list repositories for wildcard sources, which is "registry", "harbor", "dockerhub"
+	// or "azure". It is "dockerhub" for docker.io, "azure" for *.azurecr.io, and "registry" (the "/v2/_catalog"
+	// endpoint) for the others by default.
+	Catalog string `json:"catalog,omitempty" yaml:"catalog,omitempty"`
+
+	// Credential provides username and password on demand, it is generated from Username and Password at runtime
+	// and shared by all the tasks which use this authentication information. Access will be anonymous if it is nil.
+	Credential auth.CredentialProvider `json:"-" yaml:"-"`
 }
@@ -0,0 +1,120 @@
+package types
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// IncludeKey is the reserved key of images file which includes other images files
+	IncludeKey = "include"
+	// DefaultsKey is the reserved key of images file whose settings are inherited by rules
+	DefaultsKey = "defaults"
+
+	// namespaceKey is the key of defaults which rules without destinations are synchronized to
+	namespaceKey = "namespace"
+	// repositoryMappingKey is the key of repository mapping in rule object
+	repositoryMappingKey = "repositoryMapping"
+)
+
+// RuleDefaults are the settings inherited by the rules of an images file and the files it includes, a rule
+// overrides them with its own settings. It's kept in the form of json value so that it can be merged with rules
+// before they are parsed.
+type RuleDefaults map[string]interface{}
+
+// NewRuleDefaults checks the "defaults" section of images file, which can have the options of rule object except
+// source, destinations, failover, enabled and matrix, and a namespace (registry[/namespace]) which the rules without
+// destinations are synchronized to. The repository mapping of defaults only works for the rules synchronized to
+// namespace.
+func NewRuleDefaults(value interface{}) (RuleDefaults, error) {
+	if value == nil {
+		return RuleDefaults{}, nil
+	}
+
+	object, ok := toJSONValue(value).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("defaults should be an object")
+	}
+
+	options := map[string]interface{}{}
+	for key, item := range object {
+		switch key {
+		case "source", "destinations", "failover", "enabled", "matrix":
+			return nil, fmt.Errorf("%v is not supported in defaults", key)
+		case namespaceKey:
+			namespace, ok := item.(string)
+			if !ok || namespace == "" {
+				return nil, fmt.Errorf("namespace of defaults should be a non-empty string")
+			}
+			object[key] = os.ExpandEnv(namespace)
+		default:
+			options[key] = item
+		}
+	}
+
+	ruleObj, err := decodeRuleObject(options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid defaults: %v", err)
+	}
+	if err = applyRuleOptions(&Rule{}, ruleObj); err != nil {
+		return nil, fmt.Errorf("invalid defaults: %v", err)
+	}
+	if _, err = parseDestinationSetNames(ruleObj.DestinationSets); err != nil {
+		return nil, fmt.Errorf("invalid defaults: %v", err)
+	}
+
+	return object, nil
+}
+
+// Merge returns the defaults which take the settings of other in place of d.
+func (d RuleDefaults) Merge(other RuleDefaults) RuleDefaults {
+	result := RuleDefaults{}
+	for key, item := range d {
+		result[key] = item
+	}
+	for key, item := range other {
+		result[key] = item
+	}
+	return result
+}
+
+// Apply returns the value of a rule in images file with the settings of defaults which it doesn't have. A rule in
+// the form of destination string or list is converted into object form if defaults is not empty.
+func (d RuleDefaults) Apply(value interface{}) interface{} {
+	if len(d) == 0 {
+		return value
+	}
+
+	object, ok := toJSONValue(value).(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{}
+		if value != nil && value != "" {
+			object["destinations"] = toJSONValue(value)
+		}
+	}
+
+	for key, item := range d {
+		if key == namespaceKey || key == repositoryMappingKey {
+			continue
+		}
+		if _, exist := object[key]; !exist {
+			object[key] = item
+		}
+	}
+
+	// repository mapping of defaults only works with namespace, which is not used by the rules referring to
+	// destination sets
+	_, hasSets := object[DestinationSetsKey]
+	if namespace, exist := d[namespaceKey]; exist && !hasSets {
+		if _, exist = object["destinations"]; !exist {
+			object["destinations"] = namespace
+			if _, exist = object[repositoryMappingKey]; !exist {
+				object[repositoryMappingKey] = map[string]interface{}{}
+				if mapping, exist := d[repositoryMappingKey]; exist {
+					object[repositoryMappingKey] = mapping
+				}
+			}
+		}
+	}
+	return object
+}
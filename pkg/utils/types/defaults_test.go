@@ -0,0 +1,77 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRuleDefaults(t *testing.T) {
+	var origin map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+defaults:
+  namespace: registry.example.com/team-a
+  platforms: [linux/amd64]
+  retries: 3
+  repositoryMapping:
+    strip: 1
+`), &origin))
+
+	defaults, err := NewRuleDefaults(origin[DefaultsKey])
+	assert.NoError(t, err)
+
+	defaults = RuleDefaults{"force": true, "retries": 1}.Merge(defaults)
+	assert.Equal(t, 3, defaults["retries"])
+	assert.Equal(t, true, defaults["force"])
+
+	// rules without destinations are synchronized to namespace
+	rules, err := NewImageList(map[string]interface{}{
+		"docker.io/library/nginx:1.25": defaults.Apply(nil),
+		"docker.io/library/redis:7":    defaults.Apply("registry.example.com/redis"),
+		"quay.io/org/app:v1": defaults.Apply(map[interface{}]interface{}{
+			"platforms": []interface{}{"linux/arm64"},
+			"retries":   0,
+		}),
+	}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 3)
+
+	force, retries, noRetries := true, 3, 0
+	assert.Equal(t, &Rule{
+		Name:              "docker.io/library/nginx:1.25",
+		Source:            "docker.io/library/nginx:1.25",
+		Destinations:      []string{"registry.example.com/team-a"},
+		Platforms:         []string{"linux/amd64"},
+		Force:             &force,
+		Retries:           &retries,
+		RepositoryMapping: &RepositoryMapping{Strip: 1},
+	}, rules[0])
+	assert.Equal(t, []string{"registry.example.com/redis"}, rules[1].Destinations)
+	assert.Nil(t, rules[1].RepositoryMapping)
+	assert.Equal(t, []string{"linux/arm64"}, rules[2].Platforms)
+	assert.Equal(t, &noRetries, rules[2].Retries)
+	assert.Equal(t, []string{"registry.example.com/team-a"}, rules[2].Destinations)
+
+	// namespace is not used by the rules referring to destination sets
+	assert.Equal(t, map[string]interface{}{
+		"destinationSets": "acr",
+		"force":           true,
+		"platforms":       []interface{}{"linux/amd64"},
+		"retries":         3,
+	}, defaults.Apply(map[interface{}]interface{}{"destinationSets": "acr"}))
+
+	// rules are kept if defaults is empty
+	assert.Equal(t, "registry.example.com/redis", RuleDefaults{}.Apply("registry.example.com/redis"))
+
+	_, err = NewRuleDefaults(map[interface{}]interface{}{"destinations": "registry.example.com/ns"})
+	assert.ErrorContains(t, err, "destinations is not supported in defaults")
+	_, err = NewRuleDefaults(map[interface{}]interface{}{"retries": -1})
+	assert.ErrorContains(t, err, "retries should not be negative")
+	_, err = NewRuleDefaults(map[interface{}]interface{}{"destinationSets": 1})
+	assert.ErrorContains(t, err, "destinationSets should be a name or a list of names")
+	_, err = NewRuleDefaults(map[interface{}]interface{}{"unknown": 1})
+	assert.ErrorContains(t, err, "unknown field")
+	_, err = NewRuleDefaults("registry.example.com/ns")
+	assert.EqualError(t, err, "defaults should be an object")
+}
@@ -0,0 +1,170 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+)
+
+// DestinationSetsKey is the reserved key of images file which defines destination sets, and the key of rule object
+// which refers to them by name
+const DestinationSetsKey = "destinationSets"
+
+// defaultDestinationPath keeps the repository path of source under each prefix
+const defaultDestinationPath = "{{.repository}}"
+
+// DestinationSet is a named list of destination prefixes (registry[/namespace]) which rules can refer to instead of
+// repeating destinations. The destination of each prefix is the prefix joined with Path, a template rendered with
+// the source of rule, e.g., "{{.namespace}}-{{.name}}" for "docker.io/library/nginx" is "library-nginx". The
+// variables are registry, repository, namespace (repository without the last component), name (the last component
+// of repository) and the variables of matrix rule.
+type DestinationSet struct {
+	Prefixes []string `json:"prefixes"`
+	Path     string   `json:"path"`
+}
+
+// DestinationSets are the destination sets of images file by name
+type DestinationSets map[string]*DestinationSet
+
+// NewDestinationSets parses the "destinationSets" section of images file, which is an object of destination sets
+// by name. Parsed destination sets, e.g., the ones merged from several images files, are returned as they are.
+func NewDestinationSets(value interface{}) (DestinationSets, error) {
+	result := DestinationSets{}
+	if value == nil {
+		return result, nil
+	}
+	if sets, ok := value.(DestinationSets); ok {
+		return sets, nil
+	}
+
+	object, ok := toJSONValue(value).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("destination sets should be an object")
+	}
+
+	for name, item := range object {
+		set := &DestinationSet{}
+		if err := decodeStrict(item, set); err != nil {
+			return nil, fmt.Errorf("invalid destination set %v: %v", name, err)
+		}
+		if err := set.check(); err != nil {
+			return nil, fmt.Errorf("invalid destination set %v: %v", name, err)
+		}
+		result[name] = set
+	}
+	return result, nil
+}
+
+// check checks if the prefixes and path template of set are valid, and expands environment variables in prefixes.
+func (s *DestinationSet) check() error {
+	if len(s.Prefixes) == 0 {
+		return fmt.Errorf("prefixes should not be empty")
+	}
+
+	for index, prefix := range s.Prefixes {
+		prefix = strings.TrimSuffix(os.ExpandEnv(prefix), "/")
+		if prefix == "" {
+			return fmt.Errorf("empty prefix is not supported")
+		}
+		s.Prefixes[index] = prefix
+	}
+	s.Prefixes = utils.RemoveDuplicateItems(s.Prefixes)
+
+	if s.Path == "" {
+		s.Path = defaultDestinationPath
+	}
+	if _, err := template.New("path").Parse(s.Path); err != nil {
+		return fmt.Errorf("invalid path template %q: %v", s.Path, err)
+	}
+	return nil
+}
+
+// Destinations returns the destinations of rule in the destination sets of names in order.
+func (s DestinationSets) Destinations(rule *Rule, names []string, parser *utils.URLParser) ([]string, error) {
+	variables, err := sourceVariables(rule.Source, parser)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range rule.Variables {
+		variables[name] = value
+	}
+
+	var result []string
+	for _, name := range names {
+		set, exist := s[name]
+		if !exist {
+			return nil, fmt.Errorf("destination set %v is not defined", name)
+		}
+
+		repository, err := renderTemplate(set.Path, variables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render path of destination set %v: %v", name, err)
+		}
+		repository = strings.Trim(repository, "/")
+		if repository == "" {
+			return nil, fmt.Errorf("path of destination set %v is rendered to empty", name)
+		}
+
+		for _, prefix := range set.Prefixes {
+			result = append(result, prefix+"/"+repository)
+		}
+	}
+	return result, nil
+}
+
+// sourceVariables returns the variables of source which path templates of destination sets are rendered with, the
+// last component of a wildcard source is kept as "*" so that destinations have the "*" substitution.
+func sourceVariables(source string, parser *utils.URLParser) (map[string]string, error) {
+	var registry, repository string
+	if parser.IsWildcardURL(source) {
+		wildcard, err := parser.ParseWildcardURL(source)
+		if err != nil {
+			return nil, err
+		}
+		registry, repository = wildcard.Registry, path.Join(wildcard.Namespace, "*")
+	} else {
+		var err error
+		if registry, repository, err = parser.ParseRepositoryOfURL(source); err != nil {
+			return nil, err
+		}
+	}
+
+	namespace, name := path.Split(repository)
+	return map[string]string{
+		"registry":   registry,
+		"repository": repository,
+		"namespace":  strings.TrimSuffix(namespace, "/"),
+		"name":       name,
+	}, nil
+}
+
+// parseDestinationSetNames returns the names of destination sets referred by a rule, which is a string or a list of
+// strings.
+func parseDestinationSetNames(value interface{}) ([]string, error) {
+	invalidErr := fmt.Errorf("destinationSets should be a name or a list of names")
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, invalidErr
+		}
+		return []string{v}, nil
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok || name == "" {
+				return nil, invalidErr
+			}
+			result = append(result, name)
+		}
+		return utils.RemoveDuplicateItems(result), nil
+	}
+	return nil, invalidErr
+}
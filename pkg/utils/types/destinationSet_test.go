@@ -0,0 +1,105 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+)
+
+func TestDestinationSets(t *testing.T) {
+	var origin map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+destinationSets:
+  acr:
+    prefixes:
+      - registry.cn-hangzhou.aliyuncs.com/mirror
+      - registry.cn-beijing.aliyuncs.com/mirror/
+  flat:
+    prefixes: [registry.example.com/flat]
+    path: "{{.namespace}}-{{.name}}"
+docker.io/library/nginx:1.25:
+  destinationSets: acr
+docker.io/library/redis:7:
+  destinationSets: [acr, flat]
+  destinations: registry.example.com/redis
+"docker.io/library/python:{{.version}}":
+  matrix:
+    version: ["3.12"]
+  destinationSets: flat
+harbor.corp/platform/*:latest:
+  destinationSets: acr
+`), &origin))
+
+	rules, err := NewImageList(origin, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 4)
+
+	assert.Equal(t, "docker.io/library/nginx:1.25", rules[0].Source)
+	assert.Equal(t, []string{
+		"registry.cn-hangzhou.aliyuncs.com/mirror/library/nginx",
+		"registry.cn-beijing.aliyuncs.com/mirror/library/nginx",
+	}, rules[0].Destinations)
+
+	assert.Equal(t, "docker.io/library/python:3.12", rules[1].Source)
+	assert.Equal(t, []string{"registry.example.com/flat/library-python"}, rules[1].Destinations)
+
+	// destinations of rule come first
+	assert.Equal(t, []string{
+		"registry.example.com/redis",
+		"registry.cn-hangzhou.aliyuncs.com/mirror/library/redis",
+		"registry.cn-beijing.aliyuncs.com/mirror/library/redis",
+		"registry.example.com/flat/library-redis",
+	}, rules[2].Destinations)
+
+	// "*" of wildcard source is kept for substitution
+	assert.Equal(t, []string{
+		"registry.cn-hangzhou.aliyuncs.com/mirror/platform/*",
+		"registry.cn-beijing.aliyuncs.com/mirror/platform/*",
+	}, rules[3].Destinations)
+
+	_, err = NewImageList(map[string]interface{}{
+		"docker.io/library/nginx:1.25": map[string]interface{}{"destinationSets": "acr"},
+	}, nil)
+	assert.ErrorContains(t, err, "destination set acr is not defined")
+
+	_, err = NewImageList(map[string]interface{}{
+		"docker.io/library/nginx:1.25": map[string]interface{}{"destinationSets": []interface{}{1}},
+	}, nil)
+	assert.ErrorContains(t, err, "destinationSets should be a name or a list of names")
+
+	_, err = NewDestinationSets(map[string]interface{}{"acr": map[string]interface{}{}})
+	assert.ErrorContains(t, err, "prefixes should not be empty")
+
+	_, err = NewDestinationSets(map[string]interface{}{"acr": map[string]interface{}{
+		"prefixes": []interface{}{"registry.example.com"},
+		"path":     "{{.name",
+	}})
+	assert.ErrorContains(t, err, "invalid path template")
+
+	sets, err := NewDestinationSets(map[string]interface{}{"acr": map[string]interface{}{
+		"prefixes": []interface{}{"registry.example.com"},
+		"path":     "{{.version}}",
+	}})
+	assert.NoError(t, err)
+	_, err = sets.Destinations(&Rule{Source: "docker.io/library/nginx:1.25"}, []string{"acr"}, nil)
+	assert.ErrorContains(t, err, "failed to render path of destination set acr")
+
+	// the repository of a source under a registry served under a path prefix is the part after the prefix
+	sets, err = NewDestinationSets(map[string]interface{}{"acr": map[string]interface{}{
+		"prefixes": []interface{}{"registry.example.com/mirror"},
+	}})
+	assert.NoError(t, err)
+	rule := &Rule{Source: "artifactory.example.com/artifactory/api/docker/docker-local/team/app:v1"}
+	destinations, err := sets.Destinations(rule, []string{"acr"},
+		utils.NewURLParser([]string{"artifactory.example.com/artifactory/api/docker/docker-local"}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"registry.example.com/mirror/team/app"}, destinations)
+
+	destinations, err = sets.Destinations(rule, []string{"acr"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"registry.example.com/mirror/artifactory/api/docker/docker-local/team/app"},
+		destinations)
+}
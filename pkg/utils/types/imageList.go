@@ -3,55 +3,430 @@ package types
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/AliyunContainerService/image-syncer/pkg/utils"
 )
 
+const (
+	// DigestDriftFail fails the synchronization if the tag of a pinned source has drifted from its digest
+	DigestDriftFail = "fail"
+	// DigestDriftWarn logs a warning and synchronizes the pinned digest under the tag if the tag has drifted
+	DigestDriftWarn = "warn"
+)
+
 type ImageList map[string][]string
 
-func NewImageList(origin map[string]interface{}) (ImageList, error) {
-	result := map[string][]string{}
+// Rule is an image sync rule, which synchronizes images of source to destinations
+type Rule struct {
+	// Name is the key of rule in images file, which is the same as Source unless "source" is provided in the object
+	// form of rule
+	Name string
+
+	Source       string
+	Destinations []string
+
+	// FailoverSources are repositories which have the same images as Source, they are tried in order if Source
+	// fails to list tags or serve manifests and blobs
+	FailoverSources []string
+
+	// Platforms are the "os/arch[/variant]" selectors of images to sync, they take the place of --os and --arch if
+	// not empty
+	Platforms []string
+
+	// Force and Retries take the place of --force and --retries if not nil
+	Force   *bool
+	Retries *int
+
+	// Tags filters the tags listed from source repository
+	Tags TagFilter
+
+	// Metadata filters images by their config, nil if it's not provided
+	Metadata *MetadataFilter
+
+	// TagTemplate renders the destination tags, nil if destination tags are the same as source
+	TagTemplate *TagTemplate
+
+	// RepositoryMapping maps the source repository into each destination (registry[/namespace]), nil if destinations
+	// are repositories
+	RepositoryMapping *RepositoryMapping
+
+	// DigestDrift decides what to do if the tag of a pinned source ("repo:tag@digest") doesn't resolve to the digest
+	// any more, which is DigestDriftFail (default) or DigestDriftWarn
+	DigestDrift string
+
+	// Priority decides the order to start rules, rules with higher priority start earlier
+	Priority int
+
+	// Variables are the values of matrix variables which the rule is rendered with, nil if it's not expanded from a
+	// matrix rule
+	Variables map[string]string
+}
+
+// ruleObject is the object form of a rule, which is used if more than destinations need to be described
+type ruleObject struct {
+	Source       string          `json:"source"`
+	Destinations interface{}     `json:"destinations"`
+	Failover     []string        `json:"failover"`
+	Platforms    []string        `json:"platforms"`
+	Force        *bool           `json:"force"`
+	Retries      *int            `json:"retries"`
+	Tags         TagFilter       `json:"tags"`
+	Metadata     *MetadataFilter `json:"metadata"`
+	TagTemplate  *TagTemplate    `json:"tagTemplate"`
+
+	RepositoryMapping *RepositoryMapping `json:"repositoryMapping"`
+	DigestDrift       string             `json:"digestDrift"`
+	Priority          int                `json:"priority"`
+	Enabled           *bool              `json:"enabled"`
+	Matrix            Matrix             `json:"matrix"`
+	DestinationSets   interface{}        `json:"destinationSets"`
+}
+
+// NewImageList parses the image sync rules of images file, the value of each source can be a destination string,
+// a destination list, or an object with destinations and other settings. Disabled rules are skipped, matrix rules
+// are expanded, destination sets defined by DestinationSetsKey are expanded into destinations, and the rules are
+// sorted by priority (descending), source and name. Urls are parsed by parser, which knows the registries served
+// under a path prefix.
+func NewImageList(origin map[string]interface{}, parser *utils.URLParser) ([]*Rule, error) {
+	var result []*Rule
 
-	for source, dest := range origin {
-		convertErr := fmt.Errorf("invalid destination %v for source \"%v\", "+
-			"destination should only be string or []string", dest, source)
+	sets, err := NewDestinationSets(origin[DestinationSetsKey])
+	if err != nil {
+		return nil, err
+	}
 
-		emptyDestErr := fmt.Errorf("empty destination is not supported for source: %v", source)
+	for name, value := range origin {
+		if name == DestinationSetsKey {
+			continue
+		}
+		rule := &Rule{Name: name, Source: name}
+
+		var matrix Matrix
+		var setNames []string
+		dest := value
+		if object, ok := toJSONValue(value).(map[string]interface{}); ok {
+			ruleObj, err := decodeRuleObject(object)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule for source \"%v\": %v", name, err)
+			}
+
+			if ruleObj.Enabled != nil && !*ruleObj.Enabled {
+				continue
+			}
+
+			if ruleObj.Source != "" {
+				rule.Source = os.ExpandEnv(ruleObj.Source)
+			}
+			source := rule.Source
 
-		if destList, ok := dest.([]interface{}); ok {
-			// check if is destination is a []string
-			for _, d := range destList {
-				destStr, ok := d.(string)
-				if !ok {
-					return nil, convertErr
+			if err = applyRuleOptions(rule, ruleObj); err != nil {
+				return nil, fmt.Errorf("invalid rule for source \"%v\": %v", source, err)
+			}
+
+			for _, failover := range ruleObj.Failover {
+				rule.FailoverSources = append(rule.FailoverSources, os.ExpandEnv(failover))
+			}
+
+			if ruleObj.Matrix != nil {
+				if err = ruleObj.Matrix.Check(); err != nil {
+					return nil, fmt.Errorf("invalid rule for source \"%v\": %v", source, err)
 				}
+				matrix = ruleObj.Matrix
+			}
+
+			if setNames, err = parseDestinationSetNames(ruleObj.DestinationSets); err != nil {
+				return nil, fmt.Errorf("invalid rule for source \"%v\": %v", source, err)
+			}
 
-				if len(destStr) == 0 {
-					return nil, emptyDestErr
+			dest = ruleObj.Destinations
+		}
+
+		// destinations can be omitted if the rule refers to destination sets
+		if dest != nil || len(setNames) == 0 {
+			if rule.Destinations, err = parseDestinations(rule.Source, dest); err != nil {
+				return nil, err
+			}
+		}
+
+		rules := []*Rule{rule}
+		if matrix != nil {
+			if rules, err = expandMatrix(rule, matrix); err != nil {
+				return nil, fmt.Errorf("invalid matrix rule for source \"%v\": %v", rule.Source, err)
+			}
+		}
+
+		for _, r := range rules {
+			if len(setNames) != 0 {
+				destinations, err := sets.Destinations(r, setNames, parser)
+				if err != nil {
+					return nil, fmt.Errorf("invalid rule for source \"%v\": %v", r.Source, err)
 				}
-				result[source] = append(result[source], os.ExpandEnv(destStr))
+				r.Destinations = utils.RemoveDuplicateItems(append(r.Destinations, destinations...))
 			}
 
-			// empty slice is the same with an empty string
-			if len(destList) == 0 {
-				return nil, emptyDestErr
+			if err = checkFailoverSources(r, parser); err != nil {
+				return nil, err
+			}
+
+			if err = checkWildcard(r, parser); err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, rules...)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Priority != result[j].Priority {
+			return result[i].Priority > result[j].Priority
+		}
+		if result[i].Source != result[j].Source {
+			return result[i].Source < result[j].Source
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	if err = checkMappedRepositories(result, parser); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// checkMappedRepositories checks if the repositories mapped from different sources collide.
+func checkMappedRepositories(rules []*Rule, parser *utils.URLParser) error {
+	sources := map[string]string{}
+	for _, rule := range rules {
+		if rule.RepositoryMapping == nil || parser.IsWildcardURL(rule.Source) {
+			// repositories of wildcard sources are checked after they are listed
+			continue
+		}
+
+		registry, repository, err := parser.ParseRepositoryOfURL(rule.Source)
+		if err != nil {
+			return err
+		}
+		source := registry + "/" + repository
+
+		for _, dest := range rule.Destinations {
+			mapped, err := rule.RepositoryMapping.MapDestination(dest, repository)
+			if err != nil {
+				return fmt.Errorf("failed to map repository for source \"%v\": %v", rule.Source, err)
+			}
+
+			if _, _, err = parser.ParseRepository(mapped); err != nil {
+				return fmt.Errorf("invalid destination %v for source \"%v\" with repository mapping: %v",
+					dest, rule.Source, err)
+			}
+
+			if other, exist := sources[mapped]; exist && other != source {
+				return fmt.Errorf("sources %v and %v are both mapped to repository %v", other, source, mapped)
+			}
+			sources[mapped] = source
+		}
+	}
+	return nil
+}
+
+// checkFailoverSources checks if the failover sources of rule are valid repositories, and removes the duplicated ones.
+func checkFailoverSources(rule *Rule, parser *utils.URLParser) error {
+	for _, failover := range rule.FailoverSources {
+		if _, _, err := parser.ParseRepository(failover); err != nil {
+			return fmt.Errorf("invalid failover source for source \"%v\": %v", rule.Source, err)
+		}
+	}
+
+	if len(rule.FailoverSources) != 0 {
+		rule.FailoverSources = utils.RemoveDuplicateItems(rule.FailoverSources)
+	}
+	return nil
+}
+
+// checkWildcard checks if the wildcard source of rule is valid, and destinations can be derived from it with "*"
+// substitution or repository mapping.
+func checkWildcard(rule *Rule, parser *utils.URLParser) error {
+	if !parser.IsWildcardURL(rule.Source) {
+		for _, dest := range rule.Destinations {
+			if strings.Contains(dest, "*") {
+				return fmt.Errorf("destination %v should not have \"*\" because source \"%v\" is not a wildcard",
+					dest, rule.Source)
+			}
+		}
+		return nil
+	}
+
+	if _, err := parser.ParseWildcardURL(rule.Source); err != nil {
+		return err
+	}
+
+	if len(rule.FailoverSources) != 0 {
+		return fmt.Errorf("failover sources are not supported for wildcard source \"%v\"", rule.Source)
+	}
+
+	for _, dest := range rule.Destinations {
+		switch strings.Count(dest, "*") {
+		case 0:
+			if rule.RepositoryMapping == nil {
+				return fmt.Errorf("destination %v of wildcard source \"%v\" should have a \"*\" "+
+					"or repository mapping", dest, rule.Source)
+			}
+		case 1:
+		default:
+			return fmt.Errorf("destination %v of wildcard source \"%v\" should have only one \"*\"",
+				dest, rule.Source)
+		}
+	}
+	return nil
+}
+
+// applyRuleOptions checks the per-rule settings of object form and applies them to rule.
+func applyRuleOptions(rule *Rule, ruleObj *ruleObject) error {
+	for _, platform := range ruleObj.Platforms {
+		if err := CheckPlatform(platform); err != nil {
+			return err
+		}
+	}
+	if len(ruleObj.Platforms) != 0 {
+		rule.Platforms = utils.RemoveDuplicateItems(ruleObj.Platforms)
+	}
+
+	if ruleObj.Retries != nil && *ruleObj.Retries < 0 {
+		return fmt.Errorf("retries should not be negative")
+	}
+	rule.Force = ruleObj.Force
+	rule.Retries = ruleObj.Retries
+
+	if _, err := ruleObj.Tags.compile(); err != nil {
+		return err
+	}
+	rule.Tags = ruleObj.Tags
+
+	if ruleObj.Metadata != nil {
+		if err := ruleObj.Metadata.Check(); err != nil {
+			return err
+		}
+	}
+	rule.Metadata = ruleObj.Metadata
+
+	if ruleObj.TagTemplate != nil {
+		if err := ruleObj.TagTemplate.Check(); err != nil {
+			return err
+		}
+		ruleObj.TagTemplate.Aliases = utils.RemoveDuplicateItems(ruleObj.TagTemplate.Aliases)
+	}
+	rule.TagTemplate = ruleObj.TagTemplate
+
+	if ruleObj.RepositoryMapping != nil {
+		if err := ruleObj.RepositoryMapping.Check(); err != nil {
+			return err
+		}
+	}
+	rule.RepositoryMapping = ruleObj.RepositoryMapping
+
+	switch ruleObj.DigestDrift {
+	case "", DigestDriftFail, DigestDriftWarn:
+	default:
+		return fmt.Errorf("invalid digestDrift %q, should be %v or %v", ruleObj.DigestDrift,
+			DigestDriftFail, DigestDriftWarn)
+	}
+	rule.DigestDrift = ruleObj.DigestDrift
+	rule.Priority = ruleObj.Priority
+
+	return nil
+}
+
+// CheckPlatform checks if platform is in the format of "os/arch[/variant]".
+func CheckPlatform(platform string) error {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid platform %v, which should be os/arch[/variant]", platform)
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("invalid platform %v, which should be os/arch[/variant]", platform)
+		}
+	}
+	return nil
+}
+
+func parseDestinations(source string, dest interface{}) ([]string, error) {
+	var result []string
+
+	convertErr := fmt.Errorf("invalid destination %v for source \"%v\", "+
+		"destination should only be string or []string", dest, source)
+
+	emptyDestErr := fmt.Errorf("empty destination is not supported for source: %v", source)
+
+	if destList, ok := dest.([]interface{}); ok {
+		// check if is destination is a []string
+		for _, d := range destList {
+			destStr, ok := d.(string)
+			if !ok {
+				return nil, convertErr
 			}
 
-			result[source] = utils.RemoveDuplicateItems(result[source])
-		} else if destStr, ok := dest.(string); ok {
-			// check if is destination is a string
 			if len(destStr) == 0 {
 				return nil, emptyDestErr
 			}
-			result[source] = append(result[source], os.ExpandEnv(destStr))
-		} else {
-			return nil, convertErr
+			result = append(result, os.ExpandEnv(destStr))
+		}
+
+		// empty slice is the same with an empty string
+		if len(destList) == 0 {
+			return nil, emptyDestErr
+		}
+
+		result = utils.RemoveDuplicateItems(result)
+	} else if destStr, ok := dest.(string); ok {
+		// check if is destination is a string
+		if len(destStr) == 0 {
+			return nil, emptyDestErr
 		}
+		result = append(result, os.ExpandEnv(destStr))
+	} else {
+		return nil, convertErr
 	}
 
 	return result, nil
 }
 
+// decodeRuleObject decodes the object form of a rule, unknown fields are not allowed.
+func decodeRuleObject(object map[string]interface{}) (*ruleObject, error) {
+	var result ruleObject
+	if err := decodeStrict(object, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// toJSONValue converts the maps decoded by yaml, whose keys are interface{}, into map[string]interface{}.
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range v {
+			result[fmt.Sprint(key)] = toJSONValue(item)
+		}
+		return result
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range v {
+			result[key] = toJSONValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for index, item := range v {
+			result[index] = toJSONValue(item)
+		}
+		return result
+	}
+	return value
+}
+
 func (i ImageList) Query(src, dst string) bool {
 	destList, exist := i[src]
 	if exist {
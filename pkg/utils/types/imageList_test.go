@@ -0,0 +1,210 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestNewImageList(t *testing.T) {
+	var origin map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+quay.io/coreos/kube-rbac-proxy:v1.0: quay.io/ruohe/kube-rbac-proxy
+quay.io/coreos/kube-rbac-proxy:v1.1:
+  - quay.io/ruohe/kube-rbac-proxy1
+  - quay.io/ruohe/kube-rbac-proxy2
+  - quay.io/ruohe/kube-rbac-proxy1
+docker.io/library/nginx:1.25:
+  failover:
+    - mirror.gcr.io/library/nginx
+    - cache.example.com/dockerhub/library/nginx
+  destinations: registry.example.com/library/nginx
+`), &origin))
+
+	rules, err := NewImageList(origin, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Rule{
+		{
+			Name:         "docker.io/library/nginx:1.25",
+			Source:       "docker.io/library/nginx:1.25",
+			Destinations: []string{"registry.example.com/library/nginx"},
+			FailoverSources: []string{
+				"mirror.gcr.io/library/nginx",
+				"cache.example.com/dockerhub/library/nginx",
+			},
+		},
+		{
+			Name:         "quay.io/coreos/kube-rbac-proxy:v1.0",
+			Source:       "quay.io/coreos/kube-rbac-proxy:v1.0",
+			Destinations: []string{"quay.io/ruohe/kube-rbac-proxy"},
+		},
+		{
+			Name:         "quay.io/coreos/kube-rbac-proxy:v1.1",
+			Source:       "quay.io/coreos/kube-rbac-proxy:v1.1",
+			Destinations: []string{"quay.io/ruohe/kube-rbac-proxy1", "quay.io/ruohe/kube-rbac-proxy2"},
+		},
+	}, rules)
+
+	for _, invalid := range []map[string]interface{}{
+		{"nginx": ""},
+		{"nginx": []interface{}{}},
+		{"nginx": 1},
+		{"nginx": map[interface{}]interface{}{"failover": []interface{}{"mirror.gcr.io/library/nginx"}}},
+		{"nginx": map[string]interface{}{"destinations": "a/b", "unknown": true}},
+		{"nginx": map[string]interface{}{"destinations": "a/b", "failover": []interface{}{"mirror.gcr.io/nginx:1.25"}}},
+		{"nginx": map[string]interface{}{"destinations": "a/b", "platforms": []interface{}{"linux"}}},
+		{"nginx": map[string]interface{}{"destinations": "a/b", "platforms": []interface{}{"linux/arm64/v8/x"}}},
+		{"nginx": map[string]interface{}{"destinations": "a/b", "retries": -1}},
+		{"nginx": map[string]interface{}{"destinations": "a/b", "tags": map[string]interface{}{"include": "/(/"}}},
+		{"nginx": map[string]interface{}{"destinations": "a/b", "tags": map[string]interface{}{"other": "v1"}}},
+		{"nginx": map[string]interface{}{"destinations": "a/b", "tags": map[string]interface{}{
+			"semver": map[string]interface{}{"keepPer": "patch"}}}},
+	} {
+		_, err = NewImageList(invalid, nil)
+		assert.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestNewImageListWithRuleOptions(t *testing.T) {
+	var origin map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+nginx-amd64:
+  source: docker.io/library/nginx
+  destinations:
+    - registry.example.com/library/nginx
+  platforms:
+    - linux/amd64
+  force: true
+  retries: 5
+  tags:
+    include: /^1\.2[0-9]\./
+    exclude: "*-alpine"
+  priority: 10
+nginx-all:
+  source: docker.io/library/nginx
+  destinations: registry.example.com/mirror/nginx
+nginx-disabled:
+  source: docker.io/library/nginx
+  destinations: registry.example.com/disabled/nginx
+  enabled: false
+docker.io/library/busybox: registry.example.com/library/busybox
+`), &origin))
+
+	rules, err := NewImageList(origin, nil)
+	assert.NoError(t, err)
+
+	force, retries := true, 5
+	assert.Equal(t, []*Rule{
+		{
+			Name:         "nginx-amd64",
+			Source:       "docker.io/library/nginx",
+			Destinations: []string{"registry.example.com/library/nginx"},
+			Platforms:    []string{"linux/amd64"},
+			Force:        &force,
+			Retries:      &retries,
+			Tags:         TagFilter{Include: Patterns{`/^1\.2[0-9]\./`}, Exclude: Patterns{"*-alpine"}},
+			Priority:     10,
+		},
+		{
+			Name:         "docker.io/library/busybox",
+			Source:       "docker.io/library/busybox",
+			Destinations: []string{"registry.example.com/library/busybox"},
+		},
+		{
+			Name:         "nginx-all",
+			Source:       "docker.io/library/nginx",
+			Destinations: []string{"registry.example.com/mirror/nginx"},
+		},
+	}, rules)
+
+}
+
+func TestNewImageListWithRepositoryMapping(t *testing.T) {
+	var origin map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+quay.io/org/team/app:
+  destinations: registry.example.com/ns
+  repositoryMapping:
+    separator: "-"
+registry.k8s.io/sig/x/y:v1:
+  destinations: registry.example.com/ns
+  repositoryMapping:
+    strip: 1
+    separator: "-"
+`), &origin))
+
+	rules, err := NewImageList(origin, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+	assert.Equal(t, &RepositoryMapping{Separator: "-"}, rules[0].RepositoryMapping)
+
+	// both are mapped to registry.example.com/ns/org-team-app
+	origin["quay.io/org-team/app"] = map[string]interface{}{
+		"destinations":      "registry.example.com/ns",
+		"repositoryMapping": map[string]interface{}{"separator": "-"},
+	}
+	_, err = NewImageList(origin, nil)
+	assert.Error(t, err)
+
+	// the same source with different tags can be mapped to the same repository
+	origin = map[string]interface{}{}
+	for _, source := range []string{"quay.io/org/team/app:v1", "quay.io/org/team/app:v2"} {
+		origin[source] = map[string]interface{}{
+			"destinations":      "registry.example.com/ns",
+			"repositoryMapping": map[string]interface{}{"separator": "-"},
+		}
+	}
+	_, err = NewImageList(origin, nil)
+	assert.NoError(t, err)
+
+	_, err = NewImageList(map[string]interface{}{"quay.io/org/app": map[string]interface{}{
+		"destinations":      "registry.example.com/ns:v1",
+		"repositoryMapping": map[string]interface{}{},
+	}}, nil)
+	assert.Error(t, err)
+}
+
+func TestNewImageListWithWildcard(t *testing.T) {
+	rules, err := NewImageList(map[string]interface{}{
+		"harbor.corp/platform/*": "registry.example.com/mirror/*",
+		"registry.example.com/**:v1": map[string]interface{}{
+			"destinations":      "backup.example.com/ns",
+			"repositoryMapping": map[string]interface{}{"separator": "-"},
+		},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+
+	for source, dest := range map[string]interface{}{
+		"harbor.corp/platform/*":   "registry.example.com/mirror",
+		"harbor.corp/platform/**":  "registry.example.com/*/*",
+		"harbor.corp/platform/app": "registry.example.com/*",
+		"platform/*":               "registry.example.com/*",
+	} {
+		_, err = NewImageList(map[string]interface{}{source: dest}, nil)
+		assert.Error(t, err, source)
+	}
+
+	_, err = NewImageList(map[string]interface{}{"harbor.corp/platform/*": map[string]interface{}{
+		"destinations": "registry.example.com/*",
+		"failover":     "backup.example.com/app",
+	}}, nil)
+	assert.Error(t, err)
+}
+
+func TestNewImageListWithDigestDrift(t *testing.T) {
+	rules, err := NewImageList(map[string]interface{}{"nginx:1.25@sha256:" + strings.Repeat("0", 64): map[string]interface{}{
+		"destinations": "registry.example.com/library/nginx",
+		"digestDrift":  "warn",
+	}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DigestDriftWarn, rules[0].DigestDrift)
+
+	_, err = NewImageList(map[string]interface{}{"nginx:1.25": map[string]interface{}{
+		"destinations": "registry.example.com/library/nginx",
+		"digestDrift":  "ignore",
+	}}, nil)
+	assert.Error(t, err)
+}
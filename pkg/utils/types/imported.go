@@ -0,0 +1,81 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ImportedConfig is the image sync rules and authentication information converted from the config file of another
+// tool, the options which cannot be converted are reported in Warnings.
+type ImportedConfig struct {
+	// Images are the rules in the form of images file
+	Images map[string]interface{}
+	Auth   map[string]Auth
+
+	Warnings []string
+}
+
+func newImportedConfig() *ImportedConfig {
+	return &ImportedConfig{
+		Images: map[string]interface{}{},
+		Auth:   map[string]Auth{},
+	}
+}
+
+// addRule adds a rule which synchronizes source to destination, the rule is named by name, or name with a number
+// suffix if it's taken. The object form is used if the rule has options or its name is not the same as source.
+func (c *ImportedConfig) addRule(name, source, destination string, options map[string]interface{}) {
+	key := name
+	for index := 2; c.Images[key] != nil; index++ {
+		key = fmt.Sprintf("%v (%v)", name, index)
+	}
+
+	if key == source && len(options) == 0 {
+		c.Images[key] = destination
+		return
+	}
+
+	object := map[string]interface{}{"destinations": destination}
+	if key != source {
+		object["source"] = source
+	}
+	for option, value := range options {
+		object[option] = value
+	}
+	c.Images[key] = object
+}
+
+func (c *ImportedConfig) warnf(format string, args ...interface{}) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf(format, args...))
+}
+
+// decodeStrict decodes a value decoded from yaml or json into target, unknown fields are not allowed.
+func decodeStrict(value interface{}, target interface{}) error {
+	content, err := json.Marshal(toJSONValue(value))
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
+
+// unknownKeys returns the keys of object which are not known in order.
+func unknownKeys(object map[string]interface{}, known ...string) []string {
+	knownKeys := map[string]bool{}
+	for _, key := range known {
+		knownKeys[key] = true
+	}
+
+	var result []string
+	for key := range object {
+		if !knownKeys[key] {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
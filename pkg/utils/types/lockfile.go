@@ -0,0 +1,133 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+)
+
+// LockfileVersion is the version of lockfile format
+const LockfileVersion = 1
+
+// Lockfile records the manifest digests which source image urls resolve to, so that the same snapshot can be
+// synchronized later even if tags have moved.
+type Lockfile struct {
+	Version int `json:"version" yaml:"version"`
+
+	// Images is keyed by source image urls like "docker.io/library/nginx:1.25"
+	Images map[string]LockedImage `json:"images" yaml:"images"`
+}
+
+// LockedImage is the manifest digest of a source image url
+type LockedImage struct {
+	Digest string `json:"digest" yaml:"digest"`
+
+	// FilteredDigests are the digests of manifests pushed to destinations after platform and metadata filters, keyed
+	// by destination image urls. Destinations are omitted if the manifests pushed are the same as source.
+	FilteredDigests map[string]string `json:"filteredDigests,omitempty" yaml:"filteredDigests,omitempty"`
+}
+
+// NewLockfile creates an empty lockfile of current version.
+func NewLockfile() *Lockfile {
+	return &Lockfile{
+		Version: LockfileVersion,
+		Images:  map[string]LockedImage{},
+	}
+}
+
+// LockKey returns the key of a source image url in lockfile.
+func LockKey(registry, repository, tagOrDigest string) string {
+	return registry + "/" + repository + utils.AttachConnectorToTagOrDigest(tagOrDigest)
+}
+
+// Check validates the version and digests of lockfile.
+func (l *Lockfile) Check() error {
+	if l.Version != LockfileVersion {
+		return fmt.Errorf("unsupported lockfile version %v, only %v is supported", l.Version, LockfileVersion)
+	}
+
+	for source, image := range l.Images {
+		if err := digest.Digest(image.Digest).Validate(); err != nil {
+			return fmt.Errorf("invalid digest of %v: %v", source, err)
+		}
+		for destination, filteredDigest := range image.FilteredDigests {
+			if err := digest.Digest(filteredDigest).Validate(); err != nil {
+				return fmt.Errorf("invalid filtered digest of %v for %v: %v", source, destination, err)
+			}
+		}
+	}
+
+	if l.Images == nil {
+		l.Images = map[string]LockedImage{}
+	}
+	return nil
+}
+
+// Add records the manifest digest of source, and the digest of manifest pushed to destination if it's different.
+func (l *Lockfile) Add(source, destination string, manifestDigest, filteredDigest digest.Digest) {
+	image := l.Images[source]
+	image.Digest = manifestDigest.String()
+
+	if filteredDigest != manifestDigest {
+		if image.FilteredDigests == nil {
+			image.FilteredDigests = map[string]string{}
+		}
+		image.FilteredDigests[destination] = filteredDigest.String()
+	}
+
+	l.Images[source] = image
+}
+
+// Tags returns the sorted tags of registry/repository in lockfile.
+func (l *Lockfile) Tags(registry, repository string) []string {
+	var result []string
+
+	prefix := registry + "/" + repository + ":"
+	for source := range l.Images {
+		if tag, found := strings.CutPrefix(source, prefix); found && !strings.ContainsAny(tag, "/@") {
+			result = append(result, tag)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// Repositories returns the sorted repositories of registry in lockfile which are in namespace (or its
+// sub-namespaces), all the repositories of registry are returned if namespace is empty.
+func (l *Lockfile) Repositories(registry, namespace string) []string {
+	var result []string
+
+	prefix := registry + "/"
+	for source := range l.Images {
+		rest, found := strings.CutPrefix(source, prefix)
+		if !found {
+			continue
+		}
+
+		// repositories have no ":" or "@", which start tag and digest
+		repository := rest
+		if index := strings.IndexAny(rest, ":@"); index != -1 {
+			repository = rest[:index]
+		}
+		if namespace == "" || strings.HasPrefix(repository, namespace+"/") {
+			result = append(result, repository)
+		}
+	}
+
+	result = utils.RemoveDuplicateItems(result)
+	sort.Strings(result)
+	return result
+}
+
+// FilteredDigest returns the digest of manifest which should be pushed to destination.
+func (i LockedImage) FilteredDigest(destination string) string {
+	if filteredDigest, exist := i.FilteredDigests[destination]; exist {
+		return filteredDigest
+	}
+	return i.Digest
+}
@@ -0,0 +1,58 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestLockfile(t *testing.T) {
+	index := digest.FromString("index")
+	filtered := digest.FromString("filtered")
+
+	lockfile := NewLockfile()
+	lockfile.Add(LockKey("docker.io", "library/nginx", "1.25"), "registry.example.com/library/nginx:1.25",
+		index, index)
+	lockfile.Add(LockKey("docker.io", "library/nginx", "1.19"), "registry.example.com/library/nginx:1.19",
+		index, filtered)
+	lockfile.Add(LockKey("docker.io", "library/nginx", index.String()), "registry.example.com/library/nginx",
+		index, index)
+	lockfile.Add(LockKey("docker.io", "library/nginx/sub", "1.25"), "registry.example.com/library/sub:1.25",
+		index, index)
+
+	assert.Equal(t, []string{"1.19", "1.25"}, lockfile.Tags("docker.io", "library/nginx"))
+	assert.Empty(t, lockfile.Tags("docker.io", "library/redis"))
+
+	lockfile.Add(LockKey("docker.io", "libraryx/redis", "7"), "registry.example.com/libraryx/redis:7", index, index)
+	lockfile.Add(LockKey("quay.io", "library/nginx", "1.25"), "registry.example.com/quay/nginx:1.25", index, index)
+	assert.Equal(t, []string{"library/nginx", "library/nginx/sub"}, lockfile.Repositories("docker.io", "library"))
+	assert.Equal(t, []string{"library/nginx", "library/nginx/sub", "libraryx/redis"},
+		lockfile.Repositories("docker.io", ""))
+	assert.Empty(t, lockfile.Repositories("docker.io", "library/redis"))
+
+	image := lockfile.Images["docker.io/library/nginx:1.19"]
+	assert.Equal(t, index.String(), image.Digest)
+	assert.Equal(t, filtered.String(), image.FilteredDigest("registry.example.com/library/nginx:1.19"))
+	assert.Equal(t, index.String(), image.FilteredDigest("registry.example.com/other/nginx:1.19"))
+	assert.Nil(t, lockfile.Images["docker.io/library/nginx:1.25"].FilteredDigests)
+
+	content, err := yaml.Marshal(lockfile)
+	assert.NoError(t, err)
+
+	decoded := &Lockfile{}
+	assert.NoError(t, yaml.Unmarshal(content, decoded))
+	assert.NoError(t, decoded.Check())
+	assert.Equal(t, lockfile, decoded)
+
+	assert.ErrorContains(t, (&Lockfile{Version: 2}).Check(), "unsupported lockfile version")
+	assert.ErrorContains(t, (&Lockfile{Version: LockfileVersion, Images: map[string]LockedImage{
+		"docker.io/library/nginx:1.25": {Digest: "sha256:invalid"},
+	}}).Check(), "invalid digest of docker.io/library/nginx:1.25")
+	assert.ErrorContains(t, (&Lockfile{Version: LockfileVersion, Images: map[string]LockedImage{
+		"docker.io/library/nginx:1.25": {Digest: index.String(), FilteredDigests: map[string]string{
+			"registry.example.com/library/nginx:1.25": "invalid",
+		}},
+	}}).Check(), "invalid filtered digest")
+}
@@ -0,0 +1,145 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+)
+
+// maxMatrixCombinations limits the number of rules expanded from a matrix rule
+const maxMatrixCombinations = 10000
+
+var matrixVariableRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Matrix is the variables of a matrix rule, each of which has a list of values. A matrix rule is expanded into the
+// cartesian product of values, and its source, destinations and failover sources are rendered as templates like
+// "docker.io/library/python:{{.version}}-{{.variant}}" for each combination.
+type Matrix map[string][]interface{}
+
+// Check checks if the variables of matrix are valid, values should be strings so that versions like "3.10" are
+// not parsed as numbers.
+func (m Matrix) Check() error {
+	if len(m) == 0 {
+		return fmt.Errorf("matrix should have at least one variable")
+	}
+
+	combinations := 1
+	for name, values := range m {
+		if !matrixVariableRegex.MatchString(name) {
+			return fmt.Errorf("invalid matrix variable name %q", name)
+		}
+
+		if len(values) == 0 {
+			return fmt.Errorf("matrix variable %v should have at least one value", name)
+		}
+
+		for _, value := range values {
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("value %v of matrix variable %v should be a string, numbers should be quoted "+
+					"like \"3.10\"", value, name)
+			}
+		}
+
+		if combinations *= len(values); combinations > maxMatrixCombinations {
+			return fmt.Errorf("matrix has more than %v combinations", maxMatrixCombinations)
+		}
+	}
+	return nil
+}
+
+// Combinations returns the cartesian product of the values of variables. Variables are sorted by name, and the
+// values of the last one change fastest.
+func (m Matrix) Combinations() []map[string]string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := []map[string]string{{}}
+	for _, name := range names {
+		var next []map[string]string
+		for _, combination := range result {
+			for _, value := range m[name] {
+				item := map[string]string{name: fmt.Sprint(value)}
+				for key, v := range combination {
+					item[key] = v
+				}
+				next = append(next, item)
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// FormatVariables returns variables in the form of "name=value, ..." sorted by name.
+func FormatVariables(variables map[string]string) string {
+	var items []string
+	for name, value := range variables {
+		items = append(items, name+"="+value)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ", ")
+}
+
+// renderTemplate renders text with variables, e.g., the variables of a matrix combination, undefined variables are
+// not allowed.
+func renderTemplate(text string, variables map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("rule").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %q: %v", text, err)
+	}
+
+	var result bytes.Buffer
+	if err = tmpl.Execute(&result, variables); err != nil {
+		return "", fmt.Errorf("failed to render %q: %v", text, err)
+	}
+	return result.String(), nil
+}
+
+// expandMatrix expands a matrix rule into a rule for each combination of variables.
+func expandMatrix(rule *Rule, matrix Matrix) ([]*Rule, error) {
+	var result []*Rule
+	for _, variables := range matrix.Combinations() {
+		expanded := *rule
+		expanded.Name = fmt.Sprintf("%v (%v)", rule.Name, FormatVariables(variables))
+		expanded.Variables = variables
+
+		var err error
+		if expanded.Source, err = renderTemplate(rule.Source, variables); err != nil {
+			return nil, err
+		}
+
+		expanded.Destinations = nil
+		for _, dest := range rule.Destinations {
+			rendered, err := renderTemplate(dest, variables)
+			if err != nil {
+				return nil, err
+			}
+			expanded.Destinations = append(expanded.Destinations, rendered)
+		}
+		expanded.Destinations = utils.RemoveDuplicateItems(expanded.Destinations)
+
+		expanded.FailoverSources = nil
+		for _, failover := range rule.FailoverSources {
+			rendered, err := renderTemplate(failover, variables)
+			if err != nil {
+				return nil, err
+			}
+			expanded.FailoverSources = append(expanded.FailoverSources, rendered)
+		}
+
+		result = append(result, &expanded)
+	}
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+	matrix := Matrix{
+		"version": {"3.11", "3.12"},
+		"variant": {"slim", "alpine"},
+	}
+	assert.NoError(t, matrix.Check())
+
+	assert.Equal(t, []map[string]string{
+		{"variant": "slim", "version": "3.11"},
+		{"variant": "slim", "version": "3.12"},
+		{"variant": "alpine", "version": "3.11"},
+		{"variant": "alpine", "version": "3.12"},
+	}, matrix.Combinations())
+
+	assert.Equal(t, "variant=slim, version=3.11", FormatVariables(map[string]string{
+		"version": "3.11",
+		"variant": "slim",
+	}))
+
+	assert.ErrorContains(t, Matrix{}.Check(), "at least one variable")
+	assert.ErrorContains(t, Matrix{"version": {}}.Check(), "at least one value")
+	assert.ErrorContains(t, Matrix{"os-version": {"1"}}.Check(), "invalid matrix variable name")
+	assert.ErrorContains(t, Matrix{"version": {3.1}}.Check(), "should be a string")
+
+	var values []interface{}
+	for i := 0; i < 101; i++ {
+		values = append(values, "v")
+	}
+	assert.ErrorContains(t, Matrix{"a": values, "b": values}.Check(), "more than 10000 combinations")
+}
+
+func TestMatrixRule(t *testing.T) {
+	var origin map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+"docker.io/library/python:{{.version}}-{{.variant}}":
+  matrix:
+    version: ["3.11", "3.12"]
+    variant: [slim]
+  destinations:
+    - registry-cn-hangzhou.example.com/library/python
+    - registry.example.com/python-{{.variant}}
+  failover: ["quay.io/python-{{.version}}/python"]
+docker.io/library/redis:7: registry.example.com/redis
+`), &origin))
+
+	rules, err := NewImageList(origin, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 3)
+
+	assert.Equal(t, "docker.io/library/python:{{.version}}-{{.variant}} (variant=slim, version=3.11)", rules[0].Name)
+	assert.Equal(t, "docker.io/library/python:3.11-slim", rules[0].Source)
+	assert.Equal(t, map[string]string{"variant": "slim", "version": "3.11"}, rules[0].Variables)
+	assert.Equal(t, []string{
+		"registry-cn-hangzhou.example.com/library/python",
+		"registry.example.com/python-slim",
+	}, rules[0].Destinations)
+	assert.Equal(t, []string{"quay.io/python-3.11/python"}, rules[0].FailoverSources)
+
+	assert.Equal(t, "docker.io/library/python:3.12-slim", rules[1].Source)
+	assert.Equal(t, "docker.io/library/redis:7", rules[2].Source)
+	assert.Nil(t, rules[2].Variables)
+
+	// undefined variables are not allowed
+	_, err = NewImageList(map[string]interface{}{
+		"docker.io/library/python:{{.version}}": map[string]interface{}{
+			"matrix":       map[string]interface{}{"variant": []interface{}{"slim"}},
+			"destinations": "registry.example.com/python",
+		},
+	}, nil)
+	assert.ErrorContains(t, err, "invalid matrix rule")
+}
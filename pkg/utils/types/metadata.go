@@ -0,0 +1,162 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+// MetadataFilter selects images by the metadata in their config blobs, only images which pass all the conditions
+// are synced, and empty conditions take no effect.
+type MetadataFilter struct {
+	// Labels must exist in image config with the same values, a label with empty value only needs to exist
+	Labels map[string]string `json:"labels"`
+
+	// MaxAge is the max duration since image was created, e.g., "90d", "36h"
+	MaxAge string `json:"maxAge"`
+	// CreatedAfter and CreatedBefore are RFC 3339 times or dates, e.g., "2024-01-02T15:04:05Z", "2024-01-02"
+	CreatedAfter  string `json:"createdAfter"`
+	CreatedBefore string `json:"createdBefore"`
+
+	// MinSize and MaxSize limit the total (compressed) size of layers, e.g., "500MB", "2GB"
+	MinSize string `json:"minSize"`
+	MaxSize string `json:"maxSize"`
+}
+
+// Check checks if the settings of filter are valid.
+func (m *MetadataFilter) Check() error {
+	if m.MaxAge != "" {
+		if _, err := parseAge(m.MaxAge); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range []string{m.CreatedAfter, m.CreatedBefore} {
+		if t != "" {
+			if _, err := parseTime(t); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, size := range []string{m.MinSize, m.MaxSize} {
+		if size != "" {
+			if _, err := units.FromHumanSize(size); err != nil {
+				return fmt.Errorf("invalid size %v: %v", size, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Match returns the reason why an image is filtered, or an empty string if the image passes the filter. created is
+// the creation time in image config and nil if it's missing, size is the total size of layers.
+func (m *MetadataFilter) Match(labels map[string]string, created *time.Time, size int64, now time.Time) (
+	string, error) {
+	if err := m.Check(); err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(m.Labels))
+	for key := range m.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, exist := labels[key]
+		if !exist {
+			return fmt.Sprintf("label %v is missing", key), nil
+		}
+		if m.Labels[key] != "" && value != m.Labels[key] {
+			return fmt.Sprintf("label %v is %q rather than %q", key, value, m.Labels[key]), nil
+		}
+	}
+
+	if m.MaxAge != "" || m.CreatedAfter != "" || m.CreatedBefore != "" {
+		if created == nil {
+			return "creation time is missing", nil
+		}
+
+		if m.MaxAge != "" {
+			maxAge, _ := parseAge(m.MaxAge)
+			if age := now.Sub(*created); age > maxAge {
+				return fmt.Sprintf("created at %v, which is older than %v", created.Format(time.RFC3339), m.MaxAge), nil
+			}
+		}
+
+		if m.CreatedAfter != "" {
+			after, _ := parseTime(m.CreatedAfter)
+			if created.Before(after) {
+				return fmt.Sprintf("created at %v, which is before %v", created.Format(time.RFC3339),
+					m.CreatedAfter), nil
+			}
+		}
+
+		if m.CreatedBefore != "" {
+			before, _ := parseTime(m.CreatedBefore)
+			if !created.Before(before) {
+				return fmt.Sprintf("created at %v, which is not before %v", created.Format(time.RFC3339),
+					m.CreatedBefore), nil
+			}
+		}
+	}
+
+	if m.MinSize != "" {
+		minSize, _ := units.FromHumanSize(m.MinSize)
+		if size < minSize {
+			return fmt.Sprintf("size %v is less than %v", units.HumanSize(float64(size)), m.MinSize), nil
+		}
+	}
+
+	if m.MaxSize != "" {
+		maxSize, _ := units.FromHumanSize(m.MaxSize)
+		if size > maxSize {
+			return fmt.Sprintf("size %v is larger than %v", units.HumanSize(float64(size)), m.MaxSize), nil
+		}
+	}
+
+	return "", nil
+}
+
+// parseAge parses a duration which supports days, e.g., "90d", "1d12h".
+func parseAge(age string) (time.Duration, error) {
+	var days time.Duration
+	rest := age
+	if index := strings.Index(age, "d"); index != -1 {
+		n, err := strconv.Atoi(age[:index])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %v", age)
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		rest = age[index+1:]
+	}
+
+	if rest == "" {
+		return days, nil
+	}
+
+	duration, err := time.ParseDuration(rest)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid age %v", age)
+	}
+	return days + duration, nil
+}
+
+// parseTime parses a RFC 3339 time or a date.
+func parseTime(t string) (time.Time, error) {
+	if result, err := time.Parse(time.RFC3339, t); err == nil {
+		return result, nil
+	}
+
+	result, err := time.Parse("2006-01-02", t)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %v, which should be RFC 3339 time or date", t)
+	}
+	return result, nil
+}
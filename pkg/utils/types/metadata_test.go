@@ -0,0 +1,60 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataFilter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	created := now.Add(-30 * 24 * time.Hour)
+	labels := map[string]string{"org.opencontainers.image.vendor": "OurCorp", "maintainer": "ops"}
+
+	filter := &MetadataFilter{
+		Labels:       map[string]string{"org.opencontainers.image.vendor": "OurCorp", "maintainer": ""},
+		MaxAge:       "90d",
+		CreatedAfter: "2024-01-01",
+		MaxSize:      "2GB",
+		MinSize:      "1KB",
+	}
+
+	reason, err := filter.Match(labels, &created, 1e9, now)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	old := now.Add(-100 * 24 * time.Hour)
+	for _, c := range []struct {
+		labels  map[string]string
+		created *time.Time
+		size    int64
+	}{
+		{labels: map[string]string{"maintainer": "ops"}, created: &created, size: 1e9},
+		{labels: map[string]string{"org.opencontainers.image.vendor": "Other"}, created: &created, size: 1e9},
+		{labels: labels, created: &old, size: 1e9},
+		{labels: labels, created: nil, size: 1e9},
+		{labels: labels, created: &created, size: 3e9},
+		{labels: labels, created: &created, size: 100},
+	} {
+		reason, err = filter.Match(c.labels, c.created, c.size, now)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, reason, "%+v", c)
+	}
+
+	reason, err = (&MetadataFilter{CreatedBefore: "2024-05-01T00:00:00Z"}).Match(nil, &created, 0, now)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, reason)
+
+	for _, age := range []string{"90d", "36h", "1d12h", "0d"} {
+		assert.NoError(t, (&MetadataFilter{MaxAge: age}).Check(), age)
+	}
+	for _, invalid := range []MetadataFilter{
+		{MaxAge: "90"},
+		{MaxAge: "-1d"},
+		{CreatedAfter: "yesterday"},
+		{MaxSize: "2XB"},
+	} {
+		assert.Error(t, invalid.Check(), "%+v", invalid)
+	}
+}
@@ -0,0 +1,258 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+	"github.com/AliyunContainerService/image-syncer/pkg/utils/secret"
+)
+
+const (
+	regsyncTypeImage      = "image"
+	regsyncTypeRepository = "repository"
+	regsyncTypeRegistry   = "registry"
+)
+
+var (
+	// regsyncEnvTemplate and regsyncFileTemplate are the templates of regsync credentials which can be converted into
+	// environment variables and secret files
+	regsyncEnvTemplate  = regexp.MustCompile(`^\{\{\s*env\s+"([^"]+)"\s*\}\}$`)
+	regsyncFileTemplate = regexp.MustCompile(`^\{\{\s*file\s+"([^"]+)"\s*\}\}$`)
+)
+
+// regsyncCred is the credential of a registry in the config file of regsync
+type regsyncCred struct {
+	Registry string `json:"registry"`
+	User     string `json:"user"`
+	Pass     string `json:"pass"`
+	// TLS is "enabled" (default), "insecure" or "disabled"
+	TLS string `json:"tls"`
+}
+
+// regsyncAllowDeny is the filter of tags or repositories in the config file of regsync, each item is a regular
+// expression which matches the whole tag or repository
+type regsyncAllowDeny struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// regsyncSync is an entry of "sync" section in the config file of regsync
+type regsyncSync struct {
+	Source    string            `json:"source"`
+	Target    string            `json:"target"`
+	Type      string            `json:"type"`
+	Tags      *regsyncAllowDeny `json:"tags"`
+	Repos     *regsyncAllowDeny `json:"repos"`
+	Platform  string            `json:"platform"`
+	Platforms []string          `json:"platforms"`
+}
+
+// ImportRegsync converts the config file of regsync into image sync rules and authentication information. Options
+// for scheduling, rate limit and backup are ignored with warnings, and the entries which cannot be converted are
+// skipped with warnings.
+func ImportRegsync(tree map[string]interface{}) (*ImportedConfig, error) {
+	result := newImportedConfig()
+
+	for _, key := range unknownKeys(tree, "version", "creds", "defaults", "sync") {
+		// "x-" keys are used to define yaml anchors
+		if !strings.HasPrefix(key, "x-") {
+			result.warnf("%v of regsync config is ignored", key)
+		}
+	}
+
+	if version, exist := tree["version"]; exist && fmt.Sprint(version) != "1" {
+		return nil, fmt.Errorf("unsupported version %v of regsync config", version)
+	}
+
+	creds, _ := toJSONValue(tree["creds"]).([]interface{})
+	if tree["creds"] != nil && creds == nil {
+		return nil, fmt.Errorf("creds of regsync config should be a list")
+	}
+	for index, item := range creds {
+		if err := result.importRegsyncCred(index, item); err != nil {
+			return nil, err
+		}
+	}
+
+	var defaults regsyncSync
+	if object, ok := toJSONValue(tree["defaults"]).(map[string]interface{}); ok {
+		for _, key := range unknownKeys(object, "platform", "platforms") {
+			result.warnf("defaults.%v of regsync config is ignored", key)
+		}
+		if err := decodeStrict(map[string]interface{}{
+			"platform":  object["platform"],
+			"platforms": object["platforms"],
+		}, &defaults); err != nil {
+			return nil, fmt.Errorf("invalid defaults of regsync config: %v", err)
+		}
+	} else if tree["defaults"] != nil {
+		return nil, fmt.Errorf("defaults of regsync config should be an object")
+	}
+
+	entries, _ := toJSONValue(tree["sync"]).([]interface{})
+	if tree["sync"] != nil && entries == nil {
+		return nil, fmt.Errorf("sync of regsync config should be a list")
+	}
+	for index, item := range entries {
+		if err := result.importRegsyncSync(index, item, defaults); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// importRegsyncCred converts a credential of regsync into authentication information.
+func (c *ImportedConfig) importRegsyncCred(index int, item interface{}) error {
+	object, ok := item.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("creds[%v] of regsync config should be an object", index)
+	}
+
+	var cred regsyncCred
+	for _, key := range unknownKeys(object, "registry", "user", "pass", "tls") {
+		c.warnf("%v of creds[%v] of regsync config is ignored", key, index)
+		delete(object, key)
+	}
+	if err := decodeStrict(object, &cred); err != nil {
+		return fmt.Errorf("invalid creds[%v] of regsync config: %v", index, err)
+	}
+	if cred.Registry == "" {
+		return fmt.Errorf("registry of creds[%v] of regsync config should not be empty", index)
+	}
+
+	auth := Auth{}
+	for _, field := range []struct {
+		name   string
+		value  string
+		target *string
+	}{
+		{"user", cred.User, &auth.Username},
+		{"pass", cred.Pass, &auth.Password},
+	} {
+		value, err := convertRegsyncTemplate(field.value)
+		if err != nil {
+			c.warnf("creds of registry %v are skipped, %v of %v", cred.Registry, err, field.name)
+			return nil
+		}
+		*field.target = value
+	}
+
+	switch cred.TLS {
+	case "", "enabled":
+	case "insecure":
+		auth.Insecure = true
+	case "disabled":
+		auth.PlainHTTP = true
+	default:
+		return fmt.Errorf("invalid tls %q of creds[%v] of regsync config", cred.TLS, index)
+	}
+
+	c.Auth[cred.Registry] = auth
+	return nil
+}
+
+// convertRegsyncTemplate converts the env and file templates of regsync credentials into environment variable and
+// secret file references, e.g., `{{env "TOKEN"}}` into "${TOKEN}".
+func convertRegsyncTemplate(value string) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+
+	if match := regsyncEnvTemplate.FindStringSubmatch(value); match != nil {
+		return "${" + match[1] + "}", nil
+	}
+	if match := regsyncFileTemplate.FindStringSubmatch(value); match != nil {
+		return secret.FilePrefix + match[1], nil
+	}
+	return "", fmt.Errorf("unsupported template %q", value)
+}
+
+// importRegsyncSync converts an entry of "sync" section of regsync into a rule, platforms of defaults are used if the
+// entry has none.
+func (c *ImportedConfig) importRegsyncSync(index int, item interface{}, defaults regsyncSync) error {
+	object, ok := item.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("sync[%v] of regsync config should be an object", index)
+	}
+
+	var entry regsyncSync
+	for _, key := range unknownKeys(object, "source", "target", "type", "tags", "repos", "platform", "platforms") {
+		c.warnf("%v of sync[%v] of regsync config is ignored", key, index)
+		delete(object, key)
+	}
+	if err := decodeStrict(object, &entry); err != nil {
+		return fmt.Errorf("invalid sync[%v] of regsync config: %v", index, err)
+	}
+	if entry.Source == "" || entry.Target == "" {
+		return fmt.Errorf("source and target of sync[%v] of regsync config should not be empty", index)
+	}
+	if strings.Contains(entry.Source+entry.Target, "{{") {
+		c.warnf("sync[%v] of regsync config is skipped, templates in source and target are not supported", index)
+		return nil
+	}
+
+	options := map[string]interface{}{}
+
+	platforms := entry.Platforms
+	if entry.Platform != "" {
+		platforms = append(platforms, entry.Platform)
+	}
+	if len(platforms) == 0 {
+		platforms = defaults.Platforms
+		if defaults.Platform != "" {
+			platforms = append(platforms, defaults.Platform)
+		}
+	}
+	if len(platforms) != 0 {
+		options["platforms"] = utils.RemoveDuplicateItems(platforms)
+	}
+
+	source, target := entry.Source, entry.Target
+	switch entry.Type {
+	case regsyncTypeImage:
+		if entry.Tags != nil {
+			c.warnf("tags of sync[%v] of regsync config is ignored for type image", index)
+		}
+	case regsyncTypeRepository, regsyncTypeRegistry:
+		if entry.Tags != nil {
+			filter := map[string]interface{}{}
+			if len(entry.Tags.Allow) != 0 {
+				filter["include"] = regsyncPatterns(entry.Tags.Allow)
+			}
+			if len(entry.Tags.Deny) != 0 {
+				filter["exclude"] = regsyncPatterns(entry.Tags.Deny)
+			}
+			options["tags"] = filter
+		}
+
+		if entry.Type == regsyncTypeRegistry {
+			if entry.Repos != nil {
+				c.warnf("sync[%v] of regsync config is skipped, repos filters are not supported", index)
+				return nil
+			}
+			// all the repositories of registry are synchronized with the same paths
+			source, target = strings.TrimSuffix(source, "/")+"/**", strings.TrimSuffix(target, "/")+"/*"
+		}
+	default:
+		return fmt.Errorf("invalid type %q of sync[%v] of regsync config, should be %v, %v or %v", entry.Type,
+			index, regsyncTypeImage, regsyncTypeRepository, regsyncTypeRegistry)
+	}
+	if entry.Repos != nil && entry.Type != regsyncTypeRegistry {
+		c.warnf("repos of sync[%v] of regsync config is ignored for type %v", index, entry.Type)
+	}
+
+	c.addRule(source, source, target, options)
+	return nil
+}
+
+// regsyncPatterns converts the regular expressions of regsync, which match whole tags, into tag patterns.
+func regsyncPatterns(expressions []string) []string {
+	var result []string
+	for _, expression := range expressions {
+		result = append(result, "/^(?:"+expression+")$/")
+	}
+	return result
+}
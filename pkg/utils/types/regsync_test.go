@@ -0,0 +1,101 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestImportRegsync(t *testing.T) {
+	var tree map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+version: 1
+x-sync-hub: &sync-hub
+  interval: 60m
+creds:
+  - registry: registry:5000
+    tls: disabled
+  - registry: docker.io
+    user: '{{env "HUB_USER"}}'
+    pass: '{{ file "/run/secrets/hub_token" }}'
+    reqPerSec: 1
+  - registry: quay.io
+    user: '{{.Name}}'
+defaults:
+  parallel: 2
+  platform: linux/amd64
+sync:
+  - source: busybox:latest
+    target: registry:5000/library/busybox:latest
+    type: image
+  - source: alpine
+    target: registry:5000/library/alpine
+    type: repository
+    tags:
+      allow: ["3", "3\\.\\d+"]
+      deny: ["3.0"]
+    backup: "bkup-{{.Ref.Tag}}"
+  - source: alpine
+    target: registry:5000/mirror/alpine
+    type: repository
+  - source: registry.example.com
+    target: registry:5000/mirror
+    type: registry
+    platforms: [linux/arm64]
+  - source: registry.example.com
+    target: registry:5000/team
+    type: registry
+    repos:
+      allow: ["team/.*"]
+`), &tree))
+
+	result, err := ImportRegsync(tree)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"busybox:latest": map[string]interface{}{
+			"destinations": "registry:5000/library/busybox:latest",
+			"platforms":    []string{"linux/amd64"},
+		},
+		"alpine": map[string]interface{}{
+			"destinations": "registry:5000/library/alpine",
+			"platforms":    []string{"linux/amd64"},
+			"tags": map[string]interface{}{
+				"include": []string{"/^(?:3)$/", `/^(?:3\.\d+)$/`},
+				"exclude": []string{"/^(?:3.0)$/"},
+			},
+		},
+		// the same source is synchronized by another rule
+		"alpine (2)": map[string]interface{}{
+			"source":       "alpine",
+			"destinations": "registry:5000/mirror/alpine",
+			"platforms":    []string{"linux/amd64"},
+		},
+		"registry.example.com/**": map[string]interface{}{
+			"destinations": "registry:5000/mirror/*",
+			"platforms":    []string{"linux/arm64"},
+		},
+	}, result.Images)
+	assert.Equal(t, map[string]Auth{
+		"registry:5000": {PlainHTTP: true},
+		"docker.io":     {Username: "${HUB_USER}", Password: "file:///run/secrets/hub_token"},
+	}, result.Auth)
+	assert.Equal(t, []string{
+		"reqPerSec of creds[1] of regsync config is ignored",
+		`creds of registry quay.io are skipped, unsupported template "{{.Name}}" of user`,
+		"defaults.parallel of regsync config is ignored",
+		"backup of sync[1] of regsync config is ignored",
+		"sync[4] of regsync config is skipped, repos filters are not supported",
+	}, result.Warnings)
+
+	_, err = NewImageList(result.Images, nil)
+	assert.NoError(t, err)
+
+	_, err = ImportRegsync(map[string]interface{}{"version": 2})
+	assert.ErrorContains(t, err, "unsupported version 2 of regsync config")
+
+	_, err = ImportRegsync(map[string]interface{}{"sync": []interface{}{
+		map[string]interface{}{"source": "alpine", "target": "registry:5000/alpine", "type": "unknown"},
+	}})
+	assert.ErrorContains(t, err, `invalid type "unknown" of sync[0]`)
+}
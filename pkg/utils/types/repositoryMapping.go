@@ -0,0 +1,88 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+)
+
+// RepositoryMapping rewrites the source repository path into the destination repository path, which is appended to
+// the destination url (registry[/namespace]). The steps are applied in order: strip the leading components, replace
+// with regular expressions, join the components with separator, and convert to lowercase.
+type RepositoryMapping struct {
+	// Strip is the number of leading components to remove, at least one component is left
+	Strip int `json:"strip"`
+
+	// Replace is applied to the "/" separated path after strip in order
+	Replace []RepositoryReplace `json:"replace"`
+
+	// Separator joins the path components, the default value is "/", e.g., "-" flattens "org/team/app" to
+	// "org-team-app"
+	Separator string `json:"separator"`
+
+	Lowercase bool `json:"lowercase"`
+}
+
+// RepositoryReplace replaces the matches of regular expression Match with Replace, which can refer to capture
+// groups like "$1"
+type RepositoryReplace struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// Check checks if the settings of mapping are valid.
+func (m *RepositoryMapping) Check() error {
+	if m.Strip < 0 {
+		return fmt.Errorf("strip of repository mapping should not be negative")
+	}
+
+	for _, r := range m.Replace {
+		if _, err := regexp.Compile(r.Match); err != nil {
+			return fmt.Errorf("invalid repository replace regex \"%v\": %v", r.Match, err)
+		}
+	}
+	return nil
+}
+
+// Map returns the destination repository path of source repository path, e.g., "org/team/app".
+func (m *RepositoryMapping) Map(repository string) (string, error) {
+	if err := m.Check(); err != nil {
+		return "", err
+	}
+
+	components := strings.Split(repository, "/")
+	if m.Strip >= len(components) {
+		return "", fmt.Errorf("cannot strip %v components from repository %v", m.Strip, repository)
+	}
+	result := strings.Join(components[m.Strip:], "/")
+
+	for _, r := range m.Replace {
+		result = regexp.MustCompile(r.Match).ReplaceAllString(result, r.Replace)
+	}
+
+	if m.Separator != "" {
+		result = strings.ReplaceAll(result, "/", m.Separator)
+	}
+
+	if m.Lowercase {
+		result = strings.ToLower(result)
+	}
+
+	// the domain makes sure that the result is only used as path
+	if _, err := reference.ParseNamed("registry.invalid/" + result); err != nil {
+		return "", fmt.Errorf("repository %v is mapped to an invalid path %v: %v", repository, result, err)
+	}
+	return result, nil
+}
+
+// MapDestination returns the destination repository url of source repository path, destination is
+// registry[/namespace].
+func (m *RepositoryMapping) MapDestination(destination, repository string) (string, error) {
+	path, err := m.Map(repository)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(destination, "/") + "/" + path, nil
+}
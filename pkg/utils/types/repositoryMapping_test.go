@@ -0,0 +1,51 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositoryMapping(t *testing.T) {
+	for _, c := range []struct {
+		mapping    RepositoryMapping
+		repository string
+		expected   string
+	}{
+		{RepositoryMapping{}, "org/team/app", "org/team/app"},
+		{RepositoryMapping{Separator: "-"}, "org/team/app", "org-team-app"},
+		{RepositoryMapping{Strip: 1, Separator: "-"}, "sig/x/y", "x-y"},
+		{RepositoryMapping{Strip: 2}, "org/team/app", "app"},
+		{RepositoryMapping{Lowercase: true, Separator: "_"}, "Org/Team/App", "org_team_app"},
+		{
+			RepositoryMapping{
+				Replace:   []RepositoryReplace{{Match: `^kubernetes-sigs/(.*)$`, Replace: "k8s/$1"}},
+				Separator: "-",
+			},
+			"kubernetes-sigs/kind/node", "k8s-kind-node",
+		},
+	} {
+		result, err := c.mapping.Map(c.repository)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, result, "%+v", c.mapping)
+	}
+
+	mapping := &RepositoryMapping{Strip: 1, Separator: "-"}
+	result, err := mapping.MapDestination("registry.example.com/ns/", "org/team/app")
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.example.com/ns/team-app", result)
+
+	for _, c := range []struct {
+		mapping    RepositoryMapping
+		repository string
+	}{
+		{RepositoryMapping{Strip: 3}, "org/team/app"},
+		{RepositoryMapping{Strip: -1}, "org/team/app"},
+		{RepositoryMapping{Replace: []RepositoryReplace{{Match: "("}}}, "org/team/app"},
+		{RepositoryMapping{Separator: "@"}, "org/team/app"},
+		{RepositoryMapping{}, "Org/App"},
+	} {
+		_, err = c.mapping.Map(c.repository)
+		assert.Error(t, err, "%+v", c.mapping)
+	}
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// schemaProperties returns the property names of a definition in the json schema file.
+func schemaProperties(t *testing.T, file, definition string) []string {
+	content, err := os.ReadFile("../../../schemas/" + file)
+	assert.Nil(t, err)
+
+	var schema struct {
+		Definitions map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"definitions"`
+	}
+	assert.Nil(t, json.Unmarshal(content, &schema))
+
+	var result []string
+	for name := range schema.Definitions[definition].Properties {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// jsonFields returns the json names of the fields of a struct.
+func jsonFields(value interface{}) []string {
+	var result []string
+	valueType := reflect.TypeOf(value)
+	for index := 0; index < valueType.NumField(); index++ {
+		name := strings.Split(valueType.Field(index).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestSchemaMatchesTypes(t *testing.T) {
+	for definition, value := range map[string]interface{}{
+		"ruleObject":        ruleObject{},
+		"tagFilter":         TagFilter{},
+		"semverSelector":    SemverSelector{},
+		"metadataFilter":    MetadataFilter{},
+		"tagTemplate":       TagTemplate{},
+		"repositoryMapping": RepositoryMapping{},
+		"destinationSet":    DestinationSet{},
+	} {
+		assert.Equal(t, jsonFields(value), schemaProperties(t, "images.schema.json", definition), definition)
+	}
+
+	assert.Equal(t, jsonFields(Auth{}), schemaProperties(t, "auth.schema.json", "auth"))
+
+	// defaults have the options of rule object except the ones which are not supported, and namespace
+	var defaults []string
+	for _, name := range jsonFields(ruleObject{}) {
+		switch name {
+		case "source", "destinations", "failover", "enabled", "matrix":
+		default:
+			defaults = append(defaults, name)
+		}
+	}
+	defaults = append(defaults, namespaceKey)
+	sort.Strings(defaults)
+	assert.Equal(t, defaults, schemaProperties(t, "images.schema.json", "defaults"))
+}
@@ -0,0 +1,149 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+const (
+	// KeepPerMajor keeps the newest versions of each major line, e.g., 1.x
+	KeepPerMajor = "major"
+	// KeepPerMinor keeps the newest versions of each minor line, e.g., 1.20.x
+	KeepPerMinor = "minor"
+)
+
+// tagVersionRegexp matches tags like "1.20", "v1.20.3" and "1.21.0-rc.1", the minor number is required so that dates
+// and build numbers like "20240101" are not taken as major versions.
+var tagVersionRegexp = regexp.MustCompile(`^v?([0-9]+)\.([0-9]+)(\.[0-9]+)?([-+].*)?$`)
+
+// parseTagVersion parses tag as a semantic version, a "v" prefix and a missing patch number are tolerated.
+func parseTagVersion(tag string) (*semver.Version, error) {
+	match := tagVersionRegexp.FindStringSubmatch(tag)
+	if match == nil {
+		return nil, fmt.Errorf("tag %v is not a semantic version", tag)
+	}
+
+	patch := match[3]
+	if patch == "" {
+		patch = ".0"
+	}
+	return semver.StrictNewVersion(match[1] + "." + match[2] + patch + match[4])
+}
+
+// SemverSelector selects tags which are semantic versions, a "v" prefix and a missing patch number are tolerated,
+// e.g., "v1.20" is the same as "1.20.0". Tags which are not semantic versions are never selected, including the ones
+// without a minor number like "20240101".
+type SemverSelector struct {
+	// Constraint is the version range to select, e.g., ">=1.20 <2.0", "~1.20", "^1.2 || >=3.0", all the versions
+	// match if it's empty.
+	Constraint string `json:"constraint"`
+
+	// Prerelease decides whether to select pre-release versions, whose major.minor.patch are checked by Constraint.
+	Prerelease bool `json:"prerelease"`
+
+	// Keep is the number of newest versions to keep, which is overall or per major/minor line decided by KeepPer,
+	// all the versions are kept if it's 0.
+	Keep    int    `json:"keep"`
+	KeepPer string `json:"keepPer"`
+}
+
+// Check checks if the settings of selector are valid.
+func (s *SemverSelector) Check() error {
+	if s.Constraint != "" {
+		if _, err := semver.NewConstraint(s.Constraint); err != nil {
+			return fmt.Errorf("invalid semver constraint \"%v\": %v", s.Constraint, err)
+		}
+	}
+
+	if s.Keep < 0 {
+		return fmt.Errorf("semver keep should not be negative")
+	}
+
+	switch s.KeepPer {
+	case "", KeepPerMajor, KeepPerMinor:
+	default:
+		return fmt.Errorf("invalid semver keepPer %v, which should be empty, %v or %v",
+			s.KeepPer, KeepPerMajor, KeepPerMinor)
+	}
+
+	return nil
+}
+
+// Select returns the tags selected by selector in their original order.
+func (s *SemverSelector) Select(tags []string) ([]string, error) {
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+
+	var constraint *semver.Constraints
+	if s.Constraint != "" {
+		constraint, _ = semver.NewConstraint(s.Constraint)
+	}
+
+	type taggedVersion struct {
+		tag     string
+		version *semver.Version
+	}
+
+	var candidates []taggedVersion
+	for _, tag := range tags {
+		version, err := parseTagVersion(tag)
+		if err != nil {
+			continue
+		}
+
+		if version.Prerelease() != "" {
+			if !s.Prerelease {
+				continue
+			}
+
+			// constraints never match pre-releases unless they have pre-release parts themselves
+			core, _ := version.SetPrerelease("")
+			if constraint != nil && !constraint.Check(&core) {
+				continue
+			}
+		} else if constraint != nil && !constraint.Check(version) {
+			continue
+		}
+
+		candidates = append(candidates, taggedVersion{tag: tag, version: version})
+	}
+
+	selected := map[string]struct{}{}
+	if s.Keep == 0 {
+		for _, c := range candidates {
+			selected[c.tag] = struct{}{}
+		}
+	} else {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].version.GreaterThan(candidates[j].version)
+		})
+
+		kept := map[string]int{}
+		for _, c := range candidates {
+			var line string
+			switch s.KeepPer {
+			case KeepPerMajor:
+				line = fmt.Sprintf("%d", c.version.Major())
+			case KeepPerMinor:
+				line = fmt.Sprintf("%d.%d", c.version.Major(), c.version.Minor())
+			}
+
+			if kept[line] < s.Keep {
+				kept[line]++
+				selected[c.tag] = struct{}{}
+			}
+		}
+	}
+
+	var result []string
+	for _, tag := range tags {
+		if _, exist := selected[tag]; exist {
+			result = append(result, tag)
+		}
+	}
+	return result, nil
+}
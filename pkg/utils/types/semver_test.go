@@ -0,0 +1,72 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemverSelector(t *testing.T) {
+	tags := []string{
+		"latest", "v1.19.3", "v1.20.0", "v1.20.1", "v1.20.2", "v1.21.0-rc.1", "v1.21.0", "v1.21.1",
+		"v2.0.0-beta.1", "v2.0.0", "1.22", "nightly-20240101", "20240101", "3", "v01.2.3", "1.2.3.4",
+	}
+
+	for _, c := range []struct {
+		selector SemverSelector
+		expected []string
+	}{
+		{
+			selector: SemverSelector{},
+			expected: []string{"v1.19.3", "v1.20.0", "v1.20.1", "v1.20.2", "v1.21.0", "v1.21.1", "v2.0.0", "1.22"},
+		},
+		{
+			selector: SemverSelector{Constraint: ">=1.20 <2.0"},
+			expected: []string{"v1.20.0", "v1.20.1", "v1.20.2", "v1.21.0", "v1.21.1", "1.22"},
+		},
+		{
+			selector: SemverSelector{Constraint: ">=1.20 <2.0", Prerelease: true},
+			expected: []string{"v1.20.0", "v1.20.1", "v1.20.2", "v1.21.0-rc.1", "v1.21.0", "v1.21.1", "1.22"},
+		},
+		{
+			selector: SemverSelector{Keep: 2},
+			expected: []string{"v2.0.0", "1.22"},
+		},
+		{
+			selector: SemverSelector{Constraint: ">=1.20", Keep: 2, KeepPer: KeepPerMinor},
+			expected: []string{"v1.20.1", "v1.20.2", "v1.21.0", "v1.21.1", "v2.0.0", "1.22"},
+		},
+		{
+			selector: SemverSelector{Keep: 1, KeepPer: KeepPerMajor, Prerelease: true},
+			expected: []string{"v2.0.0", "1.22"},
+		},
+	} {
+		result, err := c.selector.Select(tags)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, result, "%+v", c.selector)
+	}
+
+	// only the tags with major and minor numbers are semantic versions
+	for tag, expected := range map[string]string{
+		"1.22":         "1.22.0",
+		"v1.21.0-rc.1": "1.21.0-rc.1",
+		"1.20+build.1": "1.20.0+build.1",
+	} {
+		version, err := parseTagVersion(tag)
+		assert.NoError(t, err, tag)
+		assert.Equal(t, expected, version.String(), tag)
+	}
+	for _, tag := range []string{"20240101", "v3", "v01.2.3", "1.2.3.4", "latest"} {
+		_, err := parseTagVersion(tag)
+		assert.Error(t, err, tag)
+	}
+
+	for _, invalid := range []SemverSelector{
+		{Constraint: ">=one"},
+		{Keep: -1},
+		{KeepPer: "patch"},
+	} {
+		_, err := invalid.Select(tags)
+		assert.Error(t, err, "%+v", invalid)
+	}
+}
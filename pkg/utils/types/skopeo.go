@@ -0,0 +1,146 @@
+package types
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/AliyunContainerService/image-syncer/pkg/utils"
+)
+
+// SkopeoOptions are the options of "skopeo sync" which are provided by command line rather than its yaml file.
+type SkopeoOptions struct {
+	// Destination is the registry[/namespace] which images are synchronized to, like the destination argument of
+	// "skopeo sync --dest docker"
+	Destination string
+
+	// Scoped keeps the source registry and repository under Destination like "skopeo sync --scoped", otherwise only
+	// the last component of source repository is kept
+	Scoped bool
+}
+
+// skopeoRegistry is the settings of a source registry in the yaml file of "skopeo sync --src yaml"
+type skopeoRegistry struct {
+	// Images are the tags or digests of each repository, all the tags are synchronized if the list is empty
+	Images           map[string][]string `json:"images"`
+	ImagesByTagRegex map[string]string   `json:"images-by-tag-regex"`
+	ImagesBySemver   map[string]string   `json:"images-by-semver"`
+
+	Credentials *struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"credentials"`
+	TLSVerify *bool  `json:"tls-verify"`
+	CertDir   string `json:"cert-dir"`
+}
+
+// ImportSkopeo converts the yaml file of "skopeo sync --src yaml", whose keys are source registries, into image sync
+// rules and authentication information. Tag regular expressions and semver constraints are converted into the tag
+// filters of rules.
+func ImportSkopeo(tree map[string]interface{}, options SkopeoOptions) (*ImportedConfig, error) {
+	destination := strings.TrimSuffix(strings.TrimPrefix(options.Destination, "docker://"), "/")
+	if destination == "" {
+		return nil, fmt.Errorf("destination of skopeo sync is not provided")
+	}
+
+	result := newImportedConfig()
+
+	for _, registry := range sortedKeys(tree) {
+		settings := &skopeoRegistry{}
+		if err := decodeStrict(tree[registry], settings); err != nil {
+			return nil, fmt.Errorf("invalid settings of registry %v: %v", registry, err)
+		}
+
+		destinationOf := func(repository string) (string, error) {
+			registryName, repositoryPath, err := utils.ParseRepositoryOfURL(registry + "/" + repository)
+			if err != nil {
+				return "", err
+			}
+
+			if options.Scoped {
+				return destination + "/" + registryName + "/" + repositoryPath, nil
+			}
+			return destination + "/" + path.Base(repositoryPath), nil
+		}
+
+		for _, repository := range sortedKeys(settings.Images) {
+			source := registry + "/" + repository
+			dest, err := destinationOf(repository)
+			if err != nil {
+				return nil, fmt.Errorf("invalid image %v: %v", source, err)
+			}
+
+			var tags, digests []string
+			for _, item := range settings.Images[repository] {
+				if strings.Contains(item, ":") {
+					digests = append(digests, item)
+				} else {
+					tags = append(tags, item)
+				}
+			}
+
+			if len(tags) != 0 || len(digests) == 0 {
+				url := source
+				if len(tags) != 0 {
+					url += ":" + strings.Join(tags, ",")
+				}
+				result.addRule(url, url, dest, nil)
+			}
+			for _, digest := range digests {
+				url := source + "@" + digest
+				result.addRule(url, url, dest, nil)
+			}
+		}
+
+		for _, repository := range sortedKeys(settings.ImagesByTagRegex) {
+			source := registry + "/" + repository
+			dest, err := destinationOf(repository)
+			if err != nil {
+				return nil, fmt.Errorf("invalid image %v: %v", source, err)
+			}
+
+			result.addRule(source+" (images-by-tag-regex)", source, dest, map[string]interface{}{
+				"tags": map[string]interface{}{"include": "/" + settings.ImagesByTagRegex[repository] + "/"},
+			})
+		}
+
+		for _, repository := range sortedKeys(settings.ImagesBySemver) {
+			source := registry + "/" + repository
+			dest, err := destinationOf(repository)
+			if err != nil {
+				return nil, fmt.Errorf("invalid image %v: %v", source, err)
+			}
+
+			result.addRule(source+" (images-by-semver)", source, dest, map[string]interface{}{
+				"tags": map[string]interface{}{
+					"semver": map[string]interface{}{"constraint": settings.ImagesBySemver[repository]},
+				},
+			})
+		}
+
+		if settings.Credentials != nil || (settings.TLSVerify != nil && !*settings.TLSVerify) {
+			auth := Auth{Insecure: settings.TLSVerify != nil && !*settings.TLSVerify}
+			if settings.Credentials != nil {
+				auth.Username, auth.Password = settings.Credentials.Username, settings.Credentials.Password
+			}
+			result.Auth[registry] = auth
+		}
+		if settings.CertDir != "" {
+			result.warnf("cert-dir of registry %v is ignored, set caFile, certFile and keyFile of its auth "+
+				"information instead", registry)
+		}
+	}
+
+	return result, nil
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	var result []string
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,77 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestImportSkopeo(t *testing.T) {
+	var tree map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+registry.example.com:
+  images:
+    busybox: []
+    redis:
+      - "1.0"
+      - "2.0"
+      - "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+  images-by-tag-regex:
+    nginx: ^1\.13\.[12]-alpine-perl$
+  images-by-semver:
+    alpine: ">= 3.12.0"
+  credentials:
+    username: john
+    password: this is a secret
+  cert-dir: /home/john/certs
+docker.io:
+  tls-verify: false
+  images:
+    busybox:
+      - latest
+`), &tree))
+
+	result, err := ImportSkopeo(tree, SkopeoOptions{Destination: "docker://registry.local/mirror/"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"docker.io/busybox:latest":           "registry.local/mirror/busybox",
+		"registry.example.com/busybox":       "registry.local/mirror/busybox",
+		"registry.example.com/redis:1.0,2.0": "registry.local/mirror/redis",
+		"registry.example.com/redis@sha256:0000000000000000000000000000000000000000000000000000000000000000": "registry.local/mirror/redis",
+		"registry.example.com/nginx (images-by-tag-regex)": map[string]interface{}{
+			"source":       "registry.example.com/nginx",
+			"destinations": "registry.local/mirror/nginx",
+			"tags":         map[string]interface{}{"include": `/^1\.13\.[12]-alpine-perl$/`},
+		},
+		"registry.example.com/alpine (images-by-semver)": map[string]interface{}{
+			"source":       "registry.example.com/alpine",
+			"destinations": "registry.local/mirror/alpine",
+			"tags": map[string]interface{}{
+				"semver": map[string]interface{}{"constraint": ">= 3.12.0"},
+			},
+		},
+	}, result.Images)
+	assert.Equal(t, map[string]Auth{
+		"docker.io":            {Insecure: true},
+		"registry.example.com": {Username: "john", Password: "this is a secret"},
+	}, result.Auth)
+	assert.Len(t, result.Warnings, 1)
+	assert.Contains(t, result.Warnings[0], "cert-dir of registry registry.example.com is ignored")
+
+	_, err = NewImageList(result.Images, nil)
+	assert.NoError(t, err)
+
+	// source registry and repository are kept by scoped destination
+	result, err = ImportSkopeo(tree, SkopeoOptions{Destination: "registry.local/mirror", Scoped: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.local/mirror/docker.io/library/busybox", result.Images["docker.io/busybox:latest"])
+
+	_, err = ImportSkopeo(tree, SkopeoOptions{})
+	assert.ErrorContains(t, err, "destination of skopeo sync is not provided")
+
+	_, err = ImportSkopeo(map[string]interface{}{
+		"registry.example.com": map[string]interface{}{"unknown": true},
+	}, SkopeoOptions{Destination: "registry.local"})
+	assert.ErrorContains(t, err, "invalid settings of registry registry.example.com")
+}
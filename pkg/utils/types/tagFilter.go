@@ -0,0 +1,133 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// TagFilter selects tags which match any pattern of Include (all the tags if Include is empty) and none of Exclude,
+// the excludes are applied last. A pattern is a regular expression if it starts and ends with "/", e.g., "/^v1\..*/",
+// otherwise it's a shell glob, e.g., "v1.*". The tags left are selected by Semver at last if it's not nil.
+type TagFilter struct {
+	Include Patterns `json:"include"`
+	Exclude Patterns `json:"exclude"`
+
+	Semver *SemverSelector `json:"semver"`
+}
+
+// Patterns is a list of tag patterns, which can be decoded from a string or a string list
+type Patterns []string
+
+// UnmarshalJSON decodes a pattern string or a pattern list.
+func (p *Patterns) UnmarshalJSON(data []byte) error {
+	var pattern string
+	if err := json.Unmarshal(data, &pattern); err == nil {
+		*p = Patterns{pattern}
+		return nil
+	}
+
+	var patterns []string
+	if err := json.Unmarshal(data, &patterns); err != nil {
+		return fmt.Errorf("tag patterns should only be string or []string")
+	}
+	*p = patterns
+	return nil
+}
+
+// Filter returns the tags selected by filter in their original order.
+func (f TagFilter) Filter(tags []string) ([]string, error) {
+	matcher, err := f.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, tag := range tags {
+		if matcher(tag) {
+			result = append(result, tag)
+		}
+	}
+
+	if f.Semver != nil {
+		return f.Semver.Select(result)
+	}
+	return result, nil
+}
+
+func (f TagFilter) compile() (func(tag string) bool, error) {
+	includes, err := compilePatterns(f.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	excludes, err := compilePatterns(f.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Semver != nil {
+		if err = f.Semver.Check(); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(tag string) bool {
+		included := len(includes) == 0
+		for _, include := range includes {
+			if include(tag) {
+				included = true
+				break
+			}
+		}
+
+		if !included {
+			return false
+		}
+
+		for _, exclude := range excludes {
+			if exclude(tag) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func compilePatterns(patterns Patterns) ([]func(tag string) bool, error) {
+	var result []func(tag string) bool
+	for _, pattern := range patterns {
+		matcher, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, matcher)
+	}
+	return result, nil
+}
+
+// compilePattern compiles a regular expression ("/regex/") or a shell glob into a tag matcher.
+func compilePattern(pattern string) (func(tag string) bool, error) {
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("empty tag pattern is not supported")
+	}
+
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		regexStr := pattern[1 : len(pattern)-1]
+		regex, err := regexp.Compile(regexStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag regex: \"%v\": %v", regexStr, err)
+		}
+		return regex.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid tag glob: \"%v\": %v", pattern, err)
+	}
+	return func(tag string) bool {
+		matched, _ := path.Match(pattern, tag)
+		return matched
+	}, nil
+}
@@ -0,0 +1,44 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagFilter(t *testing.T) {
+	tags := []string{"v1.0", "v1.1-rc1", "v1.1-debug", "v1.1", "v2.0-rc.2", "v2.0", "v3.0", "latest"}
+
+	var filter TagFilter
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"include": ["v1.*", "/^v2\\./"],
+		"exclude": ["*-rc*", "*-debug"]
+	}`), &filter))
+
+	result, err := filter.Filter(tags)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.0", "v1.1", "v2.0"}, result)
+
+	// all the tags are included if there is no include patterns
+	filter = TagFilter{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"exclude": "/^v[12]\\./"}`), &filter))
+	result, err = filter.Filter(tags)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v3.0", "latest"}, result)
+
+	result, err = TagFilter{}.Filter(tags)
+	assert.NoError(t, err)
+	assert.Equal(t, tags, result)
+
+	for _, invalid := range []TagFilter{
+		{Include: Patterns{"/(/"}},
+		{Exclude: Patterns{"v1.[0-"}},
+		{Include: Patterns{""}},
+	} {
+		_, err = invalid.Filter(tags)
+		assert.Error(t, err, "%+v", invalid)
+	}
+
+	assert.Error(t, json.Unmarshal([]byte(`{"include": 1}`), &filter))
+}
@@ -0,0 +1,177 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/containers/image/v5/docker/reference"
+)
+
+// Variables of tag template besides the capture groups of TagTemplate.Match
+const (
+	// TagVariable is the source tag
+	TagVariable = "tag"
+	// RepoVariable is the last component of source repository, e.g., "nginx" for "docker.io/library/nginx"
+	RepoVariable = "repo"
+	// DigestVariable is the first 12 hex characters of source manifest digest
+	DigestVariable = "digest"
+	// DateVariable is the UTC date of synchronization, e.g., "20240102"
+	DateVariable = "date"
+)
+
+var anchoredTagRegexp = regexp.MustCompile(`^` + reference.TagRegexp.String() + `$`)
+
+// TagTemplate renders the destination tag of each source tag. Template can refer to the capture groups of Match
+// ("$1", "${1}", "${name}") and the variables ("${tag}", "${repo}", "${digest}", "${date}"), source tags which don't
+// match Match keep their names. Aliases are extra tags of the newest source tag.
+type TagTemplate struct {
+	Match    string   `json:"match"`
+	Template string   `json:"template"`
+	Aliases  []string `json:"aliases"`
+}
+
+// Check checks if the regular expression, the references of template and the aliases are valid.
+func (t *TagTemplate) Check() error {
+	_, err := t.compile()
+	return err
+}
+
+// UsesDigest returns true if template refers to the digest variable, which requires to get source manifests.
+func (t *TagTemplate) UsesDigest() bool {
+	var result bool
+	os.Expand(t.Template, func(name string) string {
+		if name == DigestVariable {
+			result = true
+		}
+		return ""
+	})
+	return result
+}
+
+// RenderTags renders the destination tags of source tags in order, variables returns the variables of the source
+// tag at index. The index of newest source tag which aliases belong to is returned, which is -1 if tags is empty.
+func (t *TagTemplate) RenderTags(tags []string, variables func(index int) (map[string]string, error)) (
+	[]string, int, error) {
+	match, err := t.compile()
+	if err != nil {
+		return nil, -1, err
+	}
+
+	var result []string
+	sources := map[string]string{}
+	for index, tag := range tags {
+		rendered := tag
+
+		var groups []string
+		if match != nil {
+			groups = match.FindStringSubmatch(tag)
+		}
+
+		if match == nil || groups != nil {
+			vars, err := variables(index)
+			if err != nil {
+				return nil, -1, err
+			}
+
+			rendered = os.Expand(t.Template, func(name string) string {
+				if number, err := strconv.Atoi(name); err == nil {
+					return groups[number]
+				}
+				if match != nil {
+					if group := match.SubexpIndex(name); group != -1 {
+						return groups[group]
+					}
+				}
+				return vars[name]
+			})
+
+			if !anchoredTagRegexp.MatchString(rendered) {
+				return nil, -1, fmt.Errorf("tag %v of source tag %v is invalid", rendered, tag)
+			}
+		}
+
+		if source, exist := sources[rendered]; exist {
+			return nil, -1, fmt.Errorf("source tags %v and %v are both rendered to tag %v", source, tag, rendered)
+		}
+		sources[rendered] = tag
+		result = append(result, rendered)
+	}
+
+	if len(tags) == 0 {
+		return result, -1, nil
+	}
+
+	for _, alias := range t.Aliases {
+		if source, exist := sources[alias]; exist {
+			return nil, -1, fmt.Errorf("alias %v collides with the tag of source tag %v", alias, source)
+		}
+	}
+
+	return result, newestTag(tags), nil
+}
+
+func (t *TagTemplate) compile() (*regexp.Regexp, error) {
+	var match *regexp.Regexp
+	if t.Match != "" {
+		var err error
+		if match, err = regexp.Compile(t.Match); err != nil {
+			return nil, fmt.Errorf("invalid tag template match \"%v\": %v", t.Match, err)
+		}
+	}
+
+	if t.Template == "" {
+		return nil, fmt.Errorf("tag template should not be empty")
+	}
+
+	var unknown []string
+	os.Expand(t.Template, func(name string) string {
+		if number, err := strconv.Atoi(name); err == nil {
+			if match == nil || number > match.NumSubexp() {
+				unknown = append(unknown, name)
+			}
+			return ""
+		}
+
+		switch name {
+		case TagVariable, RepoVariable, DigestVariable, DateVariable:
+		default:
+			if match == nil || match.SubexpIndex(name) == -1 {
+				unknown = append(unknown, name)
+			}
+		}
+		return ""
+	})
+	if len(unknown) != 0 {
+		return nil, fmt.Errorf("unknown references %v in tag template \"%v\"", unknown, t.Template)
+	}
+
+	for _, alias := range t.Aliases {
+		if !anchoredTagRegexp.MatchString(alias) {
+			return nil, fmt.Errorf("invalid alias tag %v", alias)
+		}
+	}
+
+	return match, nil
+}
+
+// newestTag returns the index of the greatest semantic version of tags, or the last one if none of them is a semantic
+// version.
+func newestTag(tags []string) int {
+	result := len(tags) - 1
+
+	var newest *semver.Version
+	for index, tag := range tags {
+		version, err := parseTagVersion(tag)
+		if err != nil {
+			continue
+		}
+
+		if newest == nil || version.GreaterThan(newest) {
+			newest, result = version, index
+		}
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagTemplate(t *testing.T) {
+	tags := []string{"v1.2.3", "v1.10.0", "latest", "v1.9.9"}
+	variables := func(index int) (map[string]string, error) {
+		return map[string]string{
+			TagVariable:    tags[index],
+			RepoVariable:   "nginx",
+			DigestVariable: fmt.Sprintf("%012d", index),
+			DateVariable:   "20240102",
+		}, nil
+	}
+
+	template := &TagTemplate{
+		Match:    `^v(?P<version>\d+\.\d+)\.(\d+)$`,
+		Template: "${repo}-${version}.$2-corp-${digest}",
+		Aliases:  []string{"stable"},
+	}
+	assert.NoError(t, template.Check())
+	assert.True(t, template.UsesDigest())
+
+	result, newest, err := template.RenderTags(tags, variables)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"nginx-1.2.3-corp-000000000000", "nginx-1.10.0-corp-000000000001", "latest", "nginx-1.9.9-corp-000000000003",
+	}, result)
+	assert.Equal(t, 1, newest)
+
+	// tags without semantic versions, the last one is the newest
+	template = &TagTemplate{Template: "$tag-$date"}
+	assert.False(t, template.UsesDigest())
+	result, newest, err = template.RenderTags([]string{"a", "b"}, func(index int) (map[string]string, error) {
+		return map[string]string{TagVariable: []string{"a", "b"}[index], DateVariable: "20240102"}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a-20240102", "b-20240102"}, result)
+	assert.Equal(t, 1, newest)
+
+	_, newest, err = template.RenderTags(nil, variables)
+	assert.NoError(t, err)
+	assert.Equal(t, -1, newest)
+
+	// date tags are not semantic versions
+	assert.Equal(t, 0, newestTag([]string{"v1.2", "20240101"}))
+
+	for _, c := range []struct {
+		template *TagTemplate
+		tags     []string
+	}{
+		// collisions
+		{&TagTemplate{Match: `^v(\d+)\.`, Template: "$1"}, []string{"v1.0", "v1.1"}},
+		{&TagTemplate{Match: `^v(.*)$`, Template: "$1"}, []string{"v1.0", "1.0"}},
+		{&TagTemplate{Match: `^v(.*)$`, Template: "$1", Aliases: []string{"1.0"}}, []string{"v1.0"}},
+		// illegal tags
+		{&TagTemplate{Match: `^(.*)$`, Template: "-$1"}, []string{"v1.0"}},
+		{&TagTemplate{Template: "${repo}:${tag}"}, []string{"v1.0"}},
+	} {
+		_, _, err = c.template.RenderTags(c.tags, variables)
+		assert.Error(t, err, "%+v", c.template)
+	}
+
+	for _, invalid := range []TagTemplate{
+		{},
+		{Match: "(", Template: "$1"},
+		{Template: "$1"},
+		{Match: "^v(.*)$", Template: "$2"},
+		{Template: "${unknown}"},
+		{Template: "$tag", Aliases: []string{"-latest"}},
+	} {
+		assert.Error(t, invalid.Check(), "%+v", invalid)
+	}
+}
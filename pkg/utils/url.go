@@ -22,20 +22,39 @@ type RepoURL struct {
 	registry    string
 	repo        string
 	tagOrDigest string
+
+	// pinnedDigest is the digest which tag is expected to resolve to, e.g., "nginx:1.25@sha256:..."
+	pinnedDigest string
 }
 
 // GenerateRepoURLs creates a RepoURL slice.
 // If url has no tags or digest, tags or digest should be provided by externalTagsOrDigest func,
 // and empty slice will be returned if no tags or digest is provided.
-func GenerateRepoURLs(url string, externalTagsOrDigest func(registry, repository string,
+func (p *URLParser) GenerateRepoURLs(url string, externalTagsOrDigest func(registry, repository string,
 ) (tagsOrDigest []string, err error)) ([]*RepoURL, error) {
 	var result []*RepoURL
+
+	// registries which docker references cannot express are masked while parsing
+	url, explicitRegistry := p.maskRegistry(url)
+	if explicitRegistry != "" {
+		listTags := externalTagsOrDigest
+		externalTagsOrDigest = func(_, repository string) ([]string, error) {
+			return listTags(explicitRegistry, repository)
+		}
+	}
+
 	ref, err := reference.ParseNormalizedNamed(url)
 
 	var tagsOrDigest []string
 	var urlWithoutTagOrDigest string
-
-	if canonicalRef, ok := ref.(reference.Canonical); ok {
+	var pinnedDigest string
+
+	if pinnedRef, ok := ref.(reference.Canonical); ok && isTagged(ref) {
+		// url has one tag pinned to a digest
+		tagsOrDigest = append(tagsOrDigest, ref.(reference.NamedTagged).Tag())
+		pinnedDigest = pinnedRef.Digest().String()
+		urlWithoutTagOrDigest = pinnedRef.Name()
+	} else if canonicalRef, ok := ref.(reference.Canonical); ok {
 		// url has digest
 		tagsOrDigest = append(tagsOrDigest, canonicalRef.Digest().String())
 		urlWithoutTagOrDigest = canonicalRef.Name()
@@ -104,20 +123,25 @@ func GenerateRepoURLs(url string, externalTagsOrDigest func(registry, repository
 	}
 
 	registry, repo := getRegistryAndRepositoryFromURLWithoutTagOrDigest(urlWithoutTagOrDigest)
+	urlRegistry := registry
+	if explicitRegistry != "" {
+		urlRegistry = explicitRegistry
+	}
 
 	// if no tags or digest provided, an empty slice will be returned
 	for _, item := range tagsOrDigest {
 		newURL := registry + "/" + repo + AttachConnectorToTagOrDigest(item)
 		ref, err = reference.ParseNormalizedNamed(newURL)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parese canonical url: %v", newURL)
+			return nil, fmt.Errorf("failed to parese canonical url: %v", unmaskRegistry(newURL, explicitRegistry))
 		}
 
 		result = append(result, &RepoURL{
-			ref:         ref,
-			registry:    registry,
-			repo:        repo,
-			tagOrDigest: item,
+			ref:          ref,
+			registry:     urlRegistry,
+			repo:         repo,
+			tagOrDigest:  item,
+			pinnedDigest: pinnedDigest,
 		})
 	}
 
@@ -126,7 +150,15 @@ func GenerateRepoURLs(url string, externalTagsOrDigest func(registry, repository
 
 // GetURL returns the whole url
 func (r *RepoURL) String() string {
-	return r.ref.String()
+	result := r.ref.String()
+	if rest, found := strings.CutPrefix(result, placeholderRegistry+"/"); found {
+		result = r.registry + "/" + rest
+	}
+
+	if r.pinnedDigest != "" {
+		result += "@" + r.pinnedDigest
+	}
+	return result
 }
 
 // GetRegistry returns the registry in a url
@@ -153,6 +185,11 @@ func (r *RepoURL) GetRepoWithTagOrDigest() string {
 	return r.repo + AttachConnectorToTagOrDigest(r.tagOrDigest)
 }
 
+// GetPinnedDigest returns the digest which tag is pinned to, it's empty if url is not pinned.
+func (r *RepoURL) GetPinnedDigest() string {
+	return r.pinnedDigest
+}
+
 func (r *RepoURL) HasDigest() bool {
 	_, result := r.ref.(reference.Canonical)
 	return result
@@ -174,6 +211,11 @@ func AttachConnectorToTagOrDigest(tagOrDigest string) string {
 	return "@" + tagOrDigest
 }
 
+func isTagged(ref reference.Reference) bool {
+	_, result := ref.(reference.NamedTagged)
+	return result
+}
+
 func getRegistryAndRepositoryFromURLWithoutTagOrDigest(urlWithoutTagOrDigest string) (registry string, repo string) {
 	slice := strings.SplitN(urlWithoutTagOrDigest, "/", 2)
 	if len(slice) == 1 {
@@ -186,3 +228,176 @@ func getRegistryAndRepositoryFromURLWithoutTagOrDigest(urlWithoutTagOrDigest str
 
 	return
 }
+
+// ParseRepository splits a repository url without tag or digest, e.g., "quay.io/coreos/etcd", into registry and
+// repository.
+func (p *URLParser) ParseRepository(url string) (registry string, repo string, err error) {
+	masked, explicitRegistry := p.maskRegistry(url)
+	ref, err := reference.ParseNormalizedNamed(masked)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse repository url %v: %v", url, err)
+	}
+
+	if !reference.IsNameOnly(ref) {
+		return "", "", fmt.Errorf("repository url %v should not include tag or digest", url)
+	}
+
+	registry, repo = getRegistryAndRepositoryFromURLWithoutTagOrDigest(masked)
+	if explicitRegistry != "" {
+		registry = explicitRegistry
+	}
+	return registry, repo, nil
+}
+
+// ParseRepositoryOfURL returns the normalized registry and repository of an image url which might have tags, a tag
+// regex or digest, e.g., "docker.io" and "library/nginx" for "nginx:/^1\..*/".
+func (p *URLParser) ParseRepositoryOfURL(url string) (registry string, repo string, err error) {
+	name, explicitRegistry := p.maskRegistry(url)
+	if index := strings.Index(name, "@"); index != -1 {
+		name = name[:index]
+	}
+
+	if index := strings.Index(name, ":/"); index != -1 {
+		name = name[:index]
+	} else if index = strings.LastIndex(name, ":"); index > strings.LastIndex(name, "/") {
+		name = name[:index]
+	}
+
+	named, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse repository of url %v: %v", url, err)
+	}
+
+	if explicitRegistry != "" {
+		return explicitRegistry, reference.Path(named), nil
+	}
+	return reference.Domain(named), reference.Path(named), nil
+}
+
+// WildcardURL is a source url whose last path component of repository is "*" (one level) or "**" (any levels),
+// e.g., "harbor.corp/platform/*" or "registry.example.com/**:latest".
+type WildcardURL struct {
+	Registry string
+	// Namespace is empty if all the repositories of registry are matched
+	Namespace string
+	Recursive bool
+	// Suffix is the tags, tag regex or digest part of url, e.g., ":latest", ":/^v1/" or "@sha256:..."
+	Suffix string
+}
+
+// IsWildcardURL returns true if the repository of url has a "*".
+func (p *URLParser) IsWildcardURL(url string) bool {
+	masked, _ := p.maskRegistry(url)
+	name, _ := splitTagsOfURL(masked)
+	return strings.Contains(name, "*")
+}
+
+// ParseWildcardURL parses a wildcard url, whose registry should be explicit.
+func (p *URLParser) ParseWildcardURL(url string) (*WildcardURL, error) {
+	masked, explicitRegistry := p.maskRegistry(url)
+	name, suffix := splitTagsOfURL(masked)
+
+	result := &WildcardURL{Suffix: suffix}
+	switch {
+	case strings.HasSuffix(name, "/**"):
+		result.Recursive = true
+		name = strings.TrimSuffix(name, "/**")
+	case strings.HasSuffix(name, "/*"):
+		name = strings.TrimSuffix(name, "/*")
+	default:
+		return nil, fmt.Errorf("invalid wildcard url %v, the last path component should be \"*\" or \"**\"", url)
+	}
+
+	if strings.Contains(name, "*") {
+		return nil, fmt.Errorf("invalid wildcard url %v, only the last path component can be a wildcard", url)
+	}
+
+	slice := strings.SplitN(name, "/", 2)
+	if !strings.ContainsAny(slice[0], ".:") && slice[0] != "localhost" {
+		return nil, fmt.Errorf("invalid wildcard url %v, registry should be explicit", url)
+	}
+	result.Registry = slice[0]
+	if explicitRegistry != "" {
+		result.Registry = explicitRegistry
+	}
+
+	if len(slice) == 2 {
+		if _, err := reference.ParseNamed(name); err != nil {
+			return nil, fmt.Errorf("invalid namespace of wildcard url %v: %v", url, err)
+		}
+		result.Namespace = slice[1]
+	}
+
+	return result, nil
+}
+
+// Match returns the part of repository matched by wildcard, e.g., "app" for "platform/app" with "platform/*".
+func (w *WildcardURL) Match(repository string) (string, bool) {
+	rest := repository
+	if w.Namespace != "" {
+		var found bool
+		if rest, found = strings.CutPrefix(repository, w.Namespace+"/"); !found {
+			return "", false
+		}
+	}
+
+	if rest == "" || (!w.Recursive && strings.Contains(rest, "/")) {
+		return "", false
+	}
+	return rest, true
+}
+
+// URL returns the url of a repository matched by wildcard, with the tags, tag regex or digest of wildcard url.
+func (w *WildcardURL) URL(repository string) string {
+	return w.Registry + "/" + repository + w.Suffix
+}
+
+// splitTagsOfURL splits url into repository and the tags, tag regex or digest part.
+func splitTagsOfURL(url string) (name string, suffix string) {
+	index := strings.Index(url, "@")
+	if tagRegex := strings.Index(url, ":/"); tagRegex != -1 && (index == -1 || tagRegex < index) {
+		index = tagRegex
+	} else {
+		// the tag before digest is included in suffix too
+		end := index
+		if end == -1 {
+			end = len(url)
+		}
+		if colon := strings.LastIndex(url[:end], ":"); colon > strings.LastIndex(url[:end], "/") {
+			index = colon
+		}
+	}
+
+	if index == -1 {
+		return url, ""
+	}
+	return url[:index], url[index:]
+}
+
+// GenerateRepoURLs creates a RepoURL slice, registries served under a path prefix are not known.
+func GenerateRepoURLs(url string, externalTagsOrDigest func(registry, repository string,
+) (tagsOrDigest []string, err error)) ([]*RepoURL, error) {
+	return (*URLParser)(nil).GenerateRepoURLs(url, externalTagsOrDigest)
+}
+
+// ParseRepository splits a repository url without tag or digest, registries served under a path prefix are not
+// known.
+func ParseRepository(url string) (registry string, repo string, err error) {
+	return (*URLParser)(nil).ParseRepository(url)
+}
+
+// ParseRepositoryOfURL returns the normalized registry and repository of an image url, registries served under a
+// path prefix are not known.
+func ParseRepositoryOfURL(url string) (registry string, repo string, err error) {
+	return (*URLParser)(nil).ParseRepositoryOfURL(url)
+}
+
+// IsWildcardURL returns true if the repository of url has a "*", registries served under a path prefix are not known.
+func IsWildcardURL(url string) bool {
+	return (*URLParser)(nil).IsWildcardURL(url)
+}
+
+// ParseWildcardURL parses a wildcard url, registries served under a path prefix are not known.
+func ParseWildcardURL(url string) (*WildcardURL, error) {
+	return (*URLParser)(nil).ParseWildcardURL(url)
+}
@@ -60,3 +60,130 @@ func TestURL(t *testing.T) {
 	assert.Equal(t, DockerHubURL, repoURLs[8].GetRegistry())
 	assert.Equal(t, "bbb", repoURLs[9].GetTagOrDigest())
 }
+
+func TestParseRepositoryOfURL(t *testing.T) {
+	for url, expected := range map[string][2]string{
+		"nginx":                                   {"docker.io", "library/nginx"},
+		"nginx:/^1\\..*/":                         {"docker.io", "library/nginx"},
+		"quay.io/org/team/app:v1,v2":              {"quay.io", "org/team/app"},
+		"127.0.0.1:300/library/nginx":             {"127.0.0.1:300", "library/nginx"},
+		"127.0.0.1:300/library/nginx:v1":          {"127.0.0.1:300", "library/nginx"},
+		"registry.k8s.io/sig/x/y@sha256:" + zeros: {"registry.k8s.io", "sig/x/y"},
+	} {
+		registry, repo, err := ParseRepositoryOfURL(url)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, [2]string{registry, repo}, url)
+	}
+
+	_, _, err := ParseRepositoryOfURL("Invalid/Repo")
+	assert.Error(t, err)
+}
+
+const zeros = "0000000000000000000000000000000000000000000000000000000000000000"
+
+func TestParseWildcardURL(t *testing.T) {
+	wildcard, err := ParseWildcardURL("harbor.corp/platform/*")
+	assert.NoError(t, err)
+	assert.Equal(t, &WildcardURL{Registry: "harbor.corp", Namespace: "platform"}, wildcard)
+
+	matched, ok := wildcard.Match("platform/api")
+	assert.True(t, ok)
+	assert.Equal(t, "api", matched)
+	for _, repository := range []string{"platform/team/web", "platformx/api", "platform"} {
+		_, ok = wildcard.Match(repository)
+		assert.False(t, ok, repository)
+	}
+
+	wildcard, err = ParseWildcardURL("127.0.0.1:5000/**:/^v1\\..*/")
+	assert.NoError(t, err)
+	assert.Equal(t, &WildcardURL{Registry: "127.0.0.1:5000", Recursive: true, Suffix: ":/^v1\\..*/"}, wildcard)
+
+	matched, ok = wildcard.Match("platform/team/web")
+	assert.True(t, ok)
+	assert.Equal(t, "platform/team/web", matched)
+	assert.Equal(t, "127.0.0.1:5000/platform/team/web:/^v1\\..*/", wildcard.URL(matched))
+
+	wildcard, err = ParseWildcardURL("registry.example.com/a/**:v1,v2")
+	assert.NoError(t, err)
+	assert.Equal(t, ":v1,v2", wildcard.Suffix)
+
+	assert.True(t, IsWildcardURL("harbor.corp/platform/*@sha256:"+zeros))
+	assert.False(t, IsWildcardURL("harbor.corp/platform/app:/v.*/"))
+
+	for _, url := range []string{"platform/*", "harbor.corp/*/app", "harbor.corp/a*", "harbor.corp/A/*"} {
+		_, err = ParseWildcardURL(url)
+		assert.Error(t, err, url)
+	}
+}
+
+func TestExplicitRegistry(t *testing.T) {
+	parser := NewURLParser([]string{"artifactory.example.com/artifactory/api/docker/docker-local",
+		"artifactory.example.com/artifactory"})
+
+	urls, err := parser.GenerateRepoURLs("artifactory.example.com/artifactory/api/docker/docker-local/team/app",
+		func(registry, repository string) ([]string, error) {
+			assert.Equal(t, "artifactory.example.com/artifactory/api/docker/docker-local", registry)
+			assert.Equal(t, "team/app", repository)
+			return []string{"v1"}, nil
+		})
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	assert.Equal(t, "artifactory.example.com/artifactory/api/docker/docker-local", urls[0].GetRegistry())
+	assert.Equal(t, "team/app", urls[0].GetRepo())
+	assert.Equal(t, "artifactory.example.com/artifactory/api/docker/docker-local/team/app:v1", urls[0].String())
+
+	// other paths of the same host are not affected
+	registry, repository, err := parser.ParseRepository("artifactory.example.com/team/app")
+	assert.NoError(t, err)
+	assert.Equal(t, "artifactory.example.com", registry)
+	assert.Equal(t, "team/app", repository)
+
+	urls, err = parser.GenerateRepoURLs("[fd00::1]:5000/library/nginx:v1,v2", nil)
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2)
+	assert.Equal(t, "[fd00::1]:5000", urls[1].GetRegistry())
+	assert.Equal(t, "library/nginx", urls[1].GetRepo())
+	assert.Equal(t, "[fd00::1]:5000/library/nginx:v2", urls[1].String())
+
+	urls, err = parser.GenerateRepoURLs("[fd00::1]:5000/nginx@sha256:"+zeros, nil)
+	assert.NoError(t, err)
+	assert.True(t, urls[0].HasDigest())
+
+	registry, repository, err = parser.ParseRepositoryOfURL("[fd00::1]:5000/library/nginx:/^1\\./")
+	assert.NoError(t, err)
+	assert.Equal(t, "[fd00::1]:5000", registry)
+	assert.Equal(t, "library/nginx", repository)
+
+	wildcard, err := parser.ParseWildcardURL("artifactory.example.com/artifactory/api/docker/docker-local/team/*")
+	assert.NoError(t, err)
+	assert.Equal(t, &WildcardURL{Registry: "artifactory.example.com/artifactory/api/docker/docker-local",
+		Namespace: "team"}, wildcard)
+
+	// registries served under a path prefix are not known without parser
+	registry, repository, err = ParseRepository("artifactory.example.com/artifactory/api/docker/docker-local/team/app")
+	assert.NoError(t, err)
+	assert.Equal(t, "artifactory.example.com", registry)
+	assert.Equal(t, "artifactory/api/docker/docker-local/team/app", repository)
+
+	_, err = RegistryPrefix("artifactory.example.com", "/artifactory/../x")
+	assert.Error(t, err)
+}
+
+func TestPinnedURL(t *testing.T) {
+	urls, err := GenerateRepoURLs("nginx:1.25@sha256:"+zeros, nil)
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	assert.Equal(t, "1.25", urls[0].GetTagOrDigest())
+	assert.Equal(t, "sha256:"+zeros, urls[0].GetPinnedDigest())
+	assert.False(t, urls[0].HasDigest())
+	assert.Equal(t, "docker.io/library/nginx:1.25@sha256:"+zeros, urls[0].String())
+
+	urls, err = GenerateRepoURLs("nginx@sha256:"+zeros, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, urls[0].GetPinnedDigest())
+	assert.True(t, urls[0].HasDigest())
+
+	wildcard, err := ParseWildcardURL("harbor.corp/platform/*:v1@sha256:" + zeros)
+	assert.NoError(t, err)
+	assert.Equal(t, ":v1@sha256:"+zeros, wildcard.Suffix)
+}